@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mycandys/orders/internal/config"
+	"github.com/mycandys/orders/internal/database"
+	"github.com/mycandys/orders/internal/health"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/pricing"
+	"github.com/mycandys/orders/internal/rabbitmq"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/mycandys/orders/internal/routes"
+	"github.com/mycandys/orders/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+)
+
+// container builds the connections, repositories and services of the process
+// once, everything else gets them passed in.
+type container struct {
+	config *config.Config
+
+	db          *mongo.Database
+	amqp        *rabbitmq.Connection
+	publisher   *rabbitmq.Publisher
+	requestLogs *rabbitmq.QueuePublisher
+
+	orders      repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery]
+	returns     *repository.ReturnRepository
+	idempotency *repository.IdempotencyRepository
+	outbox      *repository.OutboxRepository
+	processed   *repository.ProcessedMessageRepository
+
+	pricing      *pricing.Calculator
+	auth         services.IAuthService
+	analytics    *services.AnalyticsService
+	cart         *services.CartService
+	notification *services.NotificationService
+
+	health *health.Checker
+}
+
+func newContainer(cfg *config.Config) (*container, error) {
+	auth, err := services.NewConfiguredAuthService(services.AuthConfig{
+		Mode:           cfg.Auth.Mode,
+		URL:            cfg.Auth.URL,
+		Timeout:        cfg.Auth.Timeout,
+		JWKSURL:        cfg.Auth.JWKSURL,
+		JWKSCacheTTL:   cfg.Auth.JWKSCacheTTL,
+		Issuer:         cfg.Auth.Issuer,
+		Audience:       cfg.Auth.Audience,
+		RemoteFallback: cfg.Auth.RemoteFallback,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.Connect(cfg.Database.URL, cfg.Database.Name)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to MongoDB: %w", err)
+	}
+
+	amqp, err := rabbitmq.Connect(cfg.RabbitMQ.URL, rabbitmq.OfflinePolicy(cfg.RabbitMQ.OfflinePolicy), cfg.RabbitMQ.BufferSize)
+	if err != nil {
+		database.Disconnect(db.Client(), context.Background())
+		return nil, err
+	}
+
+	c := &container{
+		config: cfg,
+		db:     db,
+		amqp:   amqp,
+
+		orders:      repository.NewOrderRepository(db, cfg.Database.Timeout),
+		returns:     repository.NewReturnRepository(db, cfg.Database.Timeout),
+		idempotency: repository.NewIdempotencyRepository(db, cfg.Orders.IdempotencyKeyTTL, cfg.Database.Timeout),
+		outbox:      repository.NewOutboxRepository(db, cfg.Database.Timeout),
+		processed:   repository.NewProcessedMessageRepository(db),
+
+		pricing: pricing.NewCalculator(pricing.Config{
+			Currency:              cfg.Pricing.Currency,
+			TaxRate:               cfg.Pricing.TaxRate,
+			ShippingCost:          cfg.Pricing.ShippingCost,
+			FreeShippingThreshold: cfg.Pricing.FreeShippingThreshold,
+			Tolerance:             cfg.Pricing.Tolerance,
+		}),
+		auth:         auth,
+		analytics:    services.NewAnalyticsService(cfg.Services.AnalyticsURL, cfg.Services.AnalyticsTimeout),
+		cart:         services.NewCartService(cfg.Services.CartURL, cfg.Services.CartTimeout),
+		notification: services.NewNotificationService(cfg.Services.NotificationURL, cfg.Services.NotificationTimeout),
+	}
+
+	c.publisher, err = rabbitmq.NewPublisher(amqp, cfg.RabbitMQ.OrderEventsExchange)
+	if err != nil {
+		c.close(context.Background())
+		return nil, fmt.Errorf("creating order events publisher: %w", err)
+	}
+
+	c.requestLogs, err = rabbitmq.NewQueuePublisher(amqp, cfg.RabbitMQ.RequestLogExchange, cfg.RabbitMQ.RequestLogQueue)
+	if err != nil {
+		log.Printf("Error declaring request log queue: %v", err)
+	}
+
+	c.health = c.newHealthChecker()
+
+	return c, nil
+}
+
+// newHealthChecker checks MongoDB and RabbitMQ, the circuit breakers and, when
+// enabled, the downstream services.
+func (c *container) newHealthChecker() *health.Checker {
+	checker := health.NewChecker(c.config.Health.CacheTTL, c.config.Health.CheckTimeout)
+	checker.Register("mongo", true, database.Ping(c.db))
+	checker.Register("rabbitmq", true, func(ctx context.Context) error {
+		return c.amqp.Ping()
+	})
+
+	// downstream services only degrade the service, orders can still be read without them
+	if c.config.Health.ProbeServices {
+		client := &http.Client{Timeout: c.config.Health.CheckTimeout}
+		for name, url := range map[string]string{
+			"auth":         c.config.Auth.URL,
+			"cart":         c.config.Services.CartURL,
+			"notification": c.config.Services.NotificationURL,
+		} {
+			if url == "" {
+				continue
+			}
+			checker.Register(name, false, health.HTTPCheck(client, fmt.Sprintf("%s/health", url)))
+		}
+	}
+
+	checker.RegisterDetailed("circuit_breakers", false, services.CheckBreakers)
+
+	return checker
+}
+
+// prepareDatabase migrates legacy orders and creates the indexes the
+// repositories rely on.
+func (c *container) prepareDatabase() error {
+	migrated, err := repository.MigrateLegacyMoney(c.db)
+	if err != nil {
+		return fmt.Errorf("migrating legacy orders: %w", err)
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %d legacy orders to exact money amounts", migrated)
+	}
+
+	for name, indexes := range map[string]interface{ EnsureIndexes() error }{
+		"outbox":             c.outbox,
+		"idempotency key":    c.idempotency,
+		"return":             c.returns,
+		"processed messages": c.processed,
+	} {
+		if err := indexes.EnsureIndexes(); err != nil {
+			return fmt.Errorf("creating %s indexes: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *container) dependencies() routes.Dependencies {
+	return routes.Dependencies{
+		Orders:       c.orders,
+		Returns:      c.returns,
+		Idempotency:  c.idempotency,
+		Pricing:      c.pricing,
+		ReturnWindow: c.config.Orders.ReturnWindow,
+		Auth:         c.auth,
+		Analytics:    c.analytics,
+		RequestLogs:  c.requestLogs,
+		Health:       c.health,
+	}
+}
+
+func (c *container) countOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+	return repository.CountOrdersByStatus(ctx, c.db)
+}
+
+func (c *container) close(ctx context.Context) {
+	if c.publisher != nil {
+		_ = c.publisher.Close()
+	}
+	rabbitmq.Close(c.amqp)
+	database.Disconnect(c.db.Client(), ctx)
+}
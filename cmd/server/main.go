@@ -5,15 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
-	"github.com/mycandys/orders/internal/database"
+	"github.com/mycandys/orders/internal/config"
 	"github.com/mycandys/orders/internal/env"
+	"github.com/mycandys/orders/internal/metrics"
+	"github.com/mycandys/orders/internal/outbox"
 	"github.com/mycandys/orders/internal/rabbitmq"
 	"github.com/mycandys/orders/internal/routes"
 	"github.com/mycandys/orders/internal/swagger"
+	"github.com/mycandys/orders/internal/tracing"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,25 +29,78 @@ func main() {
 	// important only in development
 	_ = godotenv.Load(".env")
 
-	port, err := env.GetEnvVar(env.PORT)
+	cfg, err := config.Load(env.GetStringEnvVar(env.CONFIG_FILE, ""))
 	if err != nil {
-		panic(err)
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
+	log.Printf("Configuration:\n  %s", strings.Join(cfg.Summary(), "\n  "))
 
-	db := database.Connect()
-	defer database.Disconnect(db, context.Background())
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
+	}()
+
+	app, err := newContainer(cfg)
+	if err != nil {
+		log.Fatalf("Error starting application: %v", err)
+	}
+	defer app.close(context.Background())
+
+	if err := app.prepareDatabase(); err != nil {
+		log.Fatalf("Error preparing database: %v", err)
+	}
+
+	consumer, err := rabbitmq.NewConsumer(app.amqp, cfg.RabbitMQ.OrderStatusQueue, app.processed)
+	if err != nil {
+		log.Fatalf("Error creating order status consumer: %v", err)
+	}
 
-	amqp := rabbitmq.Connect()
-	defer rabbitmq.Close(amqp)
+	err = rabbitmq.HandleOrderStatusEvents(consumer, app.orders, cfg.RabbitMQ.PaymentEventsExchange, cfg.RabbitMQ.InventoryEventsExchange)
+	if err != nil {
+		log.Fatalf("Error subscribing to order status events: %v", err)
+	}
+
+	relay := outbox.NewRelay(app.outbox,
+		outbox.NewRabbitMQSink(app.publisher),
+		outbox.NewCartSink(app.cart),
+		outbox.NewNotificationSink(app.notification),
+	)
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(2)
+
+	go func() {
+		defer workers.Done()
+		relay.Run(workersCtx)
+	}()
+
+	go func() {
+		defer workers.Done()
+		consumer.Run(workersCtx)
+	}()
+
+	metrics.RegisterOrdersByStatus(app.countOrdersByStatus)
 
-	app := routes.InitRouter()
-	swagger.InitInfo()
+	router := routes.InitRouter(app.dependencies())
+	swagger.InitInfo(cfg.Server.SwaggerURI)
 
-	fmt.Printf("Swagger UI is available on http://localhost:%s/swagger/index.html\n", port)
+	fmt.Printf("Swagger UI is available on http://localhost:%d/swagger/index.html\n", cfg.Server.Port)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: app,
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler: router,
 	}
 
 	go func() {
@@ -64,5 +122,8 @@ func main() {
 		log.Fatalf("Server shutdown error: %v", err)
 	}
 
+	stopWorkers()
+	workers.Wait()
+
 	log.Println("Server stopped gracefully")
 }
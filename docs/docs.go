@@ -15,13 +15,13 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/health": {
+        "/health/live": {
             "get": {
-                "description": "do health check",
+                "description": "reports that the process is running, it does not check any dependency",
                 "tags": [
                     "health"
                 ],
-                "summary": "health check",
+                "summary": "liveness check",
                 "responses": {
                     "200": {
                         "description": "OK"
@@ -29,21 +29,122 @@ const docTemplate = `{
                 }
             }
         },
+        "/health/ready": {
+            "get": {
+                "description": "checks MongoDB, RabbitMQ, the circuit breakers and optionally the downstream services, results are cached briefly",
+                "tags": [
+                    "health"
+                ],
+                "summary": "readiness check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    }
+                }
+            }
+        },
         "/orders": {
             "get": {
-                "description": "get all orders",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get all orders, staff only",
                 "tags": [
                     "orders"
                 ],
                 "summary": "get all orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "cost",
+                            "status"
+                        ],
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "description": "sort direction",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created at or after, date or date time",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created before, a date includes the whole day",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum total in minor units",
+                        "name": "minCost",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum total in minor units",
+                        "name": "maxCost",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Order"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             },
             "post": {
-                "description": "create order",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "create order, retries with the same Idempotency-Key replay the original response",
                 "consumes": [
                     "application/json"
                 ],
@@ -63,16 +164,42 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/models.CreateOrderDTO"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "unique key of this order, reused when retrying",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "201": {
                         "description": "Created"
+                    },
+                    "400": {
+                        "description": "validation failed"
+                    },
+                    "409": {
+                        "description": "a request with the same idempotency key is still being processed"
+                    },
+                    "422": {
+                        "description": "submitted cost does not match the calculated price or idempotency key reused with a different body"
+                    },
+                    "502": {
+                        "description": "the cart service failed"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             },
             "delete": {
-                "description": "delete all orders",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "delete all orders, admin only",
                 "tags": [
                     "orders"
                 ],
@@ -80,6 +207,9 @@ const docTemplate = `{
                 "responses": {
                     "200": {
                         "description": "OK"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
@@ -96,9 +226,77 @@ const docTemplate = `{
                     "orders"
                 ],
                 "summary": "get all orders by user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "cost",
+                            "status"
+                        ],
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "description": "sort direction",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created at or after, date or date time",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created before, a date includes the whole day",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum total in minor units",
+                        "name": "minCost",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum total in minor units",
+                        "name": "maxCost",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Order"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             },
@@ -116,6 +314,9 @@ const docTemplate = `{
                 "responses": {
                     "200": {
                         "description": "OK"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
@@ -139,18 +340,147 @@ const docTemplate = `{
                         "name": "status",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "cost",
+                            "status"
+                        ],
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "description": "sort direction",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created at or after, date or date time",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created before, a date includes the whole day",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum total in minor units",
+                        "name": "minCost",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum total in minor units",
+                        "name": "maxCost",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Order"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/orders/me/{id}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "cancel one of the caller's orders while it is pending or paid",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "cancel own order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "cancellation",
+                        "name": "cancellation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CancelOrderDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id or payload"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "409": {
+                        "description": "order can no longer be cancelled"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
         },
         "/orders/status/{status}": {
             "get": {
-                "description": "get all orders by status",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get all orders by status, staff only",
                 "tags": [
                     "orders"
                 ],
@@ -162,18 +492,89 @@ const docTemplate = `{
                         "name": "status",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "cost",
+                            "status"
+                        ],
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "description": "sort direction",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created at or after, date or date time",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created before, a date includes the whole day",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum total in minor units",
+                        "name": "minCost",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum total in minor units",
+                        "name": "maxCost",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Order"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
         },
         "/orders/user/{id}": {
             "get": {
-                "description": "get all orders by user",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get all orders by user, staff only",
                 "tags": [
                     "orders"
                 ],
@@ -185,18 +586,89 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "cost",
+                            "status"
+                        ],
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "description": "sort direction",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created at or after, date or date time",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "created before, a date includes the whole day",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum total in minor units",
+                        "name": "minCost",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum total in minor units",
+                        "name": "maxCost",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Order"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
         },
         "/orders/{id}": {
             "get": {
-                "description": "get order by id",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get order by id, customers may only read their own orders. The ETag header holds the order version for If-Match.",
                 "tags": [
                     "orders"
                 ],
@@ -212,12 +684,32 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "order version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             },
             "put": {
-                "description": "update order",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "update order, staff only. With If-Match the order is only updated while its ETag still matches.",
                 "consumes": [
                     "application/json"
                 ],
@@ -236,6 +728,12 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "ETag of the order as last read",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
                     {
                         "description": "order",
                         "name": "order",
@@ -248,54 +746,717 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "order version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id or payload"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "409": {
+                        "description": "illegal status transition"
+                    },
+                    "412": {
+                        "description": "the order was changed since the If-Match ETag was read"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             },
             "delete": {
-                "description": "delete order",
-                "tags": [
-                    "orders"
-                ],
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "delete order, admin only",
+                "tags": [
+                    "orders"
+                ],
                 "summary": "delete order",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "order id",
+                        "description": "order id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "invalid order id"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "change some fields of an order with a JSON Merge Patch, members missing from the patch keep their value and notes are removed with null. Customers may only patch the shipping address and notes of their own orders, staff may also patch the status and expected delivery date. The shipping address can only change while the order is pending. With If-Match the order is only updated while its ETag still matches.",
+                "consumes": [
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "patch order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the order as last read",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "merge patch",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderPatch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "order version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id or patch"
+                    },
+                    "403": {
+                        "description": "the patch contains fields only staff may change"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "409": {
+                        "description": "illegal status transition or the address cannot change anymore"
+                    },
+                    "412": {
+                        "description": "the order was changed since the If-Match ETag was read"
+                    },
+                    "415": {
+                        "description": "the body is no application/merge-patch+json"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/orders/{id}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "cancel any order while it is pending or paid, admin only",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "cancel order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "cancellation",
+                        "name": "cancellation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CancelOrderDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id or payload"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "409": {
+                        "description": "order can no longer be cancelled"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "return items of one of the caller's delivered orders within the return window",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "returns"
+                ],
+                "summary": "open return",
+                "parameters": [
+                    {
+                        "description": "return",
+                        "name": "return",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CreateReturnDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid order id or payload"
+                    },
+                    "404": {
+                        "description": "order not found"
+                    },
+                    "409": {
+                        "description": "order not delivered or return window expired"
+                    },
+                    "422": {
+                        "description": "item not part of the order or already returned"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/me": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get the caller's returns, newest first",
+                "tags": [
+                    "returns"
+                ],
+                "summary": "get own returns",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Return"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/me/status/{status}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get the caller's returns in a status, newest first",
+                "tags": [
+                    "returns"
+                ],
+                "summary": "get own returns by status",
+                "parameters": [
+                    {
+                        "enum": [
+                            "requested",
+                            "approved",
+                            "rejected"
+                        ],
+                        "type": "string",
+                        "description": "return status",
+                        "name": "status",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid return status"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/status/{status}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get all returns in a status, staff only",
+                "tags": [
+                    "returns"
+                ],
+                "summary": "get returns by status",
+                "parameters": [
+                    {
+                        "enum": [
+                            "requested",
+                            "approved",
+                            "rejected"
+                        ],
+                        "type": "string",
+                        "description": "return status",
+                        "name": "status",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid return status"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/user/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get the returns of a user, staff only",
+                "tags": [
+                    "returns"
+                ],
+                "summary": "get returns by user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "page size, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Page-models_Return"
+                        }
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "get return by id, customers may only read their own returns",
+                "tags": [
+                    "returns"
+                ],
+                "summary": "get return by id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "return id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid return id"
+                    },
+                    "404": {
+                        "description": "return not found"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/{id}/approve": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "approve a requested return, refund its items and move the order to returned, or to refunded once every item is returned, staff only",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "returns"
+                ],
+                "summary": "approve return",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "return id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "review",
+                        "name": "review",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReviewReturnDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid return id or payload"
+                    },
+                    "404": {
+                        "description": "return not found"
+                    },
+                    "409": {
+                        "description": "return already reviewed"
+                    },
+                    "422": {
+                        "description": "items were already returned"
+                    },
+                    "504": {
+                        "description": "database timeout"
+                    }
+                }
+            }
+        },
+        "/returns/{id}/reject": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "reject a requested return, staff only",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "returns"
+                ],
+                "summary": "reject return",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "return id",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "review",
+                        "name": "review",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReviewReturnDTO"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid return id or payload"
+                    },
+                    "404": {
+                        "description": "return not found"
+                    },
+                    "409": {
+                        "description": "return already reviewed"
+                    },
+                    "504": {
+                        "description": "database timeout"
                     }
                 }
             }
         }
     },
     "definitions": {
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "checkedAt": {
+                    "type": "string"
+                },
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/health.Result"
+                    }
+                },
+                "status": {
+                    "$ref": "#/definitions/health.Status"
+                }
+            }
+        },
+        "health.Result": {
+            "type": "object",
+            "properties": {
+                "critical": {
+                    "type": "boolean"
+                },
+                "details": {},
+                "error": {
+                    "type": "string"
+                },
+                "latencyMs": {
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/health.Status"
+                }
+            }
+        },
+        "health.Status": {
+            "type": "string",
+            "enum": [
+                "up",
+                "down",
+                "degraded"
+            ],
+            "x-enum-varnames": [
+                "StatusUp",
+                "StatusDown",
+                "StatusDegraded"
+            ]
+        },
+        "models.CancelOrderDTO": {
+            "type": "object",
+            "required": [
+                "reason"
+            ],
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                }
+            }
+        },
+        "models.Cancellation": {
+            "type": "object",
+            "properties": {
+                "cancelledAt": {
+                    "type": "string"
+                },
+                "cancelledBy": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
         "models.CreateOrderDTO": {
             "type": "object",
+            "required": [
+                "address",
+                "city",
+                "country",
+                "items",
+                "postalCode",
+                "userId"
+            ],
             "properties": {
                 "address": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 200
                 },
                 "cartId": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 64
                 },
                 "city": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "cost": {
-                    "type": "number"
+                    "$ref": "#/definitions/models.Money"
                 },
                 "country": {
+                    "description": "Country is an ISO 3166-1 alpha-2 code, PostalCode must match its format.",
                     "type": "string"
                 },
                 "items": {
                     "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
                     "items": {
                         "$ref": "#/definitions/models.Item"
                     }
@@ -304,30 +1465,168 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "userId": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 64
+                }
+            }
+        },
+        "models.CreateReturnDTO": {
+            "type": "object",
+            "required": [
+                "items",
+                "orderId",
+                "reason"
+            ],
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/models.ReturnItemDTO"
+                    }
+                },
+                "orderId": {
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
                 }
             }
         },
         "models.Item": {
             "type": "object",
+            "required": [
+                "id",
+                "name"
+            ],
             "properties": {
                 "category": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "description": {
+                    "type": "string",
+                    "maxLength": 2000
+                },
+                "id": {
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "imgUrl": {
+                    "type": "string",
+                    "maxLength": 2000
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 200
+                },
+                "price": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "maximum": 1000
+                }
+            }
+        },
+        "models.Money": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "currency": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Order": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "cancellation": {
+                    "$ref": "#/definitions/models.Cancellation"
+                },
+                "cartId": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "deliveredAt": {
+                    "type": "string"
+                },
+                "expectedDeliveryDate": {
                     "type": "string"
                 },
                 "id": {
                     "type": "string"
                 },
-                "imgUrl": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Item"
+                    }
+                },
+                "notes": {
                     "type": "string"
                 },
-                "name": {
+                "postalCode": {
                     "type": "string"
                 },
                 "price": {
-                    "type": "number"
+                    "$ref": "#/definitions/models.PriceBreakdown"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.OrderStatus"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version is incremented on every write, orders stored before versions\nexisted are at version 0.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OrderPatch": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "expectedDeliveryDate": {
+                    "type": "string"
+                },
+                "notes": {
+                    "type": "string",
+                    "maxLength": 2000
+                },
+                "postalCode": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.OrderStatus"
                 }
             }
         },
@@ -335,15 +1634,152 @@ const docTemplate = `{
             "type": "string",
             "enum": [
                 "pending",
+                "paid",
                 "shipped",
-                "delivered"
+                "delivered",
+                "cancelled",
+                "returned",
+                "refunded",
+                "failed"
             ],
             "x-enum-varnames": [
                 "OrderStatusPending",
+                "OrderStatusPaid",
                 "OrderStatusShipped",
-                "OrderStatusDelivered"
+                "OrderStatusDelivered",
+                "OrderStatusCancelled",
+                "OrderStatusReturned",
+                "OrderStatusRefunded",
+                "OrderStatusFailed"
+            ]
+        },
+        "models.PriceBreakdown": {
+            "type": "object",
+            "properties": {
+                "discount": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "shipping": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "subtotal": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "tax": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "total": {
+                    "$ref": "#/definitions/models.Money"
+                }
+            }
+        },
+        "models.Refund": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "createdAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Return": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ReturnItem"
+                    }
+                },
+                "orderId": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "refund": {
+                    "$ref": "#/definitions/models.Refund"
+                },
+                "reviewNote": {
+                    "type": "string"
+                },
+                "reviewedBy": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.ReturnStatus"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ReturnItem": {
+            "type": "object",
+            "properties": {
+                "itemId": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "price": {
+                    "$ref": "#/definitions/models.Money"
+                },
+                "quantity": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ReturnItemDTO": {
+            "type": "object",
+            "required": [
+                "itemId"
+            ],
+            "properties": {
+                "itemId": {
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "quantity": {
+                    "type": "integer",
+                    "maximum": 1000
+                }
+            }
+        },
+        "models.ReturnStatus": {
+            "type": "string",
+            "enum": [
+                "requested",
+                "approved",
+                "rejected"
+            ],
+            "x-enum-varnames": [
+                "ReturnStatusRequested",
+                "ReturnStatusApproved",
+                "ReturnStatusRejected"
             ]
         },
+        "models.ReviewReturnDTO": {
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string",
+                    "maxLength": 500
+                }
+            }
+        },
         "models.UpdateOrderDTO": {
             "type": "object",
             "properties": {
@@ -354,6 +1790,40 @@ const docTemplate = `{
                     "$ref": "#/definitions/models.OrderStatus"
                 }
             }
+        },
+        "repository.Page-models_Order": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Order"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.Page-models_Return": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Return"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -0,0 +1,152 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies an error by what the caller can do about it, each kind maps
+// to one HTTP status code.
+type Kind string
+
+const (
+	KindNotFound             Kind = "not-found"
+	KindInvalidID            Kind = "invalid-id"
+	KindValidation           Kind = "validation"
+	KindConflict             Kind = "conflict"
+	KindPreconditionFailed   Kind = "precondition-failed"
+	KindUnsupportedMediaType Kind = "unsupported-media-type"
+	KindUnprocessable        Kind = "unprocessable"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindUpstream             Kind = "upstream"
+	KindTimeout              Kind = "timeout"
+	KindCancelled            Kind = "cancelled"
+	KindInternal             Kind = "internal"
+)
+
+// StatusClientClosedRequest is the non-standard status nginx uses for requests
+// the client gave up on, KindCancelled maps to it.
+const StatusClientClosedRequest = 499
+
+var statuses = map[Kind]int{
+	KindNotFound:             http.StatusNotFound,
+	KindInvalidID:            http.StatusBadRequest,
+	KindValidation:           http.StatusBadRequest,
+	KindConflict:             http.StatusConflict,
+	KindPreconditionFailed:   http.StatusPreconditionFailed,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindUnprocessable:        http.StatusUnprocessableEntity,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindUpstream:             http.StatusBadGateway,
+	KindTimeout:              http.StatusGatewayTimeout,
+	KindCancelled:            StatusClientClosedRequest,
+	KindInternal:             http.StatusInternalServerError,
+}
+
+func (k Kind) Status() int {
+	if status, ok := statuses[k]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error whose message may be shown to the client.
+type Error struct {
+	Kind    Kind
+	Message string
+	// Extensions are added to the problem details, e.g. the violated rules.
+	Extensions map[string]interface{}
+	// Err is the underlying cause, it is never shown to the client.
+	Err error
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func NotFound(message string) *Error {
+	return New(KindNotFound, message)
+}
+
+func InvalidID(id string) *Error {
+	return New(KindInvalidID, fmt.Sprintf("%q is not a valid id", id))
+}
+
+func Validation(message string) *Error {
+	return New(KindValidation, message)
+}
+
+func Conflict(message string, err error) *Error {
+	return Wrap(KindConflict, message, err)
+}
+
+func PreconditionFailed(message string) *Error {
+	return New(KindPreconditionFailed, message)
+}
+
+func Unprocessable(message string, err error) *Error {
+	return Wrap(KindUnprocessable, message, err)
+}
+
+// Upstream reports that another service failed, err says how.
+func Upstream(service string, err error) *Error {
+	return Wrap(KindUpstream, fmt.Sprintf("The %s service did not answer successfully", service), err)
+}
+
+func Timeout(message string, err error) *Error {
+	return Wrap(KindTimeout, message, err)
+}
+
+func Cancelled(message string, err error) *Error {
+	return Wrap(KindCancelled, message, err)
+}
+
+// With returns a copy of the error with an additional problem details member.
+func (e *Error) With(key string, value interface{}) *Error {
+	extensions := make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		extensions[k] = v
+	}
+	extensions[key] = value
+
+	copied := *e
+	copied.Extensions = extensions
+	return &copied
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// As returns the outermost *Error in the chain of err.
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	ok := errors.As(err, &appErr)
+	return appErr, ok
+}
+
+// KindOf returns the kind of err, errors that are no *Error are internal.
+func KindOf(err error) Kind {
+	if appErr, ok := As(err); ok {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
@@ -0,0 +1,109 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindStatus(t *testing.T) {
+	cases := map[Kind]int{
+		KindNotFound:             404,
+		KindInvalidID:            400,
+		KindValidation:           400,
+		KindConflict:             409,
+		KindPreconditionFailed:   412,
+		KindUnsupportedMediaType: 415,
+		KindUnprocessable:        422,
+		KindUnauthorized:         401,
+		KindForbidden:            403,
+		KindUpstream:             502,
+		KindTimeout:              504,
+		KindCancelled:            499,
+		KindInternal:             500,
+		Kind("unknown"):          500,
+	}
+
+	for kind, want := range cases {
+		if got := kind.Status(); got != want {
+			t.Errorf("%s: got status %d want %d", kind, got, want)
+		}
+	}
+}
+
+func TestKindOfWrappedError(t *testing.T) {
+	cause := errors.New("no documents")
+	err := fmt.Errorf("finding order: %w", Wrap(KindNotFound, "Order not found", cause))
+
+	if !Is(err, KindNotFound) {
+		t.Errorf("got kind %s want %s", KindOf(err), KindNotFound)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("the cause is not in the error chain")
+	}
+	if KindOf(cause) != KindInternal {
+		t.Errorf("got kind %s for a plain error want %s", KindOf(cause), KindInternal)
+	}
+	if Is(nil, KindInternal) {
+		t.Error("nil must not be of any kind")
+	}
+}
+
+func TestWithCopiesExtensions(t *testing.T) {
+	base := Conflict("Order can not be changed", nil)
+	extended := base.With("reason", "invalid_transition")
+
+	if base.Extensions != nil {
+		t.Errorf("With modified the original error: %v", base.Extensions)
+	}
+	if extended.Extensions["reason"] != "invalid_transition" {
+		t.Errorf("got extensions %v", extended.Extensions)
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	err := Validation("Validation failed").With("violations", []string{"cost"})
+
+	body, _ := json.Marshal(NewProblem(err, "/orders", "abc"))
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"type":          "/problems/validation",
+		"title":         "Bad Request",
+		"status":        float64(400),
+		"detail":        "Validation failed",
+		"instance":      "/orders",
+		"correlationId": "abc",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s: got %v want %v", key, got[key], value)
+		}
+	}
+	if violations, ok := got["violations"].([]interface{}); !ok || len(violations) != 1 {
+		t.Errorf("extensions are missing: %s", body)
+	}
+}
+
+func TestProblemHidesInternalErrors(t *testing.T) {
+	problem := NewProblem(errors.New("connection refused to mongo:27017"), "/orders", "")
+
+	if problem.Status != 500 || problem.Type != "/problems/internal" {
+		t.Errorf("got %d %s want 500 /problems/internal", problem.Status, problem.Type)
+	}
+	if problem.Detail != "The request could not be processed" {
+		t.Errorf("internal error leaked to the client: %s", problem.Detail)
+	}
+
+	body, _ := json.Marshal(problem)
+	var got map[string]interface{}
+	_ = json.Unmarshal(body, &got)
+	if _, ok := got["correlationId"]; ok {
+		t.Errorf("empty correlation id was rendered: %s", body)
+	}
+}
@@ -0,0 +1,70 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 representation of an error sent to clients.
+type Problem struct {
+	Type          string
+	Title         string
+	Status        int
+	Detail        string
+	Instance      string
+	CorrelationID string
+	Extensions    map[string]interface{}
+}
+
+// NewProblem describes err for the request to instance. The message of errors
+// that are no *Error is not shown, since it may leak internals.
+func NewProblem(err error, instance string, correlationID string) *Problem {
+	kind := KindInternal
+	detail := "The request could not be processed"
+	var extensions map[string]interface{}
+
+	if appErr, ok := As(err); ok {
+		kind = appErr.Kind
+		detail = appErr.Message
+		extensions = appErr.Extensions
+	}
+
+	status := kind.Status()
+	title := http.StatusText(status)
+	if status == StatusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+
+	return &Problem{
+		Type:          "/problems/" + string(kind),
+		Title:         title,
+		Status:        status,
+		Detail:        detail,
+		Instance:      instance,
+		CorrelationID: correlationID,
+		Extensions:    extensions,
+	}
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+6)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	members["detail"] = p.Detail
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	if p.CorrelationID != "" {
+		members["correlationId"] = p.CorrelationID
+	}
+
+	return json.Marshal(members)
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// Config holds every setting of the service. Each setting has a key in the
+// configuration file, made of the key tags of its section and field, an
+// environment variable overriding it, an optional default and validation rules.
+type Config struct {
+	Server   ServerConfig   `key:"server"`
+	Database DatabaseConfig `key:"database"`
+	RabbitMQ RabbitMQConfig `key:"rabbitmq"`
+	Auth     AuthConfig     `key:"auth"`
+	Services ServicesConfig `key:"services"`
+	Orders   OrdersConfig   `key:"orders"`
+	Pricing  PricingConfig  `key:"pricing"`
+	Health   HealthConfig   `key:"health"`
+	Tracing  TracingConfig  `key:"tracing"`
+	sources  map[string]Source
+}
+
+type ServerConfig struct {
+	Port int `key:"port" env:"PORT" default:"8080" validate:"min=1,max=65535"`
+	// SwaggerURI is the host the API documentation is served from.
+	SwaggerURI string `key:"swagger_uri" env:"SWAGGER_URI"`
+}
+
+type DatabaseConfig struct {
+	URL     string        `key:"url" env:"DATABASE_URL" validate:"required,url"`
+	Name    string        `key:"name" env:"DATABASE_NAME" validate:"required"`
+	Timeout time.Duration `key:"timeout" env:"DATABASE_TIMEOUT" default:"5s" validate:"gt=0"`
+}
+
+type RabbitMQConfig struct {
+	URL string `key:"url" env:"RABBITMQ_URL" validate:"required,url"`
+	// OfflinePolicy decides what happens to messages published while disconnected.
+	OfflinePolicy string `key:"offline_policy" env:"RABBITMQ_OFFLINE_POLICY" default:"buffer" validate:"oneof=buffer drop"`
+	BufferSize    int    `key:"buffer_size" env:"RABBITMQ_BUFFER_SIZE" default:"1000" validate:"min=1"`
+	// RequestLogExchange and RequestLogQueue receive a log entry of every request.
+	RequestLogExchange      string `key:"request_log_exchange" env:"EXCHANGE_NAME"`
+	RequestLogQueue         string `key:"request_log_queue" env:"QUEUE_NAME"`
+	OrderEventsExchange     string `key:"order_events_exchange" env:"ORDER_EVENTS_EXCHANGE" default:"orders.events" validate:"required"`
+	OrderStatusQueue        string `key:"order_status_queue" env:"ORDER_STATUS_QUEUE" default:"orders.status" validate:"required"`
+	PaymentEventsExchange   string `key:"payment_events_exchange" env:"PAYMENT_EVENTS_EXCHANGE" default:"payments.events" validate:"required"`
+	InventoryEventsExchange string `key:"inventory_events_exchange" env:"INVENTORY_EVENTS_EXCHANGE" default:"inventory.events" validate:"required"`
+}
+
+type AuthConfig struct {
+	Mode    string        `key:"mode" env:"AUTH_MODE" default:"remote" validate:"oneof=remote jwks"`
+	URL     string        `key:"url" env:"AUTH_SERVICE_URL" validate:"required,url"`
+	Timeout time.Duration `key:"timeout" env:"AUTH_SERVICE_TIMEOUT" default:"3s" validate:"gt=0"`
+	// JWKSURL defaults to the JWKS document of the auth service.
+	JWKSURL        string        `key:"jwks_url" env:"AUTH_JWKS_URL" validate:"omitempty,url"`
+	JWKSCacheTTL   time.Duration `key:"jwks_cache_ttl" env:"AUTH_JWKS_CACHE_TTL" default:"10m" validate:"gt=0"`
+	Issuer         string        `key:"issuer" env:"AUTH_ISSUER"`
+	Audience       string        `key:"audience" env:"AUTH_AUDIENCE"`
+	RemoteFallback bool          `key:"remote_fallback" env:"AUTH_REMOTE_FALLBACK" default:"false"`
+}
+
+type ServicesConfig struct {
+	CartURL             string        `key:"cart_url" env:"CART_SERVICE_URL" validate:"required,url"`
+	CartTimeout         time.Duration `key:"cart_timeout" env:"CART_SERVICE_TIMEOUT" default:"5s" validate:"gt=0"`
+	NotificationURL     string        `key:"notification_url" env:"NOTIFICATIONS_SERVICE_URL" validate:"required,url"`
+	NotificationTimeout time.Duration `key:"notification_timeout" env:"NOTIFICATIONS_SERVICE_TIMEOUT" default:"5s" validate:"gt=0"`
+	AnalyticsURL        string        `key:"analytics_url" env:"ANALYTICS_SERVICE_URL" validate:"omitempty,url"`
+	AnalyticsTimeout    time.Duration `key:"analytics_timeout" env:"ANALYTICS_SERVICE_TIMEOUT" default:"2s" validate:"gt=0"`
+}
+
+type OrdersConfig struct {
+	IdempotencyKeyTTL time.Duration `key:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL" default:"24h" validate:"gt=0"`
+	// ReturnWindow is how long after delivery returns can be opened.
+	ReturnWindow time.Duration `key:"return_window" env:"RETURN_WINDOW" default:"336h" validate:"gt=0"`
+}
+
+// PricingConfig amounts are in major units of Currency.
+type PricingConfig struct {
+	Currency              string  `key:"currency" env:"CURRENCY" default:"EUR" validate:"iso4217"`
+	TaxRate               float64 `key:"tax_rate" env:"TAX_RATE" default:"0" validate:"gte=0"`
+	ShippingCost          float64 `key:"shipping_cost" env:"SHIPPING_COST" default:"0" validate:"gte=0"`
+	FreeShippingThreshold float64 `key:"free_shipping_threshold" env:"FREE_SHIPPING_THRESHOLD" default:"0" validate:"gte=0"`
+	Tolerance             float64 `key:"tolerance" env:"PRICE_TOLERANCE" default:"0.01" validate:"gte=0"`
+}
+
+type HealthConfig struct {
+	// CacheTTL is how long a readiness report is reused, zero disables caching.
+	CacheTTL      time.Duration `key:"cache_ttl" env:"HEALTH_CACHE_TTL" default:"5s" validate:"gte=0"`
+	CheckTimeout  time.Duration `key:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s" validate:"gt=0"`
+	ProbeServices bool          `key:"probe_services" env:"HEALTH_PROBE_SERVICES" default:"false"`
+}
+
+type TracingConfig struct {
+	Exporter    string `key:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none" validate:"oneof=none stdout file otlp"`
+	File        string `key:"file" env:"OTEL_TRACES_FILE" default:"traces.json"`
+	ServiceName string `key:"service_name" env:"OTEL_SERVICE_NAME" default:"orders" validate:"required"`
+}
+
+// Source tells where the value of a setting came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+)
+
+// Source returns where the setting with the file key came from.
+func (c *Config) Source(key string) Source {
+	return c.sources[key]
+}
+
+// Summary lists every setting with its effective value and source, one per
+// line in the order of Config. Passwords in URLs are redacted.
+func (c *Config) Summary() []string {
+	lines := make([]string, 0)
+	for _, s := range settingsOf(c) {
+		source := string(c.sources[s.key])
+		if c.sources[s.key] == SourceEnv {
+			source = s.env
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s (%s)", s.key, redact(s.value), source))
+	}
+	return lines
+}
+
+// redact hides the password of URL values.
+func redact(value reflect.Value) string {
+	if value.Kind() != reflect.String {
+		return fmt.Sprint(value.Interface())
+	}
+
+	u, err := url.Parse(value.String())
+	if err != nil || u.User == nil {
+		return value.String()
+	}
+	return u.Redacted()
+}
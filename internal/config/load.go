@@ -0,0 +1,238 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/mycandys/orders/internal/env"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a single leaf field of Config.
+type setting struct {
+	key   string
+	env   string
+	def   string
+	value reflect.Value
+}
+
+func (s setting) name() string {
+	return fmt.Sprintf("%s (%s)", s.key, s.env)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// settingsOf lists the settings of cfg in field order.
+func settingsOf(cfg *Config) []setting {
+	settings := make([]setting, 0)
+
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Type().Field(i)
+		if !section.IsExported() {
+			continue
+		}
+
+		fields := sections.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			field := fields.Type().Field(j)
+			settings = append(settings, setting{
+				key:   section.Tag.Get("key") + "." + field.Tag.Get("key"),
+				env:   field.Tag.Get("env"),
+				def:   field.Tag.Get("default"),
+				value: fields.Field(j),
+			})
+		}
+	}
+
+	return settings
+}
+
+// set parses raw into the setting, an empty raw value leaves it at zero.
+func (s setting) set(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	if s.value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		s.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		s.value.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		s.value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+// Load applies the defaults, then the YAML or TOML file at path unless path is
+// empty, then the environment, and validates the result. All problems are
+// reported together.
+func Load(path string) (*Config, error) {
+	file := make(map[string]string)
+	if path != "" {
+		var err error
+		if file, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{sources: make(map[string]Source)}
+	settings := settingsOf(cfg)
+	errs := make([]error, 0)
+
+	for _, s := range settings {
+		raw, source := s.def, SourceDefault
+		if value, ok := file[s.key]; ok {
+			raw, source = value, SourceFile
+			delete(file, s.key)
+		}
+		if value, err := env.GetEnvVar(s.env); err == nil {
+			raw, source = value, SourceEnv
+		}
+
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name(), err))
+			continue
+		}
+		cfg.sources[s.key] = source
+	}
+
+	unknown := make([]string, 0, len(file))
+	for key := range file {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s: unknown setting in %s", key, path))
+	}
+
+	if len(errs) == 0 {
+		errs = validate(cfg, settings)
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// readFile reads a YAML or TOML file, by extension, into file keys and raw
+// values.
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("%s: configuration files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	return values, flatten(tree, "", values)
+}
+
+func flatten(tree map[string]interface{}, prefix string, values map[string]string) error {
+	for key, value := range tree {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(value, prefix+key+".", values); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("%s%s: lists are not supported", prefix, key)
+		case nil:
+			values[prefix+key] = ""
+		default:
+			values[prefix+key] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// messages describe the broken validation rules, %s is the rule parameter.
+var messages = map[string]string{
+	"required": "is required",
+	"url":      "must be a URL",
+	"oneof":    "must be one of %s",
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"gt":       "must be greater than %s",
+	"gte":      "must not be negative",
+	"iso4217":  "must be an ISO 4217 currency code",
+}
+
+func validate(cfg *Config, settings []setting) []error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("key")
+	})
+
+	var violations validator.ValidationErrors
+	if !errors.As(validate.Struct(cfg), &violations) {
+		return nil
+	}
+
+	names := make(map[string]string, len(settings))
+	for _, s := range settings {
+		names[s.key] = s.name()
+	}
+
+	errs := make([]error, 0, len(violations))
+	for _, violation := range violations {
+		// the namespace starts with the struct name
+		key := strings.SplitN(violation.Namespace(), ".", 2)[1]
+
+		message, ok := messages[violation.Tag()]
+		if !ok {
+			message = "breaks the %s rule"
+			errs = append(errs, fmt.Errorf("%s: "+message, names[key], violation.Tag()))
+			continue
+		}
+		if strings.Contains(message, "%s") {
+			message = fmt.Sprintf(message, violation.Param())
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", names[key], message))
+	}
+	return errs
+}
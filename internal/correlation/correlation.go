@@ -0,0 +1,42 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+)
+
+// Header carries the id that ties together all logs and messages caused by one request.
+const Header = "X-Correlation-Id"
+
+type contextKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the correlation id of the request ctx belongs to, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+// Transport forwards the correlation id of the request context to the called service.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request they were given
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.next.RoundTrip(req)
+}
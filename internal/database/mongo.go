@@ -2,34 +2,56 @@ package database
 
 import (
 	"context"
-	"github.com/mycandys/orders/internal/env"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"time"
 )
 
-var Db *mongo.Database
-
-func Connect() *mongo.Client {
-	uri, err := env.GetEnvVar(env.DATABASE_URL)
-	if err != nil {
-		panic(err)
-	}
+// ErrNoTransactions is returned by Connect when the deployment is a standalone
+// server, orders are written in transactions which need a replica set.
+var ErrNoTransactions = errors.New("database: the deployment does not support transactions, start MongoDB as a replica set (see docker-compose.yml)")
 
+// Connect connects to the deployment at uri and returns the database name.
+// Deployments that cannot run transactions are rejected with ErrNoTransactions.
+func Connect(uri string, name string) (*mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		panic(err)
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+
+	if err := supportsTransactions(ctx, client); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
 	}
 
-	Db = client.Database(env.DATABASE_NAME)
-	return client
+	return client.Database(name), nil
+}
+
+// supportsTransactions asks the server it is connected to whether it is a
+// replica set member or a mongos.
+func supportsTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrNoTransactions
+	}
+	return nil
 }
 
 func Disconnect(client *mongo.Client, ctx context.Context) {
@@ -37,3 +59,11 @@ func Disconnect(client *mongo.Client, ctx context.Context) {
 		panic(err)
 	}
 }
+
+// Ping returns a check that the primary of the deployment db belongs to is
+// reachable.
+func Ping(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.Client().Ping(ctx, readpref.Primary())
+	}
+}
@@ -1,15 +1,66 @@
 package env
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
-func GetEnvVar(key string) (string, error) {
+// ErrNotSet is returned for variables that are unset or empty.
+var ErrNotSet = errors.New("not set")
 
+func GetEnvVar(key string) (string, error) {
 	value := os.Getenv(key)
 	if len(value) == 0 {
-		return "", nil
+		return "", fmt.Errorf("%s is %w", key, ErrNotSet)
 	}
 
 	return value, nil
 }
+
+func GetStringEnvVar(key string, fallback string) string {
+	value, _ := GetEnvVar(key)
+	if len(value) == 0 {
+		return fallback
+	}
+
+	return value
+}
+
+func GetIntEnvVar(key string, fallback int) (int, error) {
+	value, _ := GetEnvVar(key)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func GetFloatEnvVar(key string, fallback float64) (float64, error) {
+	value, _ := GetEnvVar(key)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+func GetDurationEnvVar(key string, fallback time.Duration) (time.Duration, error) {
+	value, _ := GetEnvVar(key)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+func GetBoolEnvVar(key string, fallback bool) (bool, error) {
+	value, _ := GetEnvVar(key)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	return strconv.ParseBool(value)
+}
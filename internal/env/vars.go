@@ -1,15 +1,7 @@
 package env
 
 const (
-	PORT                      = "PORT"
-	DATABASE_URL              = "DATABASE_URL"
-	DATABASE_NAME             = "DATABASE_NAME"
-	CART_SERVICE_URL          = "CART_SERVICE_URL"
-	NOTIFICATIONS_SERVICE_URL = "NOTIFICATIONS_SERVICE_URL"
-	AUTH_SERVICE_URL          = "AUTH_SERVICE_URL"
-	ANALYTICS_SERVICE_URL     = "ANALYTICS_SERVICE_URL"
-	SWAGGER_URI               = "SWAGGER_URI"
-	RABBITMQ_URL              = "RABBITMQ_URL"
-	EXCHANGE_NAME             = "EXCHANGE_NAME"
-	QUEUE_NAME                = "QUEUE_NAME"
+	// CONFIG_FILE is the optional YAML or TOML configuration file. The other
+	// variables are declared by the env tags of config.Config.
+	CONFIG_FILE = "CONFIG_FILE"
 )
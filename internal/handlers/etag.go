@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	"strings"
+)
+
+// etag is the strong entity tag of the order's current version.
+func etag(order *models.Order) string {
+	return fmt.Sprintf(`"%d"`, order.Version)
+}
+
+// matchesETag reports whether the If-Match header value matches the order.
+// Weak tags never match, If-Match uses the strong comparison.
+func matchesETag(ifMatch string, order *models.Order) bool {
+	current := etag(order)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch rejects the request unless it has no If-Match header or the
+// header matches the order.
+func checkIfMatch(c *gin.Context, order *models.Order) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch != "" && !matchesETag(ifMatch, order) {
+		_ = c.Error(repository.ErrVersionMismatch)
+		return false
+	}
+	return true
+}
@@ -2,25 +2,50 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/health"
 	"net/http"
 	"time"
 )
 
-// HealthCheck godoc
-// @Summary health check
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler reports the results of the dependency checks registered on
+// checker.
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Live godoc
+// @Summary liveness check
 // @Schemes
-// @Description do health check
+// @Description reports that the process is running, it does not check any dependency
 // @Success 200
-// @Router /health [get]
+// @Router /health/live [get]
 // @Tags health
-func HealthCheck(g *gin.Context) {
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    health.StatusUp,
+		"timestamp": time.Now().Format(time.DateTime),
+	})
+}
 
-	timestamp := time.Now().Format(time.DateTime)
+// Ready godoc
+// @Summary readiness check
+// @Schemes
+// @Description checks MongoDB, RabbitMQ, the circuit breakers and optionally the downstream services, results are cached briefly
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /health/ready [get]
+// @Tags health
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.checker.Report(c.Request.Context())
 
-	health := map[string]string{
-		"status":    "ok",
-		"timestamp": timestamp,
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
 	}
 
-	g.JSON(http.StatusOK, health)
+	c.JSON(status, report)
 }
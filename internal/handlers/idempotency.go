@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/middlewares"
+	"io"
+	"log"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed for a retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// defaultReplayContentType is replayed for responses stored without their content type.
+	defaultReplayContentType = "application/json; charset=utf-8"
+)
+
+// responseRecorder keeps a copy of the response body written by a handler.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// idempotent runs handle at most once per Idempotency-Key and caller. Retries
+// with the same body get the stored response, retries with a different body
+// are rejected. Requests without the header are handled as usual.
+func (h *OrderHandler) idempotent(c *gin.Context, handle gin.HandlerFunc) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if key == "" || h.idempotency == nil {
+		handle(c)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		_ = c.Error(apperrors.Validation(fmt.Sprintf("%s must not be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		_ = c.Error(apperrors.Wrap(apperrors.KindValidation, "Could not read request body", err))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+	// keys are scoped per caller so nobody can replay somebody else's response
+	scopedKey := fmt.Sprintf("%s:%s", c.GetString("userId"), key)
+
+	existing, err := h.idempotency.Reserve(c.Request.Context(), scopedKey, requestHash)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if existing != nil {
+		switch {
+		case existing.RequestHash != requestHash:
+			_ = c.Error(apperrors.Unprocessable(fmt.Sprintf("%s was already used with a different request body", IdempotencyKeyHeader), nil))
+		case !existing.Completed():
+			_ = c.Error(apperrors.Conflict(fmt.Sprintf("A request with this %s is still being processed", IdempotencyKeyHeader), nil))
+		default:
+			contentType := existing.ResponseContentType
+			if contentType == "" {
+				contentType = defaultReplayContentType
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(existing.ResponseStatus, contentType, existing.ResponseBody)
+		}
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	handle(c)
+	// errors are rendered here instead of by ErrorHandler, so the problem details are recorded too
+	middlewares.RenderError(c)
+	c.Writer = recorder.ResponseWriter
+
+	// the response is already sent, store it even if the client went away
+	ctx := context.WithoutCancel(c.Request.Context())
+	status := recorder.Status()
+
+	// failures on our side may succeed when retried, so they are not remembered
+	if status >= 500 {
+		if err := h.idempotency.Release(ctx, scopedKey); err != nil {
+			log.Printf("Could not release idempotency key: %v", err)
+		}
+		return
+	}
+
+	contentType := recorder.Header().Get("Content-Type")
+	if err := h.idempotency.Complete(ctx, scopedKey, status, contentType, recorder.body.Bytes()); err != nil {
+		log.Printf("Could not store idempotent response: %v", err)
+	}
+}
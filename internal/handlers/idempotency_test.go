@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/mocks"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/pricing"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newIdempotentOrderHandler() *OrderHandler {
+	return &OrderHandler{
+		orders:      &mocks.OrderRepositoryMock{},
+		idempotency: &mocks.IdempotencyRepositoryMock{},
+		pricing: &pricing.Calculator{
+			Currency:     "EUR",
+			TaxRate:      10,
+			ShippingCost: models.NewMoney(500, "EUR"),
+			Tolerance:    1,
+		},
+	}
+}
+
+func idempotentOrderRequest(handler *OrderHandler, key string) *httptest.ResponseRecorder {
+	server := newServer()
+	server.POST("/orders", withIdentity("1", models.RoleCustomer), handler.CreateOrder)
+
+	payload, _ := json.Marshal(models.CreateOrderDTO{
+		Items:      []models.Item{{ID: "1", Name: "candy", Price: models.NewMoney(1000, "EUR"), Quantity: 1}},
+		Cost:       models.NewMoney(1600, "EUR"),
+		Address:    "address",
+		Country:    "DE",
+		City:       "city",
+		PostalCode: "10115",
+	})
+
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(payload))
+	req.Header.Set(IdempotencyKeyHeader, key)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestCreateOrderStoresIdempotentResponse(t *testing.T) {
+	handler := newIdempotentOrderHandler()
+	keys := handler.idempotency.(*mocks.IdempotencyRepositoryMock)
+
+	keys.On("Reserve", mock.Anything, "1:key", mock.Anything).Return(nil, nil)
+	keys.On("Complete", mock.Anything, "1:key", http.StatusCreated, "application/json; charset=utf-8", mock.Anything).Return(nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("InsertOne", mock.Anything, mock.AnythingOfType("*models.Order")).Return(
+		func(ctx context.Context, order *models.Order) *models.Order { return order }, nil)
+
+	rec := idempotentOrderRequest(handler, "key")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusCreated)
+	}
+
+	stored := keys.Calls[1].Arguments.Get(4).([]byte)
+	if !bytes.Equal(stored, rec.Body.Bytes()) {
+		t.Errorf("stored response %s differs from sent response %s", stored, rec.Body.String())
+	}
+}
+
+func TestCreateOrderReplaysIdempotentResponse(t *testing.T) {
+	handler := newIdempotentOrderHandler()
+
+	var hash string
+	handler.idempotency.(*mocks.IdempotencyRepositoryMock).On("Reserve", mock.Anything, "1:key", mock.Anything).Return(
+		func(ctx context.Context, key string, requestHash string) *repository.IdempotencyRecord {
+			hash = requestHash
+			completedAt := time.Now()
+			return &repository.IdempotencyRecord{
+				Key:            key,
+				RequestHash:    requestHash,
+				ResponseStatus: http.StatusCreated,
+				ResponseBody:   []byte(`{"id":"original"}`),
+				CompletedAt:    &completedAt,
+			}
+		}, nil)
+
+	rec := idempotentOrderRequest(handler, "key")
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"id":"original"}` {
+		t.Errorf("handler did not replay the response: got %v %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(IdempotentReplayedHeader) != "true" || hash == "" {
+		t.Errorf("replayed response is not marked as such")
+	}
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "InsertOne", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrderReplaysContentType(t *testing.T) {
+	cases := []struct {
+		name   string
+		stored string
+		want   string
+	}{
+		{"problem details", apperrors.ProblemContentType, apperrors.ProblemContentType},
+		{"stored without content type", "", "application/json; charset=utf-8"},
+	}
+
+	for _, tc := range cases {
+		handler := newIdempotentOrderHandler()
+		handler.idempotency.(*mocks.IdempotencyRepositoryMock).On("Reserve", mock.Anything, "1:key", mock.Anything).Return(
+			func(ctx context.Context, key string, requestHash string) *repository.IdempotencyRecord {
+				completedAt := time.Now()
+				return &repository.IdempotencyRecord{
+					Key:                 key,
+					RequestHash:         requestHash,
+					ResponseStatus:      http.StatusUnprocessableEntity,
+					ResponseContentType: tc.stored,
+					ResponseBody:        []byte(`{"type":"/problems/unprocessable"}`),
+					CompletedAt:         &completedAt,
+				}
+			}, nil)
+
+		rec := idempotentOrderRequest(handler, "key")
+
+		if rec.Code != http.StatusUnprocessableEntity || rec.Header().Get("Content-Type") != tc.want {
+			t.Errorf("%s: got %v with content type %q want %q", tc.name, rec.Code, rec.Header().Get("Content-Type"), tc.want)
+		}
+	}
+}
+
+func TestCreateOrderIdempotencyConflicts(t *testing.T) {
+	cases := []struct {
+		name   string
+		record func(requestHash string) *repository.IdempotencyRecord
+		want   int
+	}{
+		{
+			name: "different body",
+			record: func(requestHash string) *repository.IdempotencyRecord {
+				completedAt := time.Now()
+				return &repository.IdempotencyRecord{RequestHash: "other", ResponseStatus: 201, CompletedAt: &completedAt}
+			},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "still in progress",
+			record: func(requestHash string) *repository.IdempotencyRecord {
+				return &repository.IdempotencyRecord{RequestHash: requestHash}
+			},
+			want: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range cases {
+		handler := newIdempotentOrderHandler()
+		handler.idempotency.(*mocks.IdempotencyRepositoryMock).On("Reserve", mock.Anything, "1:key", mock.Anything).Return(
+			func(ctx context.Context, key string, requestHash string) *repository.IdempotencyRecord {
+				return tc.record(requestHash)
+			}, nil)
+
+		rec := idempotentOrderRequest(handler, "key")
+
+		if rec.Code != tc.want {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.name, rec.Code, tc.want)
+		}
+		handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "InsertOne", mock.Anything, mock.Anything)
+	}
+}
+
+func TestCreateOrderReleasesKeyOnFailure(t *testing.T) {
+	handler := newIdempotentOrderHandler()
+	keys := handler.idempotency.(*mocks.IdempotencyRepositoryMock)
+
+	keys.On("Reserve", mock.Anything, "1:key", mock.Anything).Return(nil, nil)
+	keys.On("Release", mock.Anything, "1:key").Return(nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("InsertOne", mock.Anything, mock.Anything).Return(nil, errors.New("write failed"))
+
+	rec := idempotentOrderRequest(handler, "key")
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusInternalServerError)
+	}
+	keys.AssertCalled(t, "Release", mock.Anything, "1:key")
+	keys.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -1,26 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
 	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/pricing"
 	"github.com/mycandys/orders/internal/repository"
-	"github.com/mycandys/orders/internal/services"
-	"go.mongodb.org/mongo-driver/bson"
-	"log"
-	"time"
 )
 
+var errInvalidStatus = apperrors.Validation("Invalid order status")
+
 type OrderHandler struct {
-	orders        repository.IOrderRepository[*models.Order, models.CreateOrderDTO, models.UpdateOrderDTO, bson.D]
-	notifications *services.NotificationService
-	carts         *services.CartService
+	orders      repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery]
+	pricing     *pricing.Calculator
+	idempotency repository.IIdempotencyRepository
 }
 
-func NewOrderHandler() *OrderHandler {
+func NewOrderHandler(
+	orders repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery],
+	pricing *pricing.Calculator,
+	idempotency repository.IIdempotencyRepository,
+) *OrderHandler {
 	return &OrderHandler{
-		orders:        repository.NewOrderRepository(),
-		notifications: services.NewNotificationService(),
-		carts:         services.NewCartService(),
+		orders:      orders,
+		pricing:     pricing,
+		idempotency: idempotency,
 	}
 }
 
@@ -28,19 +33,30 @@ func NewOrderHandler() *OrderHandler {
 // @Summary get order by id
 // @Tags orders
 // @Schemes
-// @Description get order by id
+// @Description get order by id, customers may only read their own orders. The ETag header holds the order version for If-Match.
+// @Security ApiKeyAuth
 // @Param id path string true "order id"
 // @Success 200
+// @Header 200 {string} ETag "order version"
+// @Failure 400 "invalid order id"
+// @Failure 404 "order not found"
+// @Failure 504 "database timeout"
 // @Router /orders/{id} [get]
 func (h *OrderHandler) GetOrder(c *gin.Context) {
 	id := c.Param("id")
 
-	o, err := h.orders.FindOne(id)
-	if err != nil || o == nil {
-		c.JSON(404, gin.H{"error": "Order not found"})
+	o, err := h.orders.FindOne(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	// other customers' orders do not exist as far as the caller is concerned
+	if o == nil || !canAccessOrder(c, o) {
+		_ = c.Error(repository.ErrOrderNotFound)
 		return
 	}
 
+	c.Header("ETag", etag(o))
 	c.JSON(200, o)
 }
 
@@ -48,101 +64,174 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 // @Summary get all orders
 // @Tags orders
 // @Schemes
-// @Description get all orders
-// @Success 200
+// @Description get all orders, staff only
+// @Security ApiKeyAuth
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "sort field" Enums(created_at, cost, status) default(created_at)
+// @Param order query string false "sort direction" Enums(asc, desc) default(desc)
+// @Param createdFrom query string false "created at or after, date or date time"
+// @Param createdTo query string false "created before, a date includes the whole day"
+// @Param minCost query int false "minimum total in minor units"
+// @Param maxCost query int false "maximum total in minor units"
+// @Success 200 {object} repository.Page[models.Order]
+// @Failure 504 "database timeout"
 // @Router /orders [get]
 func (h *OrderHandler) GetOrders(c *gin.Context) {
-	orders, err := h.orders.FindAll()
+	query, err := parseOrderQuery(c)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "No orders found"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, orders)
+	page, err := h.orders.FindAll(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respondPage(c, page)
 }
 
 // GetOrdersByUser Orders godoc
 // @Summary get all orders by user
 // @Tags orders
 // @Schemes
-// @Description get all orders by user
+// @Description get all orders by user, staff only
+// @Security ApiKeyAuth
 // @Param id path string true "user id"
-// @Success 200
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "sort field" Enums(created_at, cost, status) default(created_at)
+// @Param order query string false "sort direction" Enums(asc, desc) default(desc)
+// @Param createdFrom query string false "created at or after, date or date time"
+// @Param createdTo query string false "created before, a date includes the whole day"
+// @Param minCost query int false "minimum total in minor units"
+// @Param maxCost query int false "maximum total in minor units"
+// @Success 200 {object} repository.Page[models.Order]
+// @Failure 504 "database timeout"
 // @Router /orders/user/{id} [get]
 func (h *OrderHandler) GetOrdersByUser(c *gin.Context) {
 	id := c.Param("id")
 
-	orders, err := h.orders.FindByUser(id)
+	query, err := parseOrderQuery(c)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "No orders found"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, orders)
+	page, err := h.orders.FindByUser(c.Request.Context(), id, query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respondPage(c, page)
 }
 
 // GetOrderByStatus Orders godoc
 // @Summary get all orders by status
 // @Tags orders
 // @Schemes
-// @Description get all orders by status
+// @Description get all orders by status, staff only
+// @Security ApiKeyAuth
 // @Param status path string true "order status"
-// @Success 200
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "sort field" Enums(created_at, cost, status) default(created_at)
+// @Param order query string false "sort direction" Enums(asc, desc) default(desc)
+// @Param createdFrom query string false "created at or after, date or date time"
+// @Param createdTo query string false "created before, a date includes the whole day"
+// @Param minCost query int false "minimum total in minor units"
+// @Param maxCost query int false "maximum total in minor units"
+// @Success 200 {object} repository.Page[models.Order]
+// @Failure 504 "database timeout"
 // @Router /orders/status/{status} [get]
 func (h *OrderHandler) GetOrderByStatus(c *gin.Context) {
 	status := c.Param("status")
 
-	isValid := models.IsOrderStatusValid(status)
-	if !isValid {
-		c.JSON(400, gin.H{"error": "Invalid order status"})
+	if !models.IsOrderStatusValid(status) {
+		_ = c.Error(errInvalidStatus)
 		return
 	}
 
-	orders, err := h.orders.FindByStatus(models.OrderStatus(status))
+	query, err := parseOrderQuery(c)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "No orders found"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, orders)
+	page, err := h.orders.FindByStatus(c.Request.Context(), models.OrderStatus(status), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respondPage(c, page)
 }
 
 // CreateOrder Order godoc
 // @Summary create order
 // @Tags orders
 // @Schemes
-// @Description create order
+// @Description create order, retries with the same Idempotency-Key replay the original response
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param order body models.CreateOrderDTO true "order"
+// @Param Idempotency-Key header string false "unique key of this order, reused when retrying"
 // @Success 201
+// @Failure 400 "validation failed"
+// @Failure 409 "a request with the same idempotency key is still being processed"
+// @Failure 422 "submitted cost does not match the calculated price or idempotency key reused with a different body"
+// @Failure 502 "the cart service failed"
+// @Failure 504 "database timeout"
 // @Router /orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	var dto models.CreateOrderDTO
+	h.idempotent(c, h.createOrder)
+}
 
-	if err := c.ShouldBindJSON(&dto); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+func (h *OrderHandler) createOrder(c *gin.Context) {
+	var dto models.CreateOrderDTO
+	if !decodeJSON(c, &dto) {
 		return
 	}
 
-	order, err := h.orders.InsertOne(dto)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Cloud not create order"})
+	// only staff may place orders on behalf of other users, everybody else orders for themselves
+	if dto.UserId == "" || !models.HasRole(callerRoles(c), models.RoleStaff) {
+		dto.UserId = c.GetString("userId")
+	}
+
+	if !validate(c, &dto) {
 		return
 	}
 
-	if h.carts != nil {
-		err = h.carts.ClearCart(dto.CartID)
-		if err != nil {
-			log.Print(err.Error())
-		}
+	quote, err := h.pricing.Quote(dto.Items)
+	if err == nil {
+		err = h.pricing.Verify(dto.Cost, quote)
 	}
 
-	if h.notifications != nil {
-		err = h.notifications.SendEmail(services.NewOrderCreatedEmail(order.UserID, order.ID.String()))
-		if err != nil {
-			log.Print(err.Error())
-		}
+	var currencyErr *models.CurrencyMismatchError
+	var mismatchErr *pricing.MismatchError
+	switch {
+	case errors.As(err, &currencyErr):
+		_ = c.Error(apperrors.Unprocessable(err.Error(), err).With("reason", models.CurrencyMismatchReason))
+		return
+	// only a computed quote that differs is a cost mismatch, other pricing failures are ours
+	case errors.As(err, &mismatchErr):
+		_ = c.Error(apperrors.Unprocessable(err.Error(), err).
+			With("reason", pricing.CostMismatchReason).
+			With("price", quote))
+		return
+	case err != nil:
+		_ = c.Error(err)
+		return
+	}
+
+	order, err := h.orders.InsertOne(c.Request.Context(), models.NewOrder(dto, quote))
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
 
 	c.JSON(201, order)
@@ -152,67 +241,270 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 // @Summary update order
 // @Tags orders
 // @Schemes
-// @Description update order
+// @Description update order, staff only. With If-Match the order is only updated while its ETag still matches.
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "order id"
+// @Param If-Match header string false "ETag of the order as last read"
 // @Param order body models.UpdateOrderDTO true "order"
 // @Success 200
+// @Header 200 {string} ETag "order version"
+// @Failure 400 "invalid order id or payload"
+// @Failure 404 "order not found"
+// @Failure 409 "illegal status transition"
+// @Failure 412 "the order was changed since the If-Match ETag was read"
+// @Failure 504 "database timeout"
 // @Router /orders/{id} [put]
 func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	id := c.Param("id")
 
 	var dto models.UpdateOrderDTO
 	if err := c.ShouldBindJSON(&dto); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		_ = c.Error(invalidRequest(err))
 		return
 	}
 
-	if dto.DeliveredAt != nil {
-		_, err := time.Parse(time.DateTime, *dto.DeliveredAt)
+	var current *models.Order
+	if dto.Status != nil || c.GetHeader("If-Match") != "" {
+		var err error
+		current, err = h.orders.FindOne(c.Request.Context(), id)
 		if err != nil {
-			c.JSON(400, gin.H{"error": "Invalid date time format"})
+			_ = c.Error(err)
+			return
+		}
+		if current == nil {
+			_ = c.Error(repository.ErrOrderNotFound)
+			return
+		}
+		if !checkIfMatch(c, current) {
 			return
 		}
 	}
 
-	if *dto.Status == models.OrderStatusDelivered && dto.DeliveredAt == nil {
-		dto.DeliveredAt = new(string)
-		*dto.DeliveredAt = time.Now().Format(time.DateTime)
+	if dto.Status != nil {
+		if err := models.ValidateStatusTransition(current.Status, *dto.Status); err != nil {
+			_ = c.Error(err.(*models.StatusTransitionError).Conflict())
+			return
+		}
 	}
 
-	order, err := h.orders.UpdateOne(id, dto)
+	h.writeOrder(c, id, current, dto)
+}
+
+// PatchOrder Order godoc
+// @Summary patch order
+// @Tags orders
+// @Schemes
+// @Description change some fields of an order with a JSON Merge Patch, members missing from the patch keep their value and notes are removed with null. Customers may only patch the shipping address and notes of their own orders, staff may also patch the status and expected delivery date. The shipping address can only change while the order is pending. With If-Match the order is only updated while its ETag still matches.
+// @Security ApiKeyAuth
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "order id"
+// @Param If-Match header string false "ETag of the order as last read"
+// @Param order body models.OrderPatch true "merge patch"
+// @Success 200
+// @Header 200 {string} ETag "order version"
+// @Failure 400 "invalid order id or patch"
+// @Failure 403 "the patch contains fields only staff may change"
+// @Failure 404 "order not found"
+// @Failure 409 "illegal status transition or the address cannot change anymore"
+// @Failure 412 "the order was changed since the If-Match ETag was read"
+// @Failure 415 "the body is no application/merge-patch+json"
+// @Failure 504 "database timeout"
+// @Router /orders/{id} [patch]
+func (h *OrderHandler) PatchOrder(c *gin.Context) {
+	id := c.Param("id")
+
+	var patch models.OrderPatch
+	if !decodeMergePatch(c, &patch) || !validate(c, &patch) {
+		return
+	}
+
+	current, err := h.orders.FindOne(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Cloud not update order"})
+		_ = c.Error(err)
+		return
+	}
+	// other customers' orders do not exist as far as the caller is concerned
+	if current == nil || !canAccessOrder(c, current) {
+		_ = c.Error(repository.ErrOrderNotFound)
+		return
+	}
+	if !checkIfMatch(c, current) {
 		return
 	}
 
-	if h.notifications != nil {
-		err = h.notifications.SendEmail(
-			services.NewOrderStatusUpdatedEmail(
-				order.UserID, order.ID.String(), order.Status))
-		if err != nil {
-			log.Print(err.Error())
+	if members := staffOnlyMembers(patch); len(members) > 0 && !models.HasRole(callerRoles(c), models.RoleStaff) {
+		_ = c.Error(errStaffOnlyMembers.With("fields", members))
+		return
+	}
+
+	if patch.Status != nil {
+		if err := models.ValidateStatusTransition(current.Status, *patch.Status); err != nil {
+			_ = c.Error(err.(*models.StatusTransitionError).Conflict())
+			return
 		}
 	}
 
+	dto := patch.Update()
+	if dto.ChangesAddress() {
+		if err := models.ValidateAddressChange(current.Status); err != nil {
+			_ = c.Error(err.(*models.AddressNotEditableError).Conflict())
+			return
+		}
+		// the postal code is checked against the country even if only one of them changes
+		address := current.ShippingAddress().Apply(patch)
+		if !validate(c, &address) {
+			return
+		}
+	}
+
+	h.writeOrder(c, id, current, dto)
+}
+
+// writeOrder stores the update and answers with the updated order. With
+// If-Match the write only succeeds while current, which the header was checked
+// against, is still the latest version.
+func (h *OrderHandler) writeOrder(c *gin.Context, id string, current *models.Order, dto models.UpdateOrderDTO) {
+	if dto.Status != nil && *dto.Status == models.OrderStatusDelivered && dto.DeliveredAt == nil {
+		dto.DeliveredAt = new(string)
+		*dto.DeliveredAt = models.Timestamp()
+	}
+
+	var order *models.Order
+	var err error
+	if c.GetHeader("If-Match") != "" {
+		order, err = h.orders.CompareAndSwap(c.Request.Context(), id, current.Version, dto)
+	} else {
+		order, err = h.orders.UpdateOne(c.Request.Context(), id, dto)
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag(order))
 	c.JSON(200, order)
 }
 
+func callerRoles(c *gin.Context) []models.Role {
+	roles, _ := c.Value("roles").([]models.Role)
+	return roles
+}
+
+// canAccessOrder reports whether the authenticated caller owns the order or is staff.
+func canAccessOrder(c *gin.Context, order *models.Order) bool {
+	return canAccessUser(c, order.UserID)
+}
+
+// canAccessUser reports whether the caller may see data owned by userId.
+func canAccessUser(c *gin.Context, userId string) bool {
+	if models.HasRole(callerRoles(c), models.RoleStaff) {
+		return true
+	}
+	caller := c.GetString("userId")
+	return caller != "" && caller == userId
+}
+
+// CancelMyOrder Order godoc
+// @Summary cancel own order
+// @Tags orders
+// @Schemes
+// @Description cancel one of the caller's orders while it is pending or paid
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "order id"
+// @Param cancellation body models.CancelOrderDTO true "cancellation"
+// @Success 200 {object} models.Order
+// @Failure 400 "invalid order id or payload"
+// @Failure 404 "order not found"
+// @Failure 409 "order can no longer be cancelled"
+// @Failure 504 "database timeout"
+// @Router /orders/me/{id}/cancel [post]
+func (h *OrderHandler) CancelMyOrder(c *gin.Context) {
+	h.cancel(c, true)
+}
+
+// CancelOrder Order godoc
+// @Summary cancel order
+// @Tags orders
+// @Schemes
+// @Description cancel any order while it is pending or paid, admin only
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "order id"
+// @Param cancellation body models.CancelOrderDTO true "cancellation"
+// @Success 200 {object} models.Order
+// @Failure 400 "invalid order id or payload"
+// @Failure 404 "order not found"
+// @Failure 409 "order can no longer be cancelled"
+// @Failure 504 "database timeout"
+// @Router /orders/{id}/cancel [post]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	h.cancel(c, false)
+}
+
+// cancel cancels the order in the path, own restricts it to orders of the caller.
+func (h *OrderHandler) cancel(c *gin.Context, own bool) {
+	id := c.Param("id")
+	userId := c.GetString("userId")
+
+	var dto models.CancelOrderDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return
+	}
+
+	o, err := h.orders.FindOne(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if o == nil || (own && o.UserID != userId) {
+		_ = c.Error(repository.ErrOrderNotFound)
+		return
+	}
+
+	// checked here for a quick answer, the repository checks again atomically
+	if err := models.ValidateCancellation(o.Status); err != nil {
+		_ = c.Error(err.(*models.NotCancellableError).Conflict())
+		return
+	}
+
+	cancelled, err := h.orders.Cancel(c.Request.Context(), id, models.NewCancellation(dto.Reason, userId))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(200, cancelled)
+}
+
 // DeleteOrder Order godoc
 // @Summary delete order
 // @Tags orders
 // @Schemes
-// @Description delete order
+// @Description delete order, admin only
+// @Security ApiKeyAuth
 // @Param id path string true "order id"
 // @Success 200
+// @Failure 400 "invalid order id"
+// @Failure 404 "order not found"
+// @Failure 504 "database timeout"
 // @Router /orders/{id} [delete]
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	id := c.Param("id")
 
-	order, err := h.orders.DeleteOne(id)
+	order, err := h.orders.DeleteOne(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Cloud not delete order"})
+		_ = c.Error(err)
+		return
+	}
+	if order == nil {
+		_ = c.Error(repository.ErrOrderNotFound)
 		return
 	}
 
@@ -225,18 +517,33 @@ func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 // @Schemes
 // @Description get all orders by user
 // @Security ApiKeyAuth
-// @Success 200
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "sort field" Enums(created_at, cost, status) default(created_at)
+// @Param order query string false "sort direction" Enums(asc, desc) default(desc)
+// @Param createdFrom query string false "created at or after, date or date time"
+// @Param createdTo query string false "created before, a date includes the whole day"
+// @Param minCost query int false "minimum total in minor units"
+// @Param maxCost query int false "maximum total in minor units"
+// @Success 200 {object} repository.Page[models.Order]
+// @Failure 504 "database timeout"
 // @Router /orders/me [get]
 func (h *OrderHandler) GetMyOrders(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 
-	orders, err := h.orders.FindByUser(userId)
+	query, err := parseOrderQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	page, err := h.orders.FindByUser(c.Request.Context(), userId, query)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "No orders found"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, orders)
+	respondPage(c, page)
 }
 
 // GetMyOrdersByStatus Orders godoc
@@ -246,38 +553,54 @@ func (h *OrderHandler) GetMyOrders(c *gin.Context) {
 // @Description get all orders by status
 // @Security ApiKeyAuth
 // @Param status path string true "order status"
-// @Success 200
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "sort field" Enums(created_at, cost, status) default(created_at)
+// @Param order query string false "sort direction" Enums(asc, desc) default(desc)
+// @Param createdFrom query string false "created at or after, date or date time"
+// @Param createdTo query string false "created before, a date includes the whole day"
+// @Param minCost query int false "minimum total in minor units"
+// @Param maxCost query int false "maximum total in minor units"
+// @Success 200 {object} repository.Page[models.Order]
+// @Failure 504 "database timeout"
 // @Router /orders/me/status/{status} [get]
 func (h *OrderHandler) GetMyOrdersByStatus(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 	status := c.Param("status")
 
-	isValid := models.IsOrderStatusValid(status)
-	if !isValid {
-		c.JSON(400, gin.H{"error": "Invalid order status"})
+	if !models.IsOrderStatusValid(status) {
+		_ = c.Error(errInvalidStatus)
 		return
 	}
 
-	orders, err := h.orders.FindByUserAndStatus(userId, models.OrderStatus(status))
+	query, err := parseOrderQuery(c)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "No orders found"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, orders)
+	page, err := h.orders.FindByUserAndStatus(c.Request.Context(), userId, models.OrderStatus(status), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respondPage(c, page)
 }
 
 // DeleteAllOrders Orders godoc
 // @Summary delete all orders
 // @Tags orders
 // @Schemes
-// @Description delete all orders
+// @Description delete all orders, admin only
+// @Security ApiKeyAuth
 // @Success 200
+// @Failure 504 "database timeout"
 // @Router /orders [delete]
 func (h *OrderHandler) DeleteAllOrders(c *gin.Context) {
-	err := h.orders.DeleteAll()
+	err := h.orders.DeleteAll(c.Request.Context())
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Cloud not delete orders"})
+		_ = c.Error(err)
 		return
 	}
 
@@ -291,13 +614,14 @@ func (h *OrderHandler) DeleteAllOrders(c *gin.Context) {
 // @Description delete all orders by user
 // @Security ApiKeyAuth
 // @Success 200
+// @Failure 504 "database timeout"
 // @Router /orders/me [delete]
 func (h *OrderHandler) DeleteAllMyOrders(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 
-	err := h.orders.DeleteAllByUser(userId)
+	err := h.orders.DeleteAllByUser(c.Request.Context(), userId)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Cloud not delete orders"})
+		_ = c.Error(err)
 		return
 	}
 
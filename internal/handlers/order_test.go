@@ -2,31 +2,53 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
 	"github.com/mycandys/orders/internal/middlewares"
 	"github.com/mycandys/orders/internal/mocks"
 	_ "github.com/mycandys/orders/internal/mocks"
 	"github.com/mycandys/orders/internal/models"
 	_ "github.com/mycandys/orders/internal/models"
-	_ "github.com/mycandys/orders/internal/repository"
+	"github.com/mycandys/orders/internal/pricing"
+	"github.com/mycandys/orders/internal/repository"
 	"github.com/mycandys/orders/internal/services"
+	"github.com/mycandys/orders/internal/validation"
+	"github.com/stretchr/testify/mock"
 	_ "go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
-func TestGetOrdersEmptyList(t *testing.T) {
+// newServer returns an engine that renders handler errors like the router does.
+func newServer() *gin.Engine {
 	server := gin.Default()
+	server.Use(middlewares.ErrorHandler())
+	return server
+}
+
+// withIdentity stands in for the Auth middleware in handler tests.
+func withIdentity(userId string, roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userId", userId)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
+
+func TestGetOrdersEmptyList(t *testing.T) {
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll").Return([]*models.Order{}, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{Items: []*models.Order{}}, nil)
 
 	server.GET("/orders", handler.GetOrders)
 
@@ -40,13 +62,13 @@ func TestGetOrdersEmptyList(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if rec.Body.String() != "[]" {
-		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
+	if rec.Body.String() != `{"items":[],"total":0}` {
+		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), `{"items":[],"total":0}`)
 	}
 }
 
 func TestGetOrders(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -56,20 +78,21 @@ func TestGetOrders(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll").Return([]*models.Order{
-		order,
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{
+		Items: []*models.Order{order},
+		Total: 1,
 	}, nil)
 
 	server.GET("/orders", handler.GetOrders)
@@ -84,20 +107,145 @@ func TestGetOrders(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 1 {
+	if len(body.Items) != 1 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 
-	if body[0].ID != order.ID {
+	if body.Items[0].ID != order.ID {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
+func TestGetOrdersWithQuery(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	minCost := int64(1000)
+	from := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 11, 0, 0, 0, 0, time.UTC)
+
+	expected := repository.OrderQuery{
+		Limit:       5,
+		Cursor:      "abc",
+		SortBy:      repository.SortByCost,
+		Descending:  false,
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+		MinCost:     &minCost,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, expected).Return(&repository.Page[*models.Order]{
+		Items:      []*models.Order{},
+		NextCursor: "next",
+		Total:      7,
+	}, nil)
+
+	server.GET("/orders", handler.GetOrders)
+
+	req, _ := http.NewRequest("GET", "/orders?limit=5&cursor=abc&sort=cost&order=asc&createdFrom=2023-12-01&createdTo=2023-12-10&minCost=1000", nil)
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var body repository.Page[models.Order]
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body.NextCursor != "next" || body.Total != 7 {
+		t.Errorf("handler returned unexpected body: got %v", rec.Body.String())
+	}
+}
+
+func TestGetOrdersWithOffsetDates(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	from := time.Date(2023, 11, 30, 23, 30, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 10, 12, 0, 0, 0, time.UTC)
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, mock.MatchedBy(func(query repository.OrderQuery) bool {
+		return query.CreatedFrom.Equal(from) && query.CreatedFrom.Location() == time.UTC &&
+			query.CreatedTo.Equal(to) && query.CreatedTo.Location() == time.UTC
+	})).Return(&repository.Page[*models.Order]{}, nil)
+
+	server.GET("/orders", handler.GetOrders)
+
+	req, _ := http.NewRequest("GET", "/orders?createdFrom=2023-12-01T01:30:00%2B02:00&createdTo=2023-12-10T07:00:00-05:00", nil)
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func TestGetOrdersInvalidQuery(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, mock.Anything).Return(nil, repository.ErrInvalidCursor)
+
+	server.GET("/orders", handler.GetOrders)
+
+	for _, url := range []string{"/orders?sort=name", "/orders?limit=1000", "/orders?order=up", "/orders?minCost=5&maxCost=1", "/orders?cursor=bad"} {
+		req, _ := http.NewRequest("GET", url, nil)
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", url, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRepositoryTimeout(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindAll", mock.Anything, mock.Anything).Return(nil, repository.ErrTimeout)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, "1").Return(nil, repository.ErrTimeout)
+
+	server.GET("/orders", handler.GetOrders)
+	server.GET("/orders/:id", handler.GetOrder)
+
+	for _, url := range []string{"/orders", "/orders/1"} {
+		req, _ := http.NewRequest("GET", url, nil)
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusGatewayTimeout {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", url, status, http.StatusGatewayTimeout)
+		}
+	}
+}
+
 func TestGetOrderByID(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -107,21 +255,22 @@ func TestGetOrderByID(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
+		Version:              3,
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
 
-	server.GET("/orders/:id", handler.GetOrder)
+	server.GET("/orders/:id", withIdentity("1", models.RoleCustomer), handler.GetOrder)
 
 	req, _ := http.NewRequest("GET", "/orders/"+order.ID.Hex(), nil)
 
@@ -139,16 +288,20 @@ func TestGetOrderByID(t *testing.T) {
 	if body.ID != order.ID {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
+
+	if etag := rec.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("handler returned wrong ETag: got %v want %v", etag, `"3"`)
+	}
 }
 
 func TestGetOrderByIDNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", "1").Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, "1").Return(nil, nil)
 
 	server.GET("/orders/:id", handler.GetOrder)
 
@@ -163,28 +316,79 @@ func TestGetOrderByIDNotFound(t *testing.T) {
 	}
 }
 
+func TestGetOrderRepositoryErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		kind   apperrors.Kind
+	}{
+		{"invalid id", apperrors.InvalidID("1"), http.StatusBadRequest, apperrors.KindInvalidID},
+		{"not found", repository.ErrOrderNotFound, http.StatusNotFound, apperrors.KindNotFound},
+		{"timeout", repository.ErrTimeout, http.StatusGatewayTimeout, apperrors.KindTimeout},
+		{"unexpected", errors.New("connection reset"), http.StatusInternalServerError, apperrors.KindInternal},
+	}
+
+	for _, tc := range cases {
+		server := newServer()
+
+		handler := &OrderHandler{
+			orders: &mocks.OrderRepositoryMock{},
+		}
+
+		handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, "1").Return(nil, tc.err)
+
+		server.GET("/orders/:id", handler.GetOrder)
+
+		req, _ := http.NewRequest("GET", "/orders/1", nil)
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != tc.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.name, status, tc.status)
+		}
+
+		var problem map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &problem)
+
+		if problem["type"] != "/problems/"+string(tc.kind) {
+			t.Errorf("%s: handler returned unexpected problem: %v", tc.name, rec.Body.String())
+		}
+	}
+}
+
 func TestCreateOrder(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
-		orders:        &mocks.OrderRepositoryMock{},
-		notifications: nil,
-		carts:         nil,
+		orders: &mocks.OrderRepositoryMock{},
+		pricing: &pricing.Calculator{
+			Currency:     "EUR",
+			TaxRate:      10,
+			ShippingCost: models.NewMoney(500, "EUR"),
+			Tolerance:    1,
+		},
 	}
 
 	dto := models.CreateOrderDTO{
-		UserId:     "1",
-		Items:      make([]models.Item, 0),
-		Cost:       100.0,
+		UserId: "1",
+		Items: []models.Item{
+			{ID: "1", Name: "candy", Price: models.NewMoney(250, "EUR"), Quantity: 4},
+			{ID: "2", Name: "chocolate", Price: models.NewMoney(4000, "EUR"), Quantity: 2},
+		},
+		Cost:       models.NewMoney(10400, "EUR"),
 		Address:    "address",
-		Country:    "country",
+		Country:    "DE",
 		City:       "city",
-		PostalCode: "postalCode",
+		PostalCode: "10115",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("InsertOne", dto).Return(models.NewOrder(dto), nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("InsertOne", mock.Anything, mock.AnythingOfType("*models.Order")).Return(
+		func(ctx context.Context, order *models.Order) *models.Order { return order }, nil)
 
-	server.POST("/orders", handler.CreateOrder)
+	server.POST("/orders", withIdentity("1", models.RoleCustomer), handler.CreateOrder)
 
 	payload, _ := json.Marshal(dto)
 
@@ -204,10 +408,101 @@ func TestCreateOrder(t *testing.T) {
 	if body.UserID != dto.UserId {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
+
+	expected := models.PriceBreakdown{
+		Subtotal: models.NewMoney(9000, "EUR"),
+		Tax:      models.NewMoney(900, "EUR"),
+		Shipping: models.NewMoney(500, "EUR"),
+		Discount: models.NewMoney(0, "EUR"),
+		Total:    models.NewMoney(10400, "EUR"),
+	}
+	if body.Price != expected {
+		t.Errorf("handler returned unexpected price: got %v want %v", body.Price, expected)
+	}
+}
+
+func TestCreateOrderCostMismatch(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders:  &mocks.OrderRepositoryMock{},
+		pricing: &pricing.Calculator{Currency: "EUR", Tolerance: 1},
+	}
+
+	dto := models.CreateOrderDTO{
+		UserId: "1",
+		Items: []models.Item{
+			{ID: "1", Name: "candy", Price: models.NewMoney(250, "EUR"), Quantity: 40},
+		},
+		Cost:       models.NewMoney(1, "EUR"),
+		Address:    "address",
+		Country:    "DE",
+		City:       "city",
+		PostalCode: "10115",
+	}
+
+	server.POST("/orders", withIdentity("1", models.RoleCustomer), handler.CreateOrder)
+
+	payload, _ := json.Marshal(dto)
+
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(payload))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "InsertOne", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrderMixedCurrencies(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders:  &mocks.OrderRepositoryMock{},
+		pricing: &pricing.Calculator{Currency: "EUR", Tolerance: 1},
+	}
+
+	dto := models.CreateOrderDTO{
+		UserId: "1",
+		Items: []models.Item{
+			{ID: "1", Name: "candy", Price: models.NewMoney(250, "EUR"), Quantity: 1},
+			{ID: "2", Name: "candy", Price: models.NewMoney(250, "USD"), Quantity: 1},
+		},
+		Cost:       models.NewMoney(500, "EUR"),
+		Address:    "address",
+		Country:    "DE",
+		City:       "city",
+		PostalCode: "10115",
+	}
+
+	server.POST("/orders", withIdentity("1", models.RoleCustomer), handler.CreateOrder)
+
+	payload, _ := json.Marshal(dto)
+
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(payload))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	var body map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body["reason"] != models.CurrencyMismatchReason {
+		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), models.CurrencyMismatchReason)
+	}
 }
 
 func TestCreateOrderInvalidPayload(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -227,12 +522,10 @@ func TestCreateOrderInvalidPayload(t *testing.T) {
 }
 
 func TestUpdateOrder(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
-		orders:        &mocks.OrderRepositoryMock{},
-		notifications: nil,
-		carts:         nil,
+		orders: &mocks.OrderRepositoryMock{},
 	}
 
 	status := models.OrderStatusShipped
@@ -245,20 +538,20 @@ func TestUpdateOrder(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", order.ID.Hex()).Return(order, nil)
-	handler.orders.(*mocks.OrderRepositoryMock).On("UpdateOne", order.ID.Hex(), dto).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("UpdateOne", mock.Anything, order.ID.Hex(), dto).Return(order, nil)
 
 	server.PUT("/orders/:id", handler.UpdateOrder)
 
@@ -282,8 +575,55 @@ func TestUpdateOrder(t *testing.T) {
 	}
 }
 
+func TestCreateOrderValidation(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	server.POST("/orders", withIdentity("1", models.RoleCustomer), handler.CreateOrder)
+
+	cases := map[string]struct {
+		body  string
+		field string
+		rule  string
+	}{
+		"no items":          {`{"cost":{"amount":100,"currency":"EUR"},"address":"a","country":"DE","city":"c","postalCode":"10115"}`, "items", "required"},
+		"negative quantity": {`{"items":[{"id":"1","name":"candy","price":{"amount":100,"currency":"EUR"},"quantity":-1}],"cost":{"amount":100,"currency":"EUR"},"address":"a","country":"DE","city":"c","postalCode":"10115"}`, "items[0].quantity", "gt"},
+		"free item":         {`{"items":[{"id":"1","name":"candy","price":{"amount":0,"currency":"EUR"},"quantity":1}],"cost":{"amount":100,"currency":"EUR"},"address":"a","country":"DE","city":"c","postalCode":"10115"}`, "items[0].price", "positive_money"},
+		"empty address":     {`{"items":[{"id":"1","name":"candy","price":{"amount":100,"currency":"EUR"},"quantity":1}],"cost":{"amount":100,"currency":"EUR"},"country":"DE","city":"c","postalCode":"10115"}`, "address", "required"},
+		"unknown country":   {`{"items":[{"id":"1","name":"candy","price":{"amount":100,"currency":"EUR"},"quantity":1}],"cost":{"amount":100,"currency":"EUR"},"address":"a","country":"Germany","city":"c","postalCode":"10115"}`, "country", "iso3166_1_alpha2"},
+		"foreign postcode":  {`{"items":[{"id":"1","name":"candy","price":{"amount":100,"currency":"EUR"},"quantity":1}],"cost":{"amount":100,"currency":"EUR"},"address":"a","country":"DE","city":"c","postalCode":"SW1A 1AA"}`, "postalCode", "postal_code"},
+		"wrong type":        {`{"items":"candy"}`, "items", "type"},
+	}
+
+	for name, tc := range cases {
+		req, _ := http.NewRequest("POST", "/orders", bytes.NewBufferString(tc.body))
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", name, status, http.StatusBadRequest)
+		}
+
+		var body struct {
+			Violations []validation.Violation `json:"violations"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+		if len(body.Violations) != 1 || body.Violations[0].Field != tc.field || body.Violations[0].Rule != tc.rule {
+			t.Errorf("%s: handler returned unexpected violations: got %v want %s %s", name, rec.Body.String(), tc.field, tc.rule)
+		}
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "InsertOne", mock.Anything, mock.Anything)
+}
+
 func TestUpdateOrderInvalidPayload(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -302,8 +642,373 @@ func TestUpdateOrderInvalidPayload(t *testing.T) {
 	}
 }
 
+func TestUpdateOrderWithoutStatus(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	deliveredAt := "2024-01-02 15:04:05"
+	dto := models.UpdateOrderDTO{DeliveredAt: &deliveredAt}
+
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		Status:      models.OrderStatusDelivered,
+		DeliveredAt: deliveredAt,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("UpdateOne", mock.Anything, order.ID.Hex(), dto).Return(order, nil)
+
+	server.PUT("/orders/:id", handler.UpdateOrder)
+
+	req, _ := http.NewRequest("PUT", "/orders/"+order.ID.Hex(), bytes.NewBufferString(`{"deliveredAt":"2024-01-02 15:04:05"}`))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	for _, body := range []string{`{"status":"lost"}`, `{"deliveredAt":"tomorrow"}`} {
+		req, _ := http.NewRequest("PUT", "/orders/"+order.ID.Hex(), bytes.NewBufferString(body))
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", body, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestUpdateOrderInvalidTransition(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	status := models.OrderStatusPending
+	dto := models.UpdateOrderDTO{
+		Status: &status,
+	}
+
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusDelivered,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+
+	server.PUT("/orders/:id", handler.UpdateOrder)
+
+	payload, _ := json.Marshal(dto)
+
+	req, _ := http.NewRequest("PUT", "/orders/"+order.ID.Hex(), bytes.NewBuffer(payload))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	var body map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body["reason"] != models.StatusTransitionReason {
+		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), models.StatusTransitionReason)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "UpdateOne", mock.Anything, order.ID.Hex(), dto)
+}
+
+func TestUpdateOrderIfMatch(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	status := models.OrderStatusShipped
+	dto := models.UpdateOrderDTO{
+		Status: &status,
+	}
+
+	order := &models.Order{
+		ID:      primitive.NewObjectID(),
+		UserID:  "1",
+		Status:  models.OrderStatusPaid,
+		Version: 2,
+	}
+	updated := &models.Order{
+		ID:      order.ID,
+		UserID:  "1",
+		Status:  models.OrderStatusShipped,
+		Version: 3,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("CompareAndSwap", mock.Anything, order.ID.Hex(), int64(2), dto).Return(updated, nil)
+
+	server.PUT("/orders/:id", handler.UpdateOrder)
+
+	payload, _ := json.Marshal(dto)
+
+	req, _ := http.NewRequest("PUT", "/orders/"+order.ID.Hex(), bytes.NewBuffer(payload))
+	req.Header.Set("If-Match", `W/"2", "2"`)
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if etag := rec.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("handler returned wrong ETag: got %v want %v", etag, `"3"`)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "UpdateOne", mock.Anything, order.ID.Hex(), dto)
+}
+
+func TestUpdateOrderStaleIfMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ifMatch string
+		// swapErr is returned when the checked version is outdated by the time the handler writes
+		swapErr error
+	}{
+		{name: "outdated etag", ifMatch: `"1"`},
+		{name: "weak etag", ifMatch: `W/"2"`},
+		{name: "concurrent write", ifMatch: `"2"`, swapErr: repository.ErrVersionMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer()
+
+			handler := &OrderHandler{
+				orders: &mocks.OrderRepositoryMock{},
+			}
+
+			status := models.OrderStatusShipped
+			dto := models.UpdateOrderDTO{
+				Status: &status,
+			}
+
+			order := &models.Order{
+				ID:      primitive.NewObjectID(),
+				UserID:  "1",
+				Status:  models.OrderStatusPaid,
+				Version: 2,
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+			handler.orders.(*mocks.OrderRepositoryMock).On("CompareAndSwap", mock.Anything, order.ID.Hex(), int64(2), dto).Return(nil, tc.swapErr)
+
+			server.PUT("/orders/:id", handler.UpdateOrder)
+
+			payload, _ := json.Marshal(dto)
+
+			req, _ := http.NewRequest("PUT", "/orders/"+order.ID.Hex(), bytes.NewBuffer(payload))
+			req.Header.Set("If-Match", tc.ifMatch)
+
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, req)
+
+			if status := rec.Code; status != http.StatusPreconditionFailed {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusPreconditionFailed)
+			}
+
+			var body map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+			if body["type"] != "/problems/precondition-failed" {
+				t.Errorf("handler returned unexpected body: got %v", rec.Body.String())
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "UpdateOne", mock.Anything, order.ID.Hex(), dto)
+		})
+	}
+}
+
+func TestCancelMyOrder(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusPaid,
+	}
+	cancelled := &models.Order{
+		ID:           order.ID,
+		UserID:       "1",
+		Status:       models.OrderStatusCancelled,
+		Cancellation: &models.Cancellation{Reason: "changed my mind", CancelledBy: "1"},
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("Cancel", mock.Anything, order.ID.Hex(), mock.MatchedBy(func(cancellation models.Cancellation) bool {
+		return cancellation.Reason == "changed my mind" && cancellation.CancelledBy == "1" && cancellation.CancelledAt != ""
+	})).Return(cancelled, nil)
+
+	server.POST("/orders/me/:id/cancel", withIdentity("1", models.RoleCustomer), handler.CancelMyOrder)
+
+	req, _ := http.NewRequest("POST", "/orders/me/"+order.ID.Hex()+"/cancel", bytes.NewBufferString(`{"reason":"changed my mind"}`))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var body models.Order
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body.Status != models.OrderStatusCancelled || body.Cancellation == nil || body.Cancellation.Reason != "changed my mind" {
+		t.Errorf("handler returned unexpected body: got %v", rec.Body.String())
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertExpectations(t)
+}
+
+func TestCancelMyOrderNotCancellable(t *testing.T) {
+	for _, status := range []models.OrderStatus{models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusCancelled} {
+		server := newServer()
+
+		handler := &OrderHandler{
+			orders: &mocks.OrderRepositoryMock{},
+		}
+
+		order := &models.Order{
+			ID:     primitive.NewObjectID(),
+			UserID: "1",
+			Status: status,
+		}
+
+		handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+
+		server.POST("/orders/me/:id/cancel", withIdentity("1", models.RoleCustomer), handler.CancelMyOrder)
+
+		req, _ := http.NewRequest("POST", "/orders/me/"+order.ID.Hex()+"/cancel", bytes.NewBufferString(`{"reason":"too late"}`))
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if code := rec.Code; code != http.StatusConflict {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", status, code, http.StatusConflict)
+		}
+
+		var body map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+		if body["reason"] != models.NotCancellableReason || body["orderStatus"] != string(status) {
+			t.Errorf("%s: handler returned unexpected body: got %v", status, rec.Body.String())
+		}
+
+		handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "Cancel", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestCancelMyOrderOfOtherUser(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "2",
+		Status: models.OrderStatusPending,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+
+	// staff may read every order but only cancel their own through /me
+	server.POST("/orders/me/:id/cancel", withIdentity("1", models.RoleStaff), handler.CancelMyOrder)
+
+	req, _ := http.NewRequest("POST", "/orders/me/"+order.ID.Hex()+"/cancel", bytes.NewBufferString(`{"reason":"changed my mind"}`))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "Cancel", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelOrderWithoutReason(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	server.POST("/orders/:id/cancel", withIdentity("3", models.RoleAdmin), handler.CancelOrder)
+
+	req, _ := http.NewRequest("POST", "/orders/1/cancel", bytes.NewBufferString(`{}`))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "FindOne", mock.Anything, mock.Anything)
+}
+
+func TestCancelOrderConcurrentChange(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusPending,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("Cancel", mock.Anything, order.ID.Hex(), mock.Anything).
+		Return(nil, (&models.NotCancellableError{Status: models.OrderStatusShipped}).Conflict())
+
+	server.POST("/orders/:id/cancel", withIdentity("3", models.RoleAdmin), handler.CancelOrder)
+
+	req, _ := http.NewRequest("POST", "/orders/"+order.ID.Hex()+"/cancel", bytes.NewBufferString(`{"reason":"fraud"}`))
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+}
+
 func TestDeleteOrder(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -313,19 +1018,19 @@ func TestDeleteOrder(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteOne", order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteOne", mock.Anything, order.ID.Hex()).Return(order, nil)
 
 	server.DELETE("/orders/:id", handler.DeleteOrder)
 
@@ -341,13 +1046,13 @@ func TestDeleteOrder(t *testing.T) {
 }
 
 func TestDeleteOrderNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteOne", "1").Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteOne", mock.Anything, "1").Return(nil, nil)
 
 	server.DELETE("/orders/:id", handler.DeleteOrder)
 
@@ -366,7 +1071,7 @@ func TestDeleteOrderNotFound(t *testing.T) {
 }
 
 func TestGetOrdersByUser(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -376,20 +1081,21 @@ func TestGetOrdersByUser(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", order.UserID).Return([]*models.Order{
-		order,
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", mock.Anything, order.UserID, mock.Anything).Return(&repository.Page[*models.Order]{
+		Items: []*models.Order{order},
+		Total: 1,
 	}, nil)
 
 	server.GET("/orders/user/:id", handler.GetOrdersByUser)
@@ -400,26 +1106,26 @@ func TestGetOrdersByUser(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 1 {
+	if len(body.Items) != 1 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 
-	if body[0].ID != order.ID {
+	if body.Items[0].ID != order.ID {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrdersByUserNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", "1").Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", mock.Anything, "1", mock.Anything).Return(nil, nil)
 
 	server.GET("/orders/user/:id", handler.GetOrdersByUser)
 
@@ -429,16 +1135,16 @@ func TestGetOrdersByUserNotFound(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 0 {
+	if len(body.Items) != 0 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrderByStatus(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -448,20 +1154,21 @@ func TestGetOrderByStatus(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByStatus", order.Status).Return([]*models.Order{
-		order,
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByStatus", mock.Anything, order.Status, mock.Anything).Return(&repository.Page[*models.Order]{
+		Items: []*models.Order{order},
+		Total: 1,
 	}, nil)
 
 	server.GET("/orders/status/:status", handler.GetOrderByStatus)
@@ -472,26 +1179,26 @@ func TestGetOrderByStatus(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 1 {
+	if len(body.Items) != 1 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 
-	if body[0].ID != order.ID {
+	if body.Items[0].ID != order.ID {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrderByStatusNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByStatus", models.OrderStatus("invalid")).Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByStatus", mock.Anything, models.OrderStatus("invalid"), mock.Anything).Return(nil, nil)
 
 	server.GET("/orders/status/:status", handler.GetOrderByStatus)
 
@@ -501,16 +1208,16 @@ func TestGetOrderByStatusNotFound(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 0 {
+	if len(body.Items) != 0 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrdersByUserAndStatus(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -520,27 +1227,28 @@ func TestGetOrdersByUserAndStatus(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", order.UserID, order.Status).Return([]*models.Order{
-		order,
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", mock.Anything, order.UserID, order.Status, mock.Anything).Return(&repository.Page[*models.Order]{
+		Items: []*models.Order{order},
+		Total: 1,
 	}, nil)
 
 	middleware := &middlewares.Middleware{
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(&services.VerifyTokenResponse{
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(&services.VerifyTokenResponse{
 		UserId: order.UserID,
 	}, nil)
 
@@ -560,16 +1268,16 @@ func TestGetOrdersByUserAndStatus(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 1 {
+	if len(body.Items) != 1 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrdersByUserAndStatusNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -579,11 +1287,11 @@ func TestGetOrdersByUserAndStatusNotFound(t *testing.T) {
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(&services.VerifyTokenResponse{
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(&services.VerifyTokenResponse{
 		UserId: "1",
 	}, nil)
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", "1", models.OrderStatus("invalid")).Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", mock.Anything, "1", models.OrderStatus("invalid"), mock.Anything).Return(nil, nil)
 
 	requiredAuth := server.Use(middleware.Auth())
 
@@ -597,16 +1305,16 @@ func TestGetOrdersByUserAndStatusNotFound(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 0 {
+	if len(body.Items) != 0 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetOrdersByUserAndStatusUnauthorized(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -616,9 +1324,9 @@ func TestGetOrdersByUserAndStatusUnauthorized(t *testing.T) {
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(nil, errors.New("unauthorized"))
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(nil, errors.New("unauthorized"))
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", "1", models.OrderStatus("invalid")).Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUserAndStatus", mock.Anything, "1", models.OrderStatus("invalid"), mock.Anything).Return(nil, nil)
 
 	requiredAuth := server.Use(middleware.Auth())
 
@@ -638,7 +1346,7 @@ func TestGetOrdersByUserAndStatusUnauthorized(t *testing.T) {
 }
 
 func TestGetMyOrders(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -648,27 +1356,28 @@ func TestGetMyOrders(t *testing.T) {
 		ID:                   primitive.NewObjectID(),
 		UserID:               "1",
 		Items:                make([]models.Item, 0),
-		Cost:                 100.0,
+		Price:                models.PriceBreakdown{Subtotal: models.NewMoney(10000, "EUR"), Total: models.NewMoney(10000, "EUR")},
 		Status:               models.OrderStatusPending,
 		ExpectedDeliveryDate: "2021-01-01",
 		DeliveredAt:          "2021-01-01",
 		Address:              "address",
-		Country:              "country",
+		Country:              "DE",
 		City:                 "city",
-		PostalCode:           "postalCode",
+		PostalCode:           "10115",
 		CreatedAt:            "2021-01-01",
 		UpdatedAt:            "2021-01-01",
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", order.UserID).Return([]*models.Order{
-		order,
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", mock.Anything, order.UserID, mock.Anything).Return(&repository.Page[*models.Order]{
+		Items: []*models.Order{order},
+		Total: 1,
 	}, nil)
 
 	middleware := &middlewares.Middleware{
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(&services.VerifyTokenResponse{
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(&services.VerifyTokenResponse{
 		UserId: order.UserID,
 	}, nil)
 
@@ -688,16 +1397,16 @@ func TestGetMyOrders(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 1 {
+	if len(body.Items) != 1 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetMyOrdersNotFound(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -707,11 +1416,11 @@ func TestGetMyOrdersNotFound(t *testing.T) {
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(&services.VerifyTokenResponse{
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(&services.VerifyTokenResponse{
 		UserId: "1",
 	}, nil)
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", "1").Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", mock.Anything, "1", mock.Anything).Return(nil, nil)
 
 	requiredAuth := server.Use(middleware.Auth())
 
@@ -725,16 +1434,16 @@ func TestGetMyOrdersNotFound(t *testing.T) {
 
 	server.ServeHTTP(rec, req)
 
-	var body []models.Order
+	var body repository.Page[models.Order]
 	_ = json.Unmarshal(rec.Body.Bytes(), &body)
 
-	if len(body) != 0 {
+	if len(body.Items) != 0 {
 		t.Errorf("handler returned unexpected body: got %v want %v", rec.Body.String(), "[]")
 	}
 }
 
 func TestGetMyOrdersUnauthorized(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -744,9 +1453,9 @@ func TestGetMyOrdersUnauthorized(t *testing.T) {
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(nil, errors.New("unauthorized"))
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(nil, errors.New("unauthorized"))
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", "1").Return(nil, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindByUser", mock.Anything, "1", mock.Anything).Return(nil, nil)
 
 	requiredAuth := server.Use(middleware.Auth())
 
@@ -766,13 +1475,13 @@ func TestGetMyOrdersUnauthorized(t *testing.T) {
 }
 
 func TestDeleteAllOrders(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteAll").Return(nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteAll", mock.Anything).Return(nil)
 
 	server.DELETE("/orders", handler.DeleteAllOrders)
 
@@ -788,19 +1497,19 @@ func TestDeleteAllOrders(t *testing.T) {
 }
 
 func TestDeleteAllMyOrders(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
 	}
 
-	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteAllByUser", "1").Return(nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("DeleteAllByUser", mock.Anything, "1").Return(nil)
 
 	middleware := &middlewares.Middleware{
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(&services.VerifyTokenResponse{
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(&services.VerifyTokenResponse{
 		UserId: "1",
 	}, nil)
 
@@ -822,7 +1531,7 @@ func TestDeleteAllMyOrders(t *testing.T) {
 }
 
 func TestDeleteAllMyOrdersUnauthorized(t *testing.T) {
-	server := gin.Default()
+	server := newServer()
 
 	handler := &OrderHandler{
 		orders: &mocks.OrderRepositoryMock{},
@@ -834,7 +1543,7 @@ func TestDeleteAllMyOrdersUnauthorized(t *testing.T) {
 		AuthService: &mocks.AuthServiceMock{},
 	}
 
-	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", "token").Return(nil, errors.New("unauthorized"))
+	middleware.AuthService.(*mocks.AuthServiceMock).On("ValidateToken", mock.Anything, "token").Return(nil, errors.New("unauthorized"))
 
 	requiredAuth := server.Use(middleware.Auth())
 
@@ -852,3 +1561,342 @@ func TestDeleteAllMyOrdersUnauthorized(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
 	}
 }
+
+func TestGetOrderByIDOwnership(t *testing.T) {
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusPending,
+	}
+
+	cases := []struct {
+		name   string
+		userId string
+		role   models.Role
+		want   int
+	}{
+		{"owner", "1", models.RoleCustomer, http.StatusOK},
+		{"other customer", "2", models.RoleCustomer, http.StatusNotFound},
+		{"staff", "2", models.RoleStaff, http.StatusOK},
+		{"admin", "2", models.RoleAdmin, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer()
+
+			handler := &OrderHandler{
+				orders: &mocks.OrderRepositoryMock{},
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+
+			server.GET("/orders/:id", withIdentity(tc.userId, tc.role), handler.GetOrder)
+
+			req, _ := http.NewRequest("GET", "/orders/"+order.ID.Hex(), nil)
+
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, req)
+
+			if status := rec.Code; status != tc.want {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateOrderForOtherUser(t *testing.T) {
+	cases := []struct {
+		name string
+		role models.Role
+		want string
+	}{
+		{"customer", models.RoleCustomer, "1"},
+		{"staff", models.RoleStaff, "2"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer()
+
+			handler := &OrderHandler{
+				orders:  &mocks.OrderRepositoryMock{},
+				pricing: &pricing.Calculator{Currency: "EUR"},
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).On("InsertOne", mock.Anything, mock.AnythingOfType("*models.Order")).Return(
+				func(ctx context.Context, order *models.Order) *models.Order { return order }, nil)
+
+			server.POST("/orders", withIdentity("1", tc.role), handler.CreateOrder)
+
+			payload, _ := json.Marshal(models.CreateOrderDTO{
+				UserId:     "2",
+				Items:      []models.Item{{ID: "1", Name: "candy", Price: models.NewMoney(100, "EUR"), Quantity: 1}},
+				Cost:       models.NewMoney(100, "EUR"),
+				Address:    "address",
+				Country:    "DE",
+				City:       "city",
+				PostalCode: "10115",
+			})
+
+			req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(payload))
+
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, req)
+
+			var body models.Order
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+			if body.UserID != tc.want {
+				t.Errorf("handler created order for wrong user: got %v want %v", body.UserID, tc.want)
+			}
+		})
+	}
+}
+
+// TestOrderRoutesRoleMatrix mirrors the role classification of routes.setupOrdersRoutes.
+func TestOrderRoutesRoleMatrix(t *testing.T) {
+	order := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusPending,
+	}
+
+	repo := &mocks.OrderRepositoryMock{}
+	repo.On("FindOne", mock.Anything, mock.Anything).Return(order, nil)
+	repo.On("FindAll", mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{}, nil)
+	repo.On("FindByUser", mock.Anything, mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{}, nil)
+	repo.On("FindByStatus", mock.Anything, mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{}, nil)
+	repo.On("FindByUserAndStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&repository.Page[*models.Order]{}, nil)
+	repo.On("InsertOne", mock.Anything, mock.Anything).Return(order, nil)
+	repo.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything).Return(order, nil)
+	repo.On("DeleteOne", mock.Anything, mock.Anything).Return(order, nil)
+	repo.On("Cancel", mock.Anything, mock.Anything, mock.Anything).Return(order, nil)
+	repo.On("DeleteAll", mock.Anything).Return(nil)
+	repo.On("DeleteAllByUser", mock.Anything, mock.Anything).Return(nil)
+
+	handler := &OrderHandler{
+		orders:  repo,
+		pricing: &pricing.Calculator{Currency: "EUR"},
+	}
+
+	middleware := &middlewares.Middleware{
+		AuthService: &mocks.AuthServiceMock{},
+	}
+
+	auth := middleware.AuthService.(*mocks.AuthServiceMock)
+	auth.On("ValidateToken", mock.Anything, "customer").Return(&services.VerifyTokenResponse{UserId: "1", Roles: []models.Role{models.RoleCustomer}}, nil)
+	auth.On("ValidateToken", mock.Anything, "staff").Return(&services.VerifyTokenResponse{UserId: "2", Roles: []models.Role{models.RoleStaff}}, nil)
+	auth.On("ValidateToken", mock.Anything, "admin").Return(&services.VerifyTokenResponse{UserId: "3", Roles: []models.Role{models.RoleAdmin}}, nil)
+
+	server := newServer()
+	orders := server.Group("/orders", middleware.Auth())
+
+	customer := orders.Group("", middleware.RequireRole(models.RoleCustomer))
+	customer.GET("/me", handler.GetMyOrders)
+	customer.GET("/me/status/:status", handler.GetMyOrdersByStatus)
+	customer.DELETE("/me", handler.DeleteAllMyOrders)
+	customer.GET(":id", handler.GetOrder)
+	customer.POST("", handler.CreateOrder)
+
+	staff := orders.Group("", middleware.RequireRole(models.RoleStaff))
+	staff.GET("", handler.GetOrders)
+	staff.GET("/user/:id", handler.GetOrdersByUser)
+	staff.GET("/status/:status", handler.GetOrderByStatus)
+	staff.PUT(":id", handler.UpdateOrder)
+
+	admin := orders.Group("", middleware.RequireRole(models.RoleAdmin))
+	admin.DELETE(":id", handler.DeleteOrder)
+	admin.POST(":id/cancel", handler.CancelOrder)
+	admin.DELETE("", handler.DeleteAllOrders)
+
+	id := order.ID.Hex()
+	routes := []struct {
+		method   string
+		path     string
+		body     string
+		required models.Role
+	}{
+		{"GET", "/orders/me", "", models.RoleCustomer},
+		{"GET", "/orders/me/status/pending", "", models.RoleCustomer},
+		{"DELETE", "/orders/me", "", models.RoleCustomer},
+		{"GET", "/orders/" + id, "", models.RoleCustomer},
+		{"POST", "/orders", `{"items":[{"id":"1","name":"candy","price":{"amount":100,"currency":"EUR"},"quantity":1}],"cost":{"amount":100,"currency":"EUR"},"address":"address","country":"DE","city":"city","postalCode":"10115"}`, models.RoleCustomer},
+		{"GET", "/orders", "", models.RoleStaff},
+		{"GET", "/orders/user/1", "", models.RoleStaff},
+		{"GET", "/orders/status/pending", "", models.RoleStaff},
+		{"PUT", "/orders/" + id, `{"status":"paid"}`, models.RoleStaff},
+		{"DELETE", "/orders/" + id, "", models.RoleAdmin},
+		{"POST", "/orders/" + id + "/cancel", `{"reason":"fraud"}`, models.RoleAdmin},
+		{"DELETE", "/orders", "", models.RoleAdmin},
+	}
+
+	for _, route := range routes {
+		for _, role := range []models.Role{"", models.RoleCustomer, models.RoleStaff, models.RoleAdmin} {
+			req, _ := http.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+			if role != "" {
+				req.Header.Set("Authorization", "Bearer "+string(role))
+			}
+
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, req)
+
+			var want int
+			switch {
+			case role == "":
+				want = http.StatusUnauthorized
+			case !models.HasRole([]models.Role{role}, route.required):
+				want = http.StatusForbidden
+			default:
+				want = http.StatusOK
+				if route.method == "POST" && route.path == "/orders" {
+					want = http.StatusCreated
+				}
+			}
+
+			if status := rec.Code; status != want {
+				t.Errorf("%s %s as %q returned wrong status code: got %v want %v", route.method, route.path, role, status, want)
+			}
+		}
+	}
+}
+
+func TestPatchOrder(t *testing.T) {
+	server := newServer()
+
+	handler := &OrderHandler{
+		orders: &mocks.OrderRepositoryMock{},
+	}
+
+	order := &models.Order{
+		ID:         primitive.NewObjectID(),
+		UserID:     "1",
+		Status:     models.OrderStatusPending,
+		Address:    "Main Street 1",
+		Country:    "DE",
+		City:       "Berlin",
+		PostalCode: "10115",
+		Notes:      "ring twice",
+		Version:    1,
+	}
+
+	city, notes := "Hamburg", ""
+	dto := models.UpdateOrderDTO{City: &city, Notes: &notes}
+	updated := &models.Order{ID: order.ID, UserID: "1", Status: models.OrderStatusPending, City: city, Version: 2}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.orders.(*mocks.OrderRepositoryMock).On("UpdateOne", mock.Anything, order.ID.Hex(), dto).Return(updated, nil)
+
+	server.PATCH("/orders/:id", withIdentity("1", models.RoleCustomer), handler.PatchOrder)
+
+	req, _ := http.NewRequest("PATCH", "/orders/"+order.ID.Hex(), bytes.NewBufferString(`{"city":"Hamburg","notes":null}`))
+	req.Header.Set("Content-Type", MergePatchContentType)
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rec.Body.String())
+	}
+
+	var body models.Order
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body.City != city {
+		t.Errorf("handler returned unexpected body: got %v", rec.Body.String())
+	}
+
+	if etag := rec.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("handler returned wrong ETag: got %v want %v", etag, `"2"`)
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).AssertExpectations(t)
+}
+
+func TestPatchOrderRejected(t *testing.T) {
+	pending := &models.Order{
+		ID:         primitive.NewObjectID(),
+		UserID:     "1",
+		Status:     models.OrderStatusPending,
+		Address:    "Main Street 1",
+		Country:    "DE",
+		City:       "Berlin",
+		PostalCode: "10115",
+	}
+	paid := &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Status: models.OrderStatusPaid,
+	}
+
+	for _, tc := range []struct {
+		name        string
+		order       *models.Order
+		userId      string
+		role        models.Role
+		contentType string
+		patch       string
+		status      int
+		// field is the violation or reason expected in the problem
+		field  string
+		reason string
+	}{
+		{name: "customer patches status", order: pending, userId: "1", role: models.RoleCustomer, patch: `{"status":"paid","notes":"x"}`, status: http.StatusForbidden},
+		{name: "customer patches other order", order: pending, userId: "2", role: models.RoleCustomer, patch: `{"notes":"x"}`, status: http.StatusNotFound},
+		{name: "address of paid order", order: paid, userId: "2", role: models.RoleStaff, patch: `{"city":"Hamburg"}`, status: http.StatusConflict, reason: models.AddressNotEditableReason},
+		{name: "illegal status transition", order: paid, userId: "2", role: models.RoleStaff, patch: `{"status":"pending"}`, status: http.StatusConflict, reason: models.StatusTransitionReason},
+		{name: "postal code of other country", order: pending, userId: "1", role: models.RoleCustomer, patch: `{"country":"NL"}`, status: http.StatusBadRequest, field: "postalCode"},
+		{name: "remove address", order: pending, userId: "1", role: models.RoleCustomer, patch: `{"address":null}`, status: http.StatusBadRequest, field: "address"},
+		{name: "unknown member", order: pending, userId: "1", role: models.RoleCustomer, patch: `{"cost":1}`, status: http.StatusBadRequest, field: "cost"},
+		{name: "malformed date", order: pending, userId: "2", role: models.RoleStaff, patch: `{"expectedDeliveryDate":"soon"}`, status: http.StatusBadRequest, field: "expectedDeliveryDate"},
+		{name: "plain JSON", order: pending, userId: "1", role: models.RoleCustomer, contentType: "application/json", patch: `{"notes":"x"}`, status: http.StatusUnsupportedMediaType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer()
+
+			handler := &OrderHandler{
+				orders: &mocks.OrderRepositoryMock{},
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, tc.order.ID.Hex()).Return(tc.order, nil)
+
+			server.PATCH("/orders/:id", withIdentity(tc.userId, tc.role), handler.PatchOrder)
+
+			req, _ := http.NewRequest("PATCH", "/orders/"+tc.order.ID.Hex(), bytes.NewBufferString(tc.patch))
+			req.Header.Set("Content-Type", MergePatchContentType)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, req)
+
+			if status := rec.Code; status != tc.status {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", status, tc.status, rec.Body.String())
+			}
+
+			var body struct {
+				Reason     string                 `json:"reason"`
+				Violations []validation.Violation `json:"violations"`
+			}
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+			if tc.reason != "" && body.Reason != tc.reason {
+				t.Errorf("handler returned unexpected body: got %v want reason %v", rec.Body.String(), tc.reason)
+			}
+			if tc.field != "" && (len(body.Violations) != 1 || body.Violations[0].Field != tc.field) {
+				t.Errorf("handler returned unexpected body: got %v want a violation of %v", rec.Body.String(), tc.field)
+			}
+			if tc.status == http.StatusUnsupportedMediaType && rec.Header().Get("Accept-Patch") != MergePatchContentType {
+				t.Errorf("handler returned wrong Accept-Patch: got %v", rec.Header().Get("Accept-Patch"))
+			}
+
+			handler.orders.(*mocks.OrderRepositoryMock).AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
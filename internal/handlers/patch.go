@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/validation"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergePatchContentType is the media type of JSON Merge Patch (RFC 7386) bodies.
+const MergePatchContentType = "application/merge-patch+json"
+
+var errNotMergePatch = apperrors.New(apperrors.KindUnsupportedMediaType, "Patches must be sent as "+MergePatchContentType)
+
+var errStaffOnlyMembers = apperrors.New(apperrors.KindForbidden, "Only staff may change these fields")
+
+// patchMembers are the JSON names of the members an order patch may contain.
+var patchMembers = jsonNames(reflect.TypeOf(models.OrderPatch{}))
+
+// removableMembers may be null in an order patch, every other member is required.
+var removableMembers = map[string]bool{"notes": true}
+
+func jsonNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names[strings.SplitN(t.Field(i).Tag.Get("json"), ",", 2)[0]] = true
+	}
+	return names
+}
+
+// decodeMergePatch reads a merge patch body into patch without validating it.
+// Unknown members and null for members that cannot be removed are rejected.
+func decodeMergePatch(c *gin.Context, patch *models.OrderPatch) bool {
+	if c.ContentType() != MergePatchContentType {
+		c.Header("Accept-Patch", MergePatchContentType)
+		_ = c.Error(errNotMergePatch)
+		return false
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil && len(body) == 0 {
+		err = io.EOF
+	}
+	if err != nil {
+		_ = c.Error(invalidRequest(err))
+		return false
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return false
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	violations := make([]validation.Violation, 0)
+	for _, name := range names {
+		switch value := members[name]; {
+		case !patchMembers[name]:
+			violations = append(violations, validation.Violation{Field: name, Rule: "unknown", Message: "is not a field that can be patched"})
+		case string(value) == "null" && !removableMembers[name]:
+			violations = append(violations, validation.Violation{Field: name, Rule: "required", Message: "cannot be removed"})
+		}
+	}
+	if len(violations) > 0 {
+		_ = c.Error(apperrors.Validation("Validation failed").With("violations", violations))
+		return false
+	}
+
+	if err := json.Unmarshal(body, patch); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return false
+	}
+	if value, ok := members["notes"]; ok && string(value) == "null" {
+		patch.Notes = new(string)
+	}
+
+	return true
+}
+
+// staffOnlyMembers lists the members of the patch customers may not change.
+func staffOnlyMembers(patch models.OrderPatch) []string {
+	members := make([]string, 0)
+	if patch.Status != nil {
+		members = append(members, "status")
+	}
+	if patch.ExpectedDeliveryDate != nil {
+		members = append(members, "expectedDeliveryDate")
+	}
+	return members
+}
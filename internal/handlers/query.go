@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/repository"
+	"time"
+)
+
+type listOrdersParams struct {
+	Limit       int64  `form:"limit"`
+	Cursor      string `form:"cursor"`
+	Sort        string `form:"sort"`
+	Order       string `form:"order"`
+	CreatedFrom string `form:"createdFrom"`
+	CreatedTo   string `form:"createdTo"`
+	MinCost     *int64 `form:"minCost"`
+	MaxCost     *int64 `form:"maxCost"`
+}
+
+// parseOrderQuery reads the paging, sorting and filtering query parameters
+// shared by all order list endpoints.
+func parseOrderQuery(c *gin.Context) (repository.OrderQuery, error) {
+	var params listOrdersParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		return repository.OrderQuery{}, invalidRequest(err)
+	}
+
+	query := repository.OrderQuery{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		MinCost:    params.MinCost,
+		MaxCost:    params.MaxCost,
+		Descending: true,
+	}
+
+	if params.Limit < 0 || params.Limit > repository.MaxLimit {
+		return query, apperrors.Validation("limit must be between 1 and 100")
+	}
+
+	if params.Sort != "" {
+		if !repository.IsSortFieldValid(params.Sort) {
+			return query, apperrors.Validation("sort must be one of created_at, cost or status")
+		}
+		query.SortBy = repository.SortField(params.Sort)
+	}
+
+	switch params.Order {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return query, apperrors.Validation("order must be asc or desc")
+	}
+
+	if params.CreatedFrom != "" {
+		from, _, err := parseDateParam(params.CreatedFrom)
+		if err != nil {
+			return query, apperrors.Validation("createdFrom must be a date or date time")
+		}
+		query.CreatedFrom = &from
+	}
+
+	if params.CreatedTo != "" {
+		to, dateOnly, err := parseDateParam(params.CreatedTo)
+		if err != nil {
+			return query, apperrors.Validation("createdTo must be a date or date time")
+		}
+		// a plain date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query.CreatedTo = &to
+	}
+
+	if query.MinCost != nil && query.MaxCost != nil && *query.MinCost > *query.MaxCost {
+		return query, apperrors.Validation("minCost must not be greater than maxCost")
+	}
+
+	return query, nil
+}
+
+type listReturnsParams struct {
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+// parseReturnQuery reads the paging query parameters of the return list endpoints.
+func parseReturnQuery(c *gin.Context) (repository.ReturnQuery, error) {
+	var params listReturnsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		return repository.ReturnQuery{}, invalidRequest(err)
+	}
+
+	if params.Limit < 0 || params.Limit > repository.MaxLimit {
+		return repository.ReturnQuery{}, apperrors.Validation("limit must be between 1 and 100")
+	}
+
+	return repository.ReturnQuery{Limit: params.Limit, Cursor: params.Cursor}, nil
+}
+
+// parseDateParam reads a date, a date time or an RFC 3339 time and reports
+// whether it was a plain date. Times without an offset are taken as UTC, the
+// others are converted to it.
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.DateTime, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), false, err
+}
+
+func respondPage[T interface{}](c *gin.Context, page *repository.Page[T]) {
+	if page == nil {
+		page = &repository.Page[T]{}
+	}
+	if page.Items == nil {
+		page.Items = make([]T, 0)
+	}
+	c.JSON(200, page)
+}
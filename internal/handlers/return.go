@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	"io"
+	"time"
+)
+
+var errInvalidReturnStatus = apperrors.Validation("Invalid return status")
+
+type ReturnHandler struct {
+	returns repository.IReturnRepository
+	orders  repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery]
+	// window is how long after delivery returns can be opened.
+	window time.Duration
+}
+
+func NewReturnHandler(
+	returns repository.IReturnRepository,
+	orders repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery],
+	window time.Duration,
+) *ReturnHandler {
+	return &ReturnHandler{
+		returns: returns,
+		orders:  orders,
+		window:  window,
+	}
+}
+
+// CreateReturn Return godoc
+// @Summary open return
+// @Tags returns
+// @Schemes
+// @Description return items of one of the caller's delivered orders within the return window
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param return body models.CreateReturnDTO true "return"
+// @Success 201 {object} models.Return
+// @Failure 400 "invalid order id or payload"
+// @Failure 404 "order not found"
+// @Failure 409 "order not delivered or return window expired"
+// @Failure 422 "item not part of the order or already returned"
+// @Failure 504 "database timeout"
+// @Router /returns [post]
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	var dto models.CreateReturnDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return
+	}
+
+	order, err := h.orders.FindOne(c.Request.Context(), dto.OrderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if order == nil || order.UserID != c.GetString("userId") {
+		_ = c.Error(repository.ErrOrderNotFound)
+		return
+	}
+
+	existing, err := h.returns.FindByOrder(c.Request.Context(), order.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ret, err := models.NewReturn(order, dto, existing, h.window, models.Now())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ret, err = h.returns.InsertOne(c.Request.Context(), ret)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(201, ret)
+}
+
+// GetReturn Return godoc
+// @Summary get return by id
+// @Tags returns
+// @Schemes
+// @Description get return by id, customers may only read their own returns
+// @Security ApiKeyAuth
+// @Param id path string true "return id"
+// @Success 200 {object} models.Return
+// @Failure 400 "invalid return id"
+// @Failure 404 "return not found"
+// @Failure 504 "database timeout"
+// @Router /returns/{id} [get]
+func (h *ReturnHandler) GetReturn(c *gin.Context) {
+	ret, err := h.returns.FindOne(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if ret == nil || !canAccessUser(c, ret.UserID) {
+		_ = c.Error(repository.ErrReturnNotFound)
+		return
+	}
+
+	c.JSON(200, ret)
+}
+
+// GetMyReturns Returns godoc
+// @Summary get own returns
+// @Tags returns
+// @Schemes
+// @Description get the caller's returns, newest first
+// @Security ApiKeyAuth
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} repository.Page[models.Return]
+// @Failure 504 "database timeout"
+// @Router /returns/me [get]
+func (h *ReturnHandler) GetMyReturns(c *gin.Context) {
+	h.list(c, c.GetString("userId"), "")
+}
+
+// GetMyReturnsByStatus Returns godoc
+// @Summary get own returns by status
+// @Tags returns
+// @Schemes
+// @Description get the caller's returns in a status, newest first
+// @Security ApiKeyAuth
+// @Param status path string true "return status" Enums(requested, approved, rejected)
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} repository.Page[models.Return]
+// @Failure 400 "invalid return status"
+// @Failure 504 "database timeout"
+// @Router /returns/me/status/{status} [get]
+func (h *ReturnHandler) GetMyReturnsByStatus(c *gin.Context) {
+	h.list(c, c.GetString("userId"), c.Param("status"))
+}
+
+// GetReturnsByUser Returns godoc
+// @Summary get returns by user
+// @Tags returns
+// @Schemes
+// @Description get the returns of a user, staff only
+// @Security ApiKeyAuth
+// @Param id path string true "user id"
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} repository.Page[models.Return]
+// @Failure 504 "database timeout"
+// @Router /returns/user/{id} [get]
+func (h *ReturnHandler) GetReturnsByUser(c *gin.Context) {
+	h.list(c, c.Param("id"), "")
+}
+
+// GetReturnsByStatus Returns godoc
+// @Summary get returns by status
+// @Tags returns
+// @Schemes
+// @Description get all returns in a status, staff only
+// @Security ApiKeyAuth
+// @Param status path string true "return status" Enums(requested, approved, rejected)
+// @Param limit query int false "page size, at most 100" default(20)
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} repository.Page[models.Return]
+// @Failure 400 "invalid return status"
+// @Failure 504 "database timeout"
+// @Router /returns/status/{status} [get]
+func (h *ReturnHandler) GetReturnsByStatus(c *gin.Context) {
+	h.list(c, "", c.Param("status"))
+}
+
+func (h *ReturnHandler) list(c *gin.Context, userId string, status string) {
+	if status != "" && !models.IsReturnStatusValid(status) {
+		_ = c.Error(errInvalidReturnStatus)
+		return
+	}
+
+	query, err := parseReturnQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	query.UserID = userId
+	query.Status = models.ReturnStatus(status)
+
+	page, err := h.returns.FindMany(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respondPage(c, page)
+}
+
+// ApproveReturn Return godoc
+// @Summary approve return
+// @Tags returns
+// @Schemes
+// @Description approve a requested return, refund its items and move the order to returned, or to refunded once every item is returned, staff only
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "return id"
+// @Param review body models.ReviewReturnDTO false "review"
+// @Success 200 {object} models.Return
+// @Failure 400 "invalid return id or payload"
+// @Failure 404 "return not found"
+// @Failure 409 "return already reviewed"
+// @Failure 422 "items were already returned"
+// @Failure 504 "database timeout"
+// @Router /returns/{id}/approve [post]
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	h.review(c, h.returns.Approve)
+}
+
+// RejectReturn Return godoc
+// @Summary reject return
+// @Tags returns
+// @Schemes
+// @Description reject a requested return, staff only
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "return id"
+// @Param review body models.ReviewReturnDTO false "review"
+// @Success 200 {object} models.Return
+// @Failure 400 "invalid return id or payload"
+// @Failure 404 "return not found"
+// @Failure 409 "return already reviewed"
+// @Failure 504 "database timeout"
+// @Router /returns/{id}/reject [post]
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	h.review(c, h.returns.Reject)
+}
+
+type reviewFunc func(ctx context.Context, id string, reviewer string, note string) (*models.Return, error)
+
+func (h *ReturnHandler) review(c *gin.Context, decide reviewFunc) {
+	var dto models.ReviewReturnDTO
+	// the review note is optional, so is the body
+	if c.Request.Body != nil {
+		if err := c.ShouldBindJSON(&dto); err != nil && !errors.Is(err, io.EOF) {
+			_ = c.Error(invalidRequest(err))
+			return
+		}
+	}
+
+	ret, err := decide(c.Request.Context(), c.Param("id"), c.GetString("userId"), dto.Note)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(200, ret)
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mycandys/orders/internal/mocks"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const returnWindow = 14 * 24 * time.Hour
+
+func deliveredOrder(deliveredAt time.Time) *models.Order {
+	return &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: "1",
+		Items: []models.Item{
+			{ID: "1", Name: "candy", Price: models.NewMoney(250, "EUR"), Quantity: 2},
+			{ID: "2", Name: "chocolate", Price: models.NewMoney(400, "EUR"), Quantity: 1},
+		},
+		Status:      models.OrderStatusDelivered,
+		DeliveredAt: deliveredAt.UTC().Format(time.DateTime),
+	}
+}
+
+func newReturnHandler(order *models.Order, existing []*models.Return) *ReturnHandler {
+	handler := &ReturnHandler{
+		returns: &mocks.ReturnRepositoryMock{},
+		orders:  &mocks.OrderRepositoryMock{},
+		window:  returnWindow,
+	}
+
+	handler.orders.(*mocks.OrderRepositoryMock).On("FindOne", mock.Anything, order.ID.Hex()).Return(order, nil)
+	handler.returns.(*mocks.ReturnRepositoryMock).On("FindByOrder", mock.Anything, order.ID).Return(existing, nil)
+	handler.returns.(*mocks.ReturnRepositoryMock).On("InsertOne", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, r *models.Return) *models.Return { return r }, nil)
+
+	return handler
+}
+
+func createReturnRequest(handler *ReturnHandler, userId string, dto models.CreateReturnDTO) *httptest.ResponseRecorder {
+	server := newServer()
+	server.POST("/returns", withIdentity(userId, models.RoleCustomer), handler.CreateReturn)
+
+	payload, _ := json.Marshal(dto)
+	req, _ := http.NewRequest("POST", "/returns", bytes.NewBuffer(payload))
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreateReturn(t *testing.T) {
+	order := deliveredOrder(time.Now().AddDate(0, 0, -1))
+	handler := newReturnHandler(order, nil)
+
+	rec := createReturnRequest(handler, "1", models.CreateReturnDTO{
+		OrderID: order.ID.Hex(),
+		Items:   []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}},
+		Reason:  "too sweet",
+	})
+
+	if status := rec.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rec.Body.String())
+	}
+
+	var body models.Return
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+	if body.Status != models.ReturnStatusRequested || body.OrderID != order.ID || body.UserID != "1" {
+		t.Errorf("handler returned unexpected body: got %v", rec.Body.String())
+	}
+	if len(body.Items) != 1 || body.Items[0].Price != models.NewMoney(250, "EUR") || body.Items[0].Name != "candy" {
+		t.Errorf("returned items are not priced as ordered: got %v", body.Items)
+	}
+	if body.Refund != nil {
+		t.Errorf("refund recorded before approval: got %v", body.Refund)
+	}
+}
+
+func TestCreateReturnRejected(t *testing.T) {
+	shipped := deliveredOrder(time.Now())
+	shipped.Status = models.OrderStatusShipped
+	shipped.DeliveredAt = ""
+
+	cases := []struct {
+		name     string
+		order    *models.Order
+		existing []*models.Return
+		items    []models.ReturnItemDTO
+		status   int
+		reason   string
+	}{
+		{
+			name:   "not delivered",
+			order:  shipped,
+			items:  []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}},
+			status: http.StatusConflict,
+			reason: models.NotReturnableReason,
+		},
+		{
+			name:   "window expired",
+			order:  deliveredOrder(time.Now().Add(-returnWindow - time.Hour)),
+			items:  []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}},
+			status: http.StatusConflict,
+			reason: models.ReturnWindowExpiredReason,
+		},
+		{
+			name:   "more than ordered",
+			order:  deliveredOrder(time.Now()),
+			items:  []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}, {ItemID: "1", Quantity: 2}},
+			status: http.StatusUnprocessableEntity,
+			reason: models.ReturnQuantityReason,
+		},
+		{
+			name:  "already returned",
+			order: deliveredOrder(time.Now()),
+			existing: []*models.Return{
+				{Status: models.ReturnStatusApproved, Items: []models.ReturnItem{{ItemID: "1", Quantity: 1}}},
+				{Status: models.ReturnStatusRequested, Items: []models.ReturnItem{{ItemID: "1", Quantity: 1}}},
+			},
+			items:  []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}},
+			status: http.StatusUnprocessableEntity,
+			reason: models.ReturnQuantityReason,
+		},
+		{
+			name:   "unknown item",
+			order:  deliveredOrder(time.Now()),
+			items:  []models.ReturnItemDTO{{ItemID: "3", Quantity: 1}},
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range cases {
+		handler := newReturnHandler(tc.order, tc.existing)
+
+		rec := createReturnRequest(handler, "1", models.CreateReturnDTO{
+			OrderID: tc.order.ID.Hex(),
+			Items:   tc.items,
+			Reason:  "too sweet",
+		})
+
+		if status := rec.Code; status != tc.status {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.name, status, tc.status)
+		}
+
+		var body map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+
+		if tc.reason != "" && body["reason"] != tc.reason {
+			t.Errorf("%s: handler returned unexpected body: got %v want reason %v", tc.name, rec.Body.String(), tc.reason)
+		}
+
+		handler.returns.(*mocks.ReturnRepositoryMock).AssertNotCalled(t, "InsertOne", mock.Anything, mock.Anything)
+	}
+}
+
+func TestCreateReturnAfterRejectedReturn(t *testing.T) {
+	order := deliveredOrder(time.Now())
+	handler := newReturnHandler(order, []*models.Return{
+		{Status: models.ReturnStatusRejected, Items: []models.ReturnItem{{ItemID: "1", Quantity: 2}}},
+	})
+
+	rec := createReturnRequest(handler, "1", models.CreateReturnDTO{
+		OrderID: order.ID.Hex(),
+		Items:   []models.ReturnItemDTO{{ItemID: "1", Quantity: 2}},
+		Reason:  "too sweet",
+	})
+
+	if status := rec.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+}
+
+func TestCreateReturnForOtherUsersOrder(t *testing.T) {
+	order := deliveredOrder(time.Now())
+	handler := newReturnHandler(order, nil)
+
+	rec := createReturnRequest(handler, "2", models.CreateReturnDTO{
+		OrderID: order.ID.Hex(),
+		Items:   []models.ReturnItemDTO{{ItemID: "1", Quantity: 1}},
+		Reason:  "too sweet",
+	})
+
+	if status := rec.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestGetMyReturnsByStatus(t *testing.T) {
+	server := newServer()
+
+	handler := &ReturnHandler{
+		returns: &mocks.ReturnRepositoryMock{},
+	}
+
+	query := repository.ReturnQuery{UserID: "1", Status: models.ReturnStatusApproved, Limit: 5}
+	handler.returns.(*mocks.ReturnRepositoryMock).On("FindMany", mock.Anything, query).Return(&repository.Page[*models.Return]{}, nil)
+
+	server.GET("/returns/me/status/:status", withIdentity("1", models.RoleCustomer), handler.GetMyReturnsByStatus)
+
+	for path, want := range map[string]int{
+		"/returns/me/status/approved?limit=5": http.StatusOK,
+		"/returns/me/status/unknown":          http.StatusBadRequest,
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != want {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", path, status, want)
+		}
+		if want == http.StatusOK && rec.Body.String() != `{"items":[],"total":0}` {
+			t.Errorf("%s: handler returned unexpected body: got %v", path, rec.Body.String())
+		}
+	}
+
+	handler.returns.(*mocks.ReturnRepositoryMock).AssertExpectations(t)
+}
+
+func TestGetReturnOfOtherUser(t *testing.T) {
+	server := newServer()
+
+	handler := &ReturnHandler{
+		returns: &mocks.ReturnRepositoryMock{},
+	}
+
+	ret := &models.Return{ID: primitive.NewObjectID(), UserID: "2"}
+	handler.returns.(*mocks.ReturnRepositoryMock).On("FindOne", mock.Anything, ret.ID.Hex()).Return(ret, nil)
+
+	server.GET("/returns/:id", withIdentity("1", models.RoleCustomer), handler.GetReturn)
+
+	req, _ := http.NewRequest("GET", "/returns/"+ret.ID.Hex(), nil)
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	if status := rec.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestReviewReturn(t *testing.T) {
+	server := newServer()
+
+	handler := &ReturnHandler{
+		returns: &mocks.ReturnRepositoryMock{},
+	}
+
+	approved := &models.Return{
+		ID:     primitive.NewObjectID(),
+		Status: models.ReturnStatusApproved,
+		Refund: &models.Refund{Amount: models.NewMoney(250, "EUR")},
+	}
+	rejected := &models.Return{ID: primitive.NewObjectID(), Status: models.ReturnStatusRejected}
+
+	handler.returns.(*mocks.ReturnRepositoryMock).On("Approve", mock.Anything, approved.ID.Hex(), "2", "looks fine").Return(approved, nil)
+	handler.returns.(*mocks.ReturnRepositoryMock).On("Reject", mock.Anything, rejected.ID.Hex(), "2", "").Return(rejected, nil)
+
+	server.POST("/returns/:id/approve", withIdentity("2", models.RoleStaff), handler.ApproveReturn)
+	server.POST("/returns/:id/reject", withIdentity("2", models.RoleStaff), handler.RejectReturn)
+
+	requests := map[string]string{
+		"/returns/" + approved.ID.Hex() + "/approve": `{"note":"looks fine"}`,
+		// the note is optional
+		"/returns/" + rejected.ID.Hex() + "/reject": "",
+	}
+
+	for path, body := range requests {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", path, status, http.StatusOK)
+		}
+	}
+
+	handler.returns.(*mocks.ReturnRepositoryMock).AssertExpectations(t)
+}
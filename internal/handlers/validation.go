@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/validation"
+	"io"
+)
+
+func init() {
+	validation.Setup()
+}
+
+// decodeJSON reads the request body into obj without validating it, so the
+// handler can fill in fields before calling validate.
+func decodeJSON(c *gin.Context, obj interface{}) bool {
+	if c.Request.Body == nil {
+		_ = c.Error(invalidRequest(io.EOF))
+		return false
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return false
+	}
+	return true
+}
+
+func validate(c *gin.Context, obj interface{}) bool {
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		_ = c.Error(invalidRequest(err))
+		return false
+	}
+	return true
+}
+
+// invalidRequest turns a binding error into a validation error listing the
+// field violations.
+func invalidRequest(err error) *apperrors.Error {
+	violations := validation.Violations(err)
+
+	var typeErr *json.UnmarshalTypeError
+	if violations == nil && errors.As(err, &typeErr) {
+		violations = []validation.Violation{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be a %s", typeErr.Type),
+		}}
+	}
+
+	if violations == nil {
+		message := "Malformed request body"
+		if errors.Is(err, io.EOF) {
+			message = "Request body is empty"
+		}
+		return apperrors.Wrap(apperrors.KindValidation, message, err).With("violations", make([]validation.Violation, 0))
+	}
+
+	return apperrors.Wrap(apperrors.KindValidation, "Validation failed", err).With("violations", violations)
+}
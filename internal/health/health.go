@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDown     Status = "down"
+	StatusDegraded Status = "degraded"
+)
+
+// CheckFunc returns an error when the dependency is not usable.
+type CheckFunc func(ctx context.Context) error
+
+// DetailFunc is a CheckFunc that also reports details shown next to its result.
+type DetailFunc func(ctx context.Context) (interface{}, error)
+
+type check struct {
+	name string
+	// critical checks make the service unready, the others only degrade it
+	critical bool
+	fn       DetailFunc
+}
+
+type Result struct {
+	Status    Status      `json:"status"`
+	Critical  bool        `json:"critical"`
+	LatencyMs int64       `json:"latencyMs"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status    Status            `json:"status"`
+	Checks    map[string]Result `json:"checks"`
+	CheckedAt time.Time         `json:"checkedAt"`
+}
+
+// Ready reports whether all critical dependencies are up.
+func (r *Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+// Checker runs the registered dependency checks concurrently and caches the
+// report for TTL, so frequent probes do not hammer the dependencies.
+type Checker struct {
+	TTL     time.Duration
+	Timeout time.Duration
+
+	checks []check
+	mu     sync.Mutex
+	report *Report
+}
+
+func NewChecker(ttl time.Duration, timeout time.Duration) *Checker {
+	return &Checker{
+		TTL:     ttl,
+		Timeout: timeout,
+	}
+}
+
+func (c *Checker) Register(name string, critical bool, fn CheckFunc) {
+	c.RegisterDetailed(name, critical, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+}
+
+func (c *Checker) RegisterDetailed(name string, critical bool, fn DetailFunc) {
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// Report returns the cached report or runs all checks if it expired. The
+// checks are not cancelled with ctx, but a report finished after the caller
+// gave up is not cached.
+func (c *Checker) Report(ctx context.Context) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.TTL {
+		return c.report
+	}
+
+	report := c.run()
+	if ctx.Err() == nil {
+		c.report = report
+	}
+	return report
+}
+
+func (c *Checker) run() *Report {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+
+			start := time.Now()
+			details, err := chk.fn(ctx)
+
+			result := Result{
+				Status:    StatusUp,
+				Critical:  chk.critical,
+				LatencyMs: time.Since(start).Milliseconds(),
+				Details:   details,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, chk)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status:    StatusUp,
+		Checks:    make(map[string]Result, len(c.checks)),
+		CheckedAt: time.Now(),
+	}
+
+	for i, chk := range c.checks {
+		result := results[i]
+		report.Checks[chk.name] = result
+
+		if result.Status == StatusUp {
+			continue
+		}
+		if chk.critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// HTTPCheck probes url and fails on transport errors and 5xx responses.
+func HTTPCheck(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= 500 {
+			return fmt.Errorf("returned status code %d", res.StatusCode)
+		}
+		return nil
+	}
+}
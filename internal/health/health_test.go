@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckerAggregatesStatus(t *testing.T) {
+	failing := func(ctx context.Context) error { return errors.New("unreachable") }
+	passing := func(ctx context.Context) error { return nil }
+
+	cases := []struct {
+		name     string
+		critical CheckFunc
+		optional CheckFunc
+		want     Status
+	}{
+		{"all up", passing, passing, StatusUp},
+		{"optional down", passing, failing, StatusDegraded},
+		{"critical down", failing, passing, StatusDown},
+	}
+
+	for _, tc := range cases {
+		checker := NewChecker(0, time.Second)
+		checker.Register("mongo", true, tc.critical)
+		checker.Register("cart", false, tc.optional)
+
+		report := checker.Report(context.Background())
+		if report.Status != tc.want {
+			t.Errorf("%s: got status %s want %s", tc.name, report.Status, tc.want)
+		}
+		if report.Ready() != (tc.want != StatusDown) {
+			t.Errorf("%s: unexpected readiness %t", tc.name, report.Ready())
+		}
+		if len(report.Checks) != 2 {
+			t.Errorf("%s: got %d check results want 2", tc.name, len(report.Checks))
+		}
+	}
+}
+
+func TestCheckerCachesReport(t *testing.T) {
+	calls := 0
+	checker := NewChecker(time.Minute, time.Second)
+	checker.Register("mongo", true, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+
+	checker.Report(context.Background())
+	checker.Report(context.Background())
+
+	if calls != 1 {
+		t.Errorf("check ran %d times within the cache ttl", calls)
+	}
+}
+
+func TestCheckerIgnoresCancelledCallers(t *testing.T) {
+	calls := 0
+	checker := NewChecker(time.Minute, time.Second)
+	checker.Register("mongo", true, func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if report := checker.Report(ctx); report.Status != StatusUp {
+		t.Errorf("got status %s for a caller that gave up, the checks must not be cancelled", report.Status)
+	}
+
+	checker.Report(context.Background())
+	checker.Report(context.Background())
+
+	if calls != 2 {
+		t.Errorf("check ran %d times, the report of the cancelled caller must not be cached", calls)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := HTTPCheck(server.Client(), server.URL)
+
+	if err := check(context.Background()); err != nil {
+		t.Errorf("healthy service failed the check: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := check(context.Background()); err == nil {
+		t.Error("unavailable service passed the check")
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware records every request under its route template, e.g. /orders/:id,
+// so ids in the URL do not create a time series per order.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+type transport struct {
+	service string
+	next    http.RoundTripper
+}
+
+// Transport measures the latency of requests to service sent through next.
+func Transport(service string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{service: service, next: next}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	status := "0"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	outboundDuration.WithLabelValues(t.service, req.Method, status).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
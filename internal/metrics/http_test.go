@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareUsesRouteTemplates(t *testing.T) {
+	server := gin.New()
+	server.Use(Middleware())
+	server.GET("/orders/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, id := range []string{"1", "2", "3"} {
+		req, _ := http.NewRequest("GET", "/orders/"+id, nil)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/unknown/path", nil)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/orders/:id", "200")); count != 3 {
+		t.Errorf("got %v requests for the route template want 3", count)
+	}
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")); count != 1 {
+		t.Errorf("got %v unmatched requests want 1", count)
+	}
+	if series := testutil.CollectAndCount(httpRequests); series != 2 {
+		t.Errorf("got %d series want 2, raw paths must not become labels", series)
+	}
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"log"
+	"time"
+)
+
+const namespace = "orders"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Handled HTTP requests by route template, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of handled HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	repositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_operation_duration_seconds",
+		Help:      "Latency of repository operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"repository", "operation"})
+
+	repositoryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_operation_errors_total",
+		Help:      "Failed repository operations.",
+	}, []string{"repository", "operation"})
+
+	messagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rabbitmq_published_messages_total",
+		Help:      "Messages published to RabbitMQ by exchange and result (success, failure, buffered).",
+	}, []string{"exchange", "result"})
+
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rabbitmq_consumed_messages_total",
+		Help:      "Messages consumed from RabbitMQ by routing key and result (ack, requeue, dead_letter).",
+	}, []string{"routing_key", "result"})
+
+	outboundDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbound_request_duration_seconds",
+		Help:      "Latency of calls to other services by service and status code, 0 for transport errors.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "status"})
+
+	ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "created_total",
+		Help:      "Orders created.",
+	})
+
+	orderStatusChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_changes_total",
+		Help:      "Order status changes by new status.",
+	}, []string{"status"})
+)
+
+// Publish results.
+const (
+	ResultSuccess  = "success"
+	ResultFailure  = "failure"
+	ResultBuffered = "buffered"
+)
+
+// Consume results.
+const (
+	ResultAck        = "ack"
+	ResultRetry      = "retry"
+	ResultRequeue    = "requeue"
+	ResultDeadLetter = "dead_letter"
+)
+
+func ObserveRepositoryOperation(repository string, operation string, duration time.Duration, err error) {
+	repositoryDuration.WithLabelValues(repository, operation).Observe(duration.Seconds())
+	if err != nil {
+		repositoryErrors.WithLabelValues(repository, operation).Inc()
+	}
+}
+
+func ObservePublish(exchange string, result string) {
+	if exchange == "" {
+		exchange = "default"
+	}
+	messagesPublished.WithLabelValues(exchange, result).Inc()
+}
+
+func ObserveConsume(routingKey string, result string) {
+	messagesConsumed.WithLabelValues(routingKey, result).Inc()
+}
+
+func OrderCreated() {
+	ordersCreated.Inc()
+}
+
+func OrderStatusChanged(status string) {
+	orderStatusChanges.WithLabelValues(status).Inc()
+}
+
+// StatusCounter counts orders per status, it is called on every scrape.
+type StatusCounter func(ctx context.Context) (map[string]int64, error)
+
+type ordersByStatusCollector struct {
+	count StatusCounter
+	desc  *prometheus.Desc
+}
+
+// RegisterOrdersByStatus exposes the current number of orders per status as a gauge.
+func RegisterOrdersByStatus(count StatusCounter) {
+	prometheus.MustRegister(&ordersByStatusCollector{
+		count: count,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "by_status"),
+			"Current number of orders by status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+func (c *ordersByStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *ordersByStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := c.count(ctx)
+	if err != nil {
+		log.Printf("Error counting orders by status: %v", err)
+		return
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -2,9 +2,23 @@ package middlewares
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/services"
 	"strings"
 )
 
+var (
+	errUnauthorized = apperrors.New(apperrors.KindUnauthorized, "Unauthorized")
+	errForbidden    = apperrors.New(apperrors.KindForbidden, "Forbidden")
+)
+
+// abort stops the chain, ErrorHandler renders err.
+func abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
 func (m *Middleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -12,19 +26,51 @@ func (m *Middleware) Auth() gin.HandlerFunc {
 		header := strings.Split(auth, " ")
 
 		if len(header) != 2 {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
+			abort(c, errUnauthorized)
 			return
 		}
 
 		token := header[1]
 
-		res, err := m.AuthService.ValidateToken(token)
+		res, err := m.AuthService.ValidateToken(c.Request.Context(), token)
+		// the token may well be valid, the auth service just cannot tell right now
+		if services.IsTransient(err) {
+			abort(c, err)
+			return
+		}
 		if err != nil {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
+			abort(c, errUnauthorized)
 			return
 		}
 
+		// tokens issued before roles existed belong to customers
+		roles := res.Roles
+		if len(roles) == 0 {
+			roles = []models.Role{models.RoleCustomer}
+		}
+
 		c.Set("userId", res.UserId)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
+
+// RequireRole only lets requests through whose caller has the given role or a
+// higher one. It must run after Auth.
+func (m *Middleware) RequireRole(role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("roles")
+		if !exists {
+			abort(c, errUnauthorized)
+			return
+		}
+
+		roles, _ := value.([]models.Role)
+		if !models.HasRole(roles, role) {
+			abort(c, errForbidden)
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/correlation"
+	"log"
+)
+
+// ErrorHandler renders the last error a handler recorded with c.Error as
+// RFC 7807 problem details, unless the handler already wrote a response.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		RenderError(c)
+	}
+}
+
+// RenderError writes the problem details of the last recorded error right away
+// and reports whether it did, for handlers that need to see the final response.
+func RenderError(c *gin.Context) bool {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return false
+	}
+
+	err := c.Errors.Last().Err
+
+	correlationId := correlation.FromContext(c.Request.Context())
+	if correlationId == "" {
+		correlationId = c.GetHeader(correlation.Header)
+	}
+
+	problem := apperrors.NewProblem(err, c.Request.URL.Path, correlationId)
+	if problem.Status >= 500 {
+		log.Printf("%s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+
+	c.Header("Content-Type", apperrors.ProblemContentType)
+	c.JSON(problem.Status, problem)
+	return true
+}
@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/correlation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorHandlerMapsKinds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		kind   apperrors.Kind
+	}{
+		{"not found", apperrors.NotFound("Order not found"), http.StatusNotFound, apperrors.KindNotFound},
+		{"invalid id", apperrors.InvalidID("abc"), http.StatusBadRequest, apperrors.KindInvalidID},
+		{"validation", apperrors.Validation("Validation failed"), http.StatusBadRequest, apperrors.KindValidation},
+		{"conflict", apperrors.Conflict("Order status was changed concurrently", nil), http.StatusConflict, apperrors.KindConflict},
+		{"unprocessable", apperrors.Unprocessable("Order cost does not match", nil), http.StatusUnprocessableEntity, apperrors.KindUnprocessable},
+		{"unauthorized", apperrors.New(apperrors.KindUnauthorized, "Unauthorized"), http.StatusUnauthorized, apperrors.KindUnauthorized},
+		{"forbidden", apperrors.New(apperrors.KindForbidden, "Forbidden"), http.StatusForbidden, apperrors.KindForbidden},
+		{"upstream", apperrors.Upstream("cart", errors.New("503")), http.StatusBadGateway, apperrors.KindUpstream},
+		{"timeout", apperrors.Timeout("Database did not respond in time", nil), http.StatusGatewayTimeout, apperrors.KindTimeout},
+		{"internal", errors.New("boom"), http.StatusInternalServerError, apperrors.KindInternal},
+	}
+
+	for _, tc := range cases {
+		server := gin.New()
+		server.Use(ErrorHandler())
+		server.GET("/orders/:id", func(c *gin.Context) {
+			_ = c.Error(tc.err)
+		})
+
+		req, _ := http.NewRequest("GET", "/orders/abc", nil)
+		req.Header.Set(correlation.Header, "correlation-1")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: got status %d want %d", tc.name, rec.Code, tc.status)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != apperrors.ProblemContentType {
+			t.Errorf("%s: got content type %q want %q", tc.name, contentType, apperrors.ProblemContentType)
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if body["type"] != "/problems/"+string(tc.kind) {
+			t.Errorf("%s: got type %v want /problems/%s", tc.name, body["type"], tc.kind)
+		}
+		if body["status"] != float64(tc.status) {
+			t.Errorf("%s: got status member %v want %d", tc.name, body["status"], tc.status)
+		}
+		if body["instance"] != "/orders/abc" {
+			t.Errorf("%s: got instance %v", tc.name, body["instance"])
+		}
+		if body["correlationId"] != "correlation-1" {
+			t.Errorf("%s: got correlation id %v", tc.name, body["correlationId"])
+		}
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := gin.New()
+	server.Use(ErrorHandler())
+	server.GET("/orders", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"items": []string{}})
+		_ = c.Error(errors.New("publishing failed"))
+	})
+
+	req, _ := http.NewRequest("GET", "/orders", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"items":[]}` {
+		t.Errorf("response was overwritten: %d %s", rec.Code, rec.Body.String())
+	}
+}
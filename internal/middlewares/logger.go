@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/mycandys/orders/internal/env"
-	"github.com/mycandys/orders/internal/rabbitmq"
-	"github.com/mycandys/orders/internal/services"
+	"github.com/mycandys/orders/internal/correlation"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"time"
 )
@@ -71,21 +71,16 @@ func (w bodyLogWriter) Write(b []byte) (int, error) {
 }
 
 func (m *Middleware) Logger() gin.HandlerFunc {
-	queueName, _ := env.GetEnvVar(env.QUEUE_NAME)
-	exchangeName, _ := env.GetEnvVar(env.EXCHANGE_NAME)
-
-	queue := rabbitmq.DeclareQueue(queueName)
-
-	analytics := services.NewAnalyticsService()
-
 	return func(c *gin.Context) {
-		correlationId := c.GetHeader("X-Correlation-Id")
+		correlationId := c.GetHeader(correlation.Header)
 
 		if correlationId == "" {
 			correlationId = uuid.New().String()
 		}
 
-		c.Header("X-Correlation-Id", correlationId)
+		c.Header(correlation.Header, correlationId)
+		c.Request = c.Request.WithContext(correlation.WithID(c.Request.Context(), correlationId))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("correlation.id", correlationId))
 
 		url := c.Request.Host + c.Request.URL.RequestURI()
 
@@ -119,7 +114,9 @@ func (m *Middleware) Logger() gin.HandlerFunc {
 			c.String(http.StatusInternalServerError, "Error marshalling log")
 		}
 
-		analytics.SendEndpointCall(url)
-		rabbitmq.Publish(exchangeName, queue.Name, payload, c.Request.Context())
+		m.analytics.SendEndpointCall(c.Request.Context(), url)
+		if err := m.requestLogs.Publish(c.Request.Context(), payload); err != nil {
+			m.logger.WithError(err).Warn("Error publishing request log")
+		}
 	}
 }
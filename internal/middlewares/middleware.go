@@ -1,18 +1,28 @@
 package middlewares
 
 import (
+	"context"
 	"github.com/mycandys/orders/internal/services"
 	"github.com/sirupsen/logrus"
 )
 
+// RequestLogPublisher receives the JSON log entry of every request.
+type RequestLogPublisher interface {
+	Publish(ctx context.Context, body []byte) error
+}
+
 type Middleware struct {
 	AuthService services.IAuthService
+	analytics   services.IAnalyticsService
+	requestLogs RequestLogPublisher
 	logger      *logrus.Logger
 }
 
-func NewMiddleware() *Middleware {
+func NewMiddleware(auth services.IAuthService, analytics services.IAnalyticsService, requestLogs RequestLogPublisher) *Middleware {
 	return &Middleware{
-		AuthService: services.NewAuthService(),
+		AuthService: auth,
+		analytics:   analytics,
+		requestLogs: requestLogs,
 		logger:      logrus.New(),
 	}
 }
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/mycandys/orders/internal/services"
 	"github.com/stretchr/testify/mock"
 )
@@ -9,12 +10,12 @@ type AuthServiceMock struct {
 	mock.Mock
 }
 
-func (_m *AuthServiceMock) ValidateToken(token string) (*services.VerifyTokenResponse, error) {
-	ret := _m.Called(token)
+func (_m *AuthServiceMock) ValidateToken(ctx context.Context, token string) (*services.VerifyTokenResponse, error) {
+	ret := _m.Called(ctx, token)
 
 	var r0 *services.VerifyTokenResponse
-	if rf, ok := ret.Get(0).(func(string) *services.VerifyTokenResponse); ok {
-		r0 = rf(token)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *services.VerifyTokenResponse); ok {
+		r0 = rf(ctx, token)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*services.VerifyTokenResponse)
@@ -22,8 +23,8 @@ func (_m *AuthServiceMock) ValidateToken(token string) (*services.VerifyTokenRes
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(token)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
 	} else {
 		r1 = ret.Error(1)
 	}
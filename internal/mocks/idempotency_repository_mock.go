@@ -0,0 +1,59 @@
+package mocks
+
+import (
+	"context"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/stretchr/testify/mock"
+)
+
+type IdempotencyRepositoryMock struct {
+	mock.Mock
+}
+
+func (_m *IdempotencyRepositoryMock) Reserve(ctx context.Context, key string, requestHash string) (*repository.IdempotencyRecord, error) {
+	ret := _m.Called(ctx, key, requestHash)
+
+	var r0 *repository.IdempotencyRecord
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *repository.IdempotencyRecord); ok {
+		r0 = rf(ctx, key, requestHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.IdempotencyRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, key, requestHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *IdempotencyRepositoryMock) Complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	ret := _m.Called(ctx, key, status, contentType, body)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, string, []byte) error); ok {
+		r0 = rf(ctx, key, status, contentType, body)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+func (_m *IdempotencyRepositoryMock) Release(ctx context.Context, key string) error {
+	ret := _m.Called(ctx, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -1,30 +1,31 @@
 package mocks
 
 import (
+	"context"
 	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
 	"github.com/stretchr/testify/mock"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 type OrderRepositoryMock struct {
 	mock.Mock
 }
 
-func (_m *OrderRepositoryMock) FindAll() ([]*models.Order, error) {
-	ret := _m.Called()
+func (_m *OrderRepositoryMock) FindAll(ctx context.Context, query repository.OrderQuery) (*repository.Page[*models.Order], error) {
+	ret := _m.Called(ctx, query)
 
-	var r0 []*models.Order
-	if rf, ok := ret.Get(0).(func() []*models.Order); ok {
-		r0 = rf()
+	var r0 *repository.Page[*models.Order]
+	if rf, ok := ret.Get(0).(func(context.Context, repository.OrderQuery) *repository.Page[*models.Order]); ok {
+		r0 = rf(ctx, query)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*models.Order)
+			r0 = ret.Get(0).(*repository.Page[*models.Order])
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context, repository.OrderQuery) error); ok {
+		r1 = rf(ctx, query)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -32,21 +33,21 @@ func (_m *OrderRepositoryMock) FindAll() ([]*models.Order, error) {
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) FindByUser(id string) ([]*models.Order, error) {
-	ret := _m.Called(id)
+func (_m *OrderRepositoryMock) FindByUser(ctx context.Context, id string, query repository.OrderQuery) (*repository.Page[*models.Order], error) {
+	ret := _m.Called(ctx, id, query)
 
-	var r0 []*models.Order
-	if rf, ok := ret.Get(0).(func(string) []*models.Order); ok {
-		r0 = rf(id)
+	var r0 *repository.Page[*models.Order]
+	if rf, ok := ret.Get(0).(func(context.Context, string, repository.OrderQuery) *repository.Page[*models.Order]); ok {
+		r0 = rf(ctx, id, query)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*models.Order)
+			r0 = ret.Get(0).(*repository.Page[*models.Order])
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, repository.OrderQuery) error); ok {
+		r1 = rf(ctx, id, query)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -54,12 +55,12 @@ func (_m *OrderRepositoryMock) FindByUser(id string) ([]*models.Order, error) {
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) FindOne(id string) (*models.Order, error) {
-	ret := _m.Called(id)
+func (_m *OrderRepositoryMock) FindOne(ctx context.Context, id string) (*models.Order, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 *models.Order
-	if rf, ok := ret.Get(0).(func(string) *models.Order); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.Order); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Order)
@@ -67,8 +68,8 @@ func (_m *OrderRepositoryMock) FindOne(id string) (*models.Order, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -76,21 +77,21 @@ func (_m *OrderRepositoryMock) FindOne(id string) (*models.Order, error) {
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) FindByStatus(status models.OrderStatus) ([]*models.Order, error) {
-	ret := _m.Called(status)
+func (_m *OrderRepositoryMock) FindByStatus(ctx context.Context, status models.OrderStatus, query repository.OrderQuery) (*repository.Page[*models.Order], error) {
+	ret := _m.Called(ctx, status, query)
 
-	var r0 []*models.Order
-	if rf, ok := ret.Get(0).(func(models.OrderStatus) []*models.Order); ok {
-		r0 = rf(status)
+	var r0 *repository.Page[*models.Order]
+	if rf, ok := ret.Get(0).(func(context.Context, models.OrderStatus, repository.OrderQuery) *repository.Page[*models.Order]); ok {
+		r0 = rf(ctx, status, query)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*models.Order)
+			r0 = ret.Get(0).(*repository.Page[*models.Order])
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(models.OrderStatus) error); ok {
-		r1 = rf(status)
+	if rf, ok := ret.Get(1).(func(context.Context, models.OrderStatus, repository.OrderQuery) error); ok {
+		r1 = rf(ctx, status, query)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -98,12 +99,12 @@ func (_m *OrderRepositoryMock) FindByStatus(status models.OrderStatus) ([]*model
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) InsertOne(order models.CreateOrderDTO) (*models.Order, error) {
-	ret := _m.Called(order)
+func (_m *OrderRepositoryMock) InsertOne(ctx context.Context, order *models.Order) (*models.Order, error) {
+	ret := _m.Called(ctx, order)
 
 	var r0 *models.Order
-	if rf, ok := ret.Get(0).(func(models.CreateOrderDTO) *models.Order); ok {
-		r0 = rf(order)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Order) *models.Order); ok {
+		r0 = rf(ctx, order)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Order)
@@ -111,8 +112,8 @@ func (_m *OrderRepositoryMock) InsertOne(order models.CreateOrderDTO) (*models.O
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(models.CreateOrderDTO) error); ok {
-		r1 = rf(order)
+	if rf, ok := ret.Get(1).(func(context.Context, *models.Order) error); ok {
+		r1 = rf(ctx, order)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -120,12 +121,12 @@ func (_m *OrderRepositoryMock) InsertOne(order models.CreateOrderDTO) (*models.O
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) UpdateOne(id string, order models.UpdateOrderDTO) (*models.Order, error) {
-	ret := _m.Called(id, order)
+func (_m *OrderRepositoryMock) UpdateOne(ctx context.Context, id string, order models.UpdateOrderDTO) (*models.Order, error) {
+	ret := _m.Called(ctx, id, order)
 
 	var r0 *models.Order
-	if rf, ok := ret.Get(0).(func(string, models.UpdateOrderDTO) *models.Order); ok {
-		r0 = rf(id, order)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.UpdateOrderDTO) *models.Order); ok {
+		r0 = rf(ctx, id, order)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Order)
@@ -133,8 +134,8 @@ func (_m *OrderRepositoryMock) UpdateOne(id string, order models.UpdateOrderDTO)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, models.UpdateOrderDTO) error); ok {
-		r1 = rf(id, order)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.UpdateOrderDTO) error); ok {
+		r1 = rf(ctx, id, order)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -142,12 +143,12 @@ func (_m *OrderRepositoryMock) UpdateOne(id string, order models.UpdateOrderDTO)
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) DeleteOne(id string) (*models.Order, error) {
-	ret := _m.Called(id)
+func (_m *OrderRepositoryMock) Cancel(ctx context.Context, id string, cancellation models.Cancellation) (*models.Order, error) {
+	ret := _m.Called(ctx, id, cancellation)
 
 	var r0 *models.Order
-	if rf, ok := ret.Get(0).(func(string) *models.Order); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.Cancellation) *models.Order); ok {
+		r0 = rf(ctx, id, cancellation)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Order)
@@ -155,8 +156,8 @@ func (_m *OrderRepositoryMock) DeleteOne(id string) (*models.Order, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.Cancellation) error); ok {
+		r1 = rf(ctx, id, cancellation)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -164,21 +165,21 @@ func (_m *OrderRepositoryMock) DeleteOne(id string) (*models.Order, error) {
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) FindMany(filter bson.D) ([]*models.Order, error) {
-	ret := _m.Called(filter)
+func (_m *OrderRepositoryMock) CompareAndSwap(ctx context.Context, id string, version int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	ret := _m.Called(ctx, id, version, data)
 
-	var r0 []*models.Order
-	if rf, ok := ret.Get(0).(func(bson.D) []*models.Order); ok {
-		r0 = rf(filter)
+	var r0 *models.Order
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, models.UpdateOrderDTO) *models.Order); ok {
+		r0 = rf(ctx, id, version, data)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*models.Order)
+			r0 = ret.Get(0).(*models.Order)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(bson.D) error); ok {
-		r1 = rf(filter)
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, models.UpdateOrderDTO) error); ok {
+		r1 = rf(ctx, id, version, data)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -186,35 +187,78 @@ func (_m *OrderRepositoryMock) FindMany(filter bson.D) ([]*models.Order, error)
 	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) FindByUserAndStatus(id string, status models.OrderStatus) ([]*models.Order, error) {
-	ret := _m.Called(id, status)
+func (_m *OrderRepositoryMock) DeleteOne(ctx context.Context, id string) (*models.Order, error) {
+	ret := _m.Called(ctx, id)
 
-	var r0 []*models.Order
-	if rf, ok := ret.Get(0).(func(string, models.OrderStatus) []*models.Order); ok {
-		r0 = rf(id, status)
+	var r0 *models.Order
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.Order); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*models.Order)
+			r0 = ret.Get(0).(*models.Order)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, models.OrderStatus) error); ok {
-		r1 = rf(id, status)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
 
 	return r0, r1
+}
+
+func (_m *OrderRepositoryMock) FindMany(ctx context.Context, query repository.OrderQuery) (*repository.Page[*models.Order], error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *repository.Page[*models.Order]
+	if rf, ok := ret.Get(0).(func(context.Context, repository.OrderQuery) *repository.Page[*models.Order]); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Page[*models.Order])
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, repository.OrderQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
 
+	return r0, r1
+}
+
+func (_m *OrderRepositoryMock) FindByUserAndStatus(ctx context.Context, id string, status models.OrderStatus, query repository.OrderQuery) (*repository.Page[*models.Order], error) {
+	ret := _m.Called(ctx, id, status, query)
+
+	var r0 *repository.Page[*models.Order]
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.OrderStatus, repository.OrderQuery) *repository.Page[*models.Order]); ok {
+		r0 = rf(ctx, id, status, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Page[*models.Order])
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.OrderStatus, repository.OrderQuery) error); ok {
+		r1 = rf(ctx, id, status, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-func (_m *OrderRepositoryMock) DeleteMany(filter bson.D) error {
-	ret := _m.Called(filter)
+func (_m *OrderRepositoryMock) DeleteMany(ctx context.Context, query repository.OrderQuery) error {
+	ret := _m.Called(ctx, query)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(bson.D) error); ok {
-		r0 = rf(filter)
+	if rf, ok := ret.Get(0).(func(context.Context, repository.OrderQuery) error); ok {
+		r0 = rf(ctx, query)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -222,12 +266,12 @@ func (_m *OrderRepositoryMock) DeleteMany(filter bson.D) error {
 	return r0
 }
 
-func (_m *OrderRepositoryMock) DeleteAllByUser(id string) error {
-	ret := _m.Called(id)
+func (_m *OrderRepositoryMock) DeleteAllByUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -235,12 +279,12 @@ func (_m *OrderRepositoryMock) DeleteAllByUser(id string) error {
 	return r0
 }
 
-func (_m *OrderRepositoryMock) DeleteAll() error {
-	ret := _m.Called()
+func (_m *OrderRepositoryMock) DeleteAll(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func() error); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,145 @@
+package mocks
+
+import (
+	"context"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReturnRepositoryMock struct {
+	mock.Mock
+}
+
+func (_m *ReturnRepositoryMock) FindOne(ctx context.Context, id string) (*models.Return, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *models.Return
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.Return); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Return)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *ReturnRepositoryMock) FindMany(ctx context.Context, query repository.ReturnQuery) (*repository.Page[*models.Return], error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *repository.Page[*models.Return]
+	if rf, ok := ret.Get(0).(func(context.Context, repository.ReturnQuery) *repository.Page[*models.Return]); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Page[*models.Return])
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, repository.ReturnQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *ReturnRepositoryMock) FindByOrder(ctx context.Context, orderId primitive.ObjectID) ([]*models.Return, error) {
+	ret := _m.Called(ctx, orderId)
+
+	var r0 []*models.Return
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) []*models.Return); ok {
+		r0 = rf(ctx, orderId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*models.Return)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, orderId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *ReturnRepositoryMock) InsertOne(ctx context.Context, r *models.Return) (*models.Return, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 *models.Return
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Return) *models.Return); ok {
+		r0 = rf(ctx, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Return)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *models.Return) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *ReturnRepositoryMock) Approve(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	ret := _m.Called(ctx, id, reviewer, note)
+
+	var r0 *models.Return
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *models.Return); ok {
+		r0 = rf(ctx, id, reviewer, note)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Return)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, id, reviewer, note)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *ReturnRepositoryMock) Reject(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	ret := _m.Called(ctx, id, reviewer, note)
+
+	var r0 *models.Return
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *models.Return); ok {
+		r0 = rf(ctx, id, reviewer, note)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Return)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, id, reviewer, note)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
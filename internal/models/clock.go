@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Now is the clock of every timestamp stored with orders and returns. The
+// timestamps are strings compared as text, so they are all written in UTC.
+func Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Timestamp returns the current time formatted the way order and return
+// timestamps are stored.
+func Timestamp() string {
+	return Now().Format(time.DateTime)
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type OrderEventType string
+
+const (
+	OrderCreated       OrderEventType = "OrderCreated"
+	OrderStatusChanged OrderEventType = "OrderStatusChanged"
+	OrderDeleted       OrderEventType = "OrderDeleted"
+)
+
+// OrderEvent is a domain event written to the outbox in the same transaction
+// as the order change it describes.
+type OrderEvent struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	Type           OrderEventType     `bson:"type" json:"type"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"orderId"`
+	UserID         string             `bson:"user_id" json:"userId"`
+	Order          *Order             `bson:"order" json:"order"`
+	PreviousStatus OrderStatus        `bson:"previous_status,omitempty" json:"previousStatus,omitempty"`
+	CorrelationID  string             `bson:"correlation_id,omitempty" json:"correlationId,omitempty"`
+	// TraceContext carries the W3C trace context of the request that caused the event to the relay.
+	TraceContext map[string]string `bson:"trace_context,omitempty" json:"-"`
+	OccurredAt   time.Time         `bson:"occurred_at" json:"occurredAt"`
+}
+
+func NewOrderEvent(eventType OrderEventType, order *Order) *OrderEvent {
+	return &OrderEvent{
+		ID:         primitive.NewObjectID(),
+		Type:       eventType,
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		Order:      order,
+		OccurredAt: Now(),
+	}
+}
+
+// OrderEventSchemaVersion is bumped on every breaking change to OrderEventMessage.
+const OrderEventSchemaVersion = 1
+
+// Routing keys of the order events other services can subscribe to.
+const (
+	OrderCreatedRoutingKey       = "order.created"
+	OrderStatusChangedRoutingKey = "order.status_changed"
+	OrderCancelledRoutingKey     = "order.cancelled"
+	OrderDeletedRoutingKey       = "order.deleted"
+)
+
+// RoutingKey is the topic the event is published under. Cancellations get their
+// own key so consumers releasing stock do not have to inspect every status change.
+func (e *OrderEvent) RoutingKey() string {
+	switch e.Type {
+	case OrderCreated:
+		return OrderCreatedRoutingKey
+	case OrderDeleted:
+		return OrderDeletedRoutingKey
+	default:
+		if e.Order != nil && e.Order.Status == OrderStatusCancelled {
+			return OrderCancelledRoutingKey
+		}
+		return OrderStatusChangedRoutingKey
+	}
+}
+
+// OrderEventMessage is the public, versioned shape of an order event on the message broker.
+type OrderEventMessage struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	OccurredAt    time.Time         `json:"occurredAt"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	Data          OrderEventPayload `json:"data"`
+}
+
+type OrderEventPayload struct {
+	OrderID        string      `json:"orderId"`
+	UserID         string      `json:"userId"`
+	Status         OrderStatus `json:"status,omitempty"`
+	PreviousStatus OrderStatus `json:"previousStatus,omitempty"`
+	Order          *Order      `json:"order,omitempty"`
+}
+
+func NewOrderEventMessage(event *OrderEvent) *OrderEventMessage {
+	payload := OrderEventPayload{
+		OrderID:        event.OrderID.Hex(),
+		UserID:         event.UserID,
+		PreviousStatus: event.PreviousStatus,
+		Order:          event.Order,
+	}
+	if event.Order != nil {
+		payload.Status = event.Order.Status
+	}
+
+	return &OrderEventMessage{
+		SchemaVersion: OrderEventSchemaVersion,
+		ID:            event.ID.Hex(),
+		Type:          event.RoutingKey(),
+		OccurredAt:    event.OccurredAt,
+		CorrelationID: event.CorrelationID,
+		Data:          payload,
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"math"
+	"strings"
+)
+
+// LegacyCurrency is the currency of documents written before prices carried one.
+const LegacyCurrency = "EUR"
+
+// Money is an exact amount in the minor units (e.g. cents) of an ISO 4217 currency.
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// MoneyFromFloat converts a decimal amount in major units, rounding half away from zero.
+func MoneyFromFloat(value float64, currency string) Money {
+	scale := math.Pow10(currencyExponent(currency))
+	return NewMoney(int64(math.Round(value*scale)), currency)
+}
+
+// currencyExponent returns the number of minor unit digits of a currency.
+func currencyExponent(currency string) int {
+	switch strings.ToUpper(currency) {
+	case "JPY", "KRW", "ISK", "CLP", "VND":
+		return 0
+	default:
+		return 2
+	}
+}
+
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(currencyExponent(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+// Add sums two amounts of the same currency. Adding to a zero value adopts the other currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency == "" && m.Amount == 0 {
+		return other, nil
+	}
+	if !m.SameCurrency(other) {
+		return Money{}, &CurrencyMismatchError{Expected: m.Currency, Actual: other.Currency}
+	}
+	return NewMoney(m.Amount+other.Amount, m.Currency), nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(NewMoney(-other.Amount, other.Currency))
+}
+
+func (m Money) Multiply(quantity int64) Money {
+	return NewMoney(m.Amount*quantity, m.Currency)
+}
+
+// Percent returns rate percent of the amount rounded to the nearest minor unit.
+func (m Money) Percent(rate float64) Money {
+	return NewMoney(int64(math.Round(float64(m.Amount)*rate/100)), m.Currency)
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%.*f %s", currencyExponent(m.Currency), m.Float(), m.Currency)
+}
+
+// UnmarshalBSONValue reads both the current {amount, currency} document and the
+// legacy plain number documents from the orders collection.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+
+	switch t {
+	case bsontype.Double:
+		*m = MoneyFromFloat(value.Double(), LegacyCurrency)
+	case bsontype.Int32:
+		*m = MoneyFromFloat(float64(value.Int32()), LegacyCurrency)
+	case bsontype.Int64:
+		*m = MoneyFromFloat(float64(value.Int64()), LegacyCurrency)
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	case bsontype.EmbeddedDocument:
+		type money Money
+		return bson.Unmarshal(data, (*money)(m))
+	default:
+		return fmt.Errorf("cannot decode %s into models.Money", t)
+	}
+
+	return nil
+}
+
+var _ bson.ValueUnmarshaler = (*Money)(nil)
+
+const CurrencyMismatchReason = "currency_mismatch"
+
+type CurrencyMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("expected currency %s but got %s", e.Expected, e.Actual)
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestMoneyFromFloat(t *testing.T) {
+	cases := []struct {
+		value    float64
+		currency string
+		want     Money
+	}{
+		{12.34, "eur", NewMoney(1234, "EUR")},
+		{0.125, "EUR", NewMoney(13, "EUR")},
+		{-0.125, "EUR", NewMoney(-13, "EUR")},
+		{0.1 + 0.2, "EUR", NewMoney(30, "EUR")},
+		{1999.5, "JPY", NewMoney(2000, "JPY")},
+		{0, "USD", NewMoney(0, "USD")},
+	}
+
+	for _, tc := range cases {
+		if got := MoneyFromFloat(tc.value, tc.currency); got != tc.want {
+			t.Errorf("%v %s: got %+v want %+v", tc.value, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	cases := []struct {
+		amount int64
+		rate   float64
+		want   int64
+	}{
+		{1000, 19, 190},
+		{999, 19, 190},
+		{50, 1, 1},
+		{49, 1, 0},
+		{1000, 0, 0},
+		{333, 7.5, 25},
+	}
+
+	for _, tc := range cases {
+		if got := NewMoney(tc.amount, "EUR").Percent(tc.rate); got != NewMoney(tc.want, "EUR") {
+			t.Errorf("%v%% of %d: got %+v want %d", tc.rate, tc.amount, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	sum, err := NewMoney(100, "EUR").Add(NewMoney(50, "EUR"))
+	if err != nil || sum != NewMoney(150, "EUR") {
+		t.Errorf("got %+v and %v want 150 EUR", sum, err)
+	}
+
+	sum, err = Money{}.Add(NewMoney(50, "USD"))
+	if err != nil || sum != NewMoney(50, "USD") {
+		t.Errorf("adding to the zero value: got %+v and %v want 50 USD", sum, err)
+	}
+
+	difference, err := NewMoney(100, "EUR").Sub(NewMoney(30, "EUR"))
+	if err != nil || difference != NewMoney(70, "EUR") {
+		t.Errorf("got %+v and %v want 70 EUR", difference, err)
+	}
+
+	_, err = NewMoney(100, "EUR").Add(NewMoney(50, "USD"))
+
+	var currencyErr *CurrencyMismatchError
+	if !errors.As(err, &currencyErr) || currencyErr.Expected != "EUR" || currencyErr.Actual != "USD" {
+		t.Errorf("got %v want a currency mismatch", err)
+	}
+}
+
+func TestMoneyUnmarshalBSONValue(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  Money
+	}{
+		{"document", bson.D{{Key: "amount", Value: int64(1234)}, {Key: "currency", Value: "USD"}}, NewMoney(1234, "USD")},
+		{"legacy double", 12.345, NewMoney(1235, LegacyCurrency)},
+		{"legacy int32", int32(12), NewMoney(1200, LegacyCurrency)},
+		{"legacy int64", int64(12), NewMoney(1200, LegacyCurrency)},
+		{"null", nil, Money{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.D{{Key: "price", Value: tc.value}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded struct {
+				Price Money `bson:"price"`
+			}
+			if err := bson.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Price != tc.want {
+				t.Errorf("got %+v want %+v", decoded.Price, tc.want)
+			}
+		})
+	}
+
+	data, _ := bson.Marshal(bson.D{{Key: "price", Value: "12.34"}})
+
+	var decoded struct {
+		Price Money `bson:"price"`
+	}
+	if err := bson.Unmarshal(data, &decoded); err == nil {
+		t.Error("decoded a string into money")
+	}
+}
+
+func TestOrderUnmarshalLegacyCost(t *testing.T) {
+	data, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "cost", Value: 19.99},
+		{Key: "items", Value: bson.A{bson.D{{Key: "_id", Value: "1"}, {Key: "price", Value: 9.95}, {Key: "quantity", Value: 2}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order Order
+	if err := bson.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	want := PriceBreakdown{
+		Subtotal: NewMoney(1999, LegacyCurrency),
+		Tax:      NewMoney(0, LegacyCurrency),
+		Shipping: NewMoney(0, LegacyCurrency),
+		Discount: NewMoney(0, LegacyCurrency),
+		Total:    NewMoney(1999, LegacyCurrency),
+	}
+	if order.Price != want {
+		t.Errorf("got price %+v want %+v", order.Price, want)
+	}
+	if order.Items[0].Price != NewMoney(995, LegacyCurrency) {
+		t.Errorf("got item price %+v want 9.95 EUR", order.Items[0].Price)
+	}
+
+	// orders with a price breakdown ignore a leftover cost
+	data, _ = bson.Marshal(bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "cost", Value: 1.0},
+		{Key: "price", Value: bson.D{{Key: "total", Value: bson.D{{Key: "amount", Value: int64(500)}, {Key: "currency", Value: "USD"}}}}},
+	})
+	order = Order{}
+	if err := bson.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Price.Total != NewMoney(500, "USD") {
+		t.Errorf("got total %+v want 5.00 USD", order.Price.Total)
+	}
+}
@@ -1,47 +1,222 @@
 package models
 
 import (
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
 	"time"
 )
 
 type Item struct {
-	ID          string  `bson:"_id" json:"id"`
-	Name        string  `bson:"name" json:"name"`
-	Price       float64 `bson:"price" json:"price"`
-	Description string  `bson:"description" json:"description"`
-	Category    string  `bson:"category" json:"category"`
-	ImageUrl    string  `bson:"image_url" json:"imgUrl"`
-	Quantity    int     `bson:"quantity" json:"quantity"`
+	ID          string `bson:"_id" json:"id" binding:"required,max=64"`
+	Name        string `bson:"name" json:"name" binding:"required,max=200"`
+	Price       Money  `bson:"price" json:"price" binding:"positive_money"`
+	Description string `bson:"description" json:"description" binding:"max=2000"`
+	Category    string `bson:"category" json:"category" binding:"max=100"`
+	ImageUrl    string `bson:"image_url" json:"imgUrl" binding:"omitempty,url,max=2000"`
+	Quantity    int    `bson:"quantity" json:"quantity" binding:"gt=0,lte=1000"`
 }
 
 type OrderStatus string
 
 const (
 	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
 	OrderStatusShipped   OrderStatus = "shipped"
 	OrderStatusDelivered OrderStatus = "delivered"
-	//OrderStatusCancelled OrderStatus = "cancelled"
-	//OrderStatusReturned  OrderStatus = "returned"
-	//OrderStatusRefunded  OrderStatus = "refunded"
-	//OrderStatusFailed    OrderStatus = "failed"
-	//OrderStatusPaid     OrderStatus = "paid"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusReturned  OrderStatus = "returned"
+	OrderStatusRefunded  OrderStatus = "refunded"
+	OrderStatusFailed    OrderStatus = "failed"
 )
 
+// orderStatusTransitions is the single source of truth for order statuses:
+// every valid status is a key and maps to the statuses an order may move to next.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusShipped, OrderStatusCancelled, OrderStatusFailed},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusReturned},
+	OrderStatusReturned:  {OrderStatusRefunded},
+	// a retried payment may still succeed after the first attempt failed
+	OrderStatusFailed:    {OrderStatusPending, OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusCancelled: {OrderStatusRefunded},
+	OrderStatusRefunded:  {},
+}
+
 func IsOrderStatusValid(status string) bool {
-	switch status {
-	case "pending", "shipped", "delivered":
-		return true
-	default:
+	_, ok := orderStatusTransitions[OrderStatus(status)]
+	return ok
+}
+
+// CanTransition reports whether an order in status from may be moved to status to.
+// Keeping the same status is always allowed so repeated updates stay idempotent.
+func CanTransition(from OrderStatus, to OrderStatus) bool {
+	if !IsOrderStatusValid(string(from)) || !IsOrderStatusValid(string(to)) {
 		return false
 	}
+
+	if from == to {
+		return true
+	}
+
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PreviousStatuses returns every status from which an order may be moved to status to,
+// including to itself.
+func PreviousStatuses(to OrderStatus) []OrderStatus {
+	statuses := make([]OrderStatus, 0)
+	for from := range orderStatusTransitions {
+		if CanTransition(from, to) {
+			statuses = append(statuses, from)
+		}
+	}
+	// map order is random, filters and logs built from the result should not be
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+	return statuses
+}
+
+const StatusTransitionReason = "invalid_status_transition"
+
+type StatusTransitionError struct {
+	From OrderStatus `json:"from"`
+	To   OrderStatus `json:"to"`
+}
+
+func (e *StatusTransitionError) Error() string {
+	return fmt.Sprintf("order status cannot change from %s to %s", e.From, e.To)
+}
+
+// Conflict describes the rejected transition as an error for the client.
+func (e *StatusTransitionError) Conflict() *apperrors.Error {
+	return apperrors.Conflict(e.Error(), e).
+		With("reason", StatusTransitionReason).
+		With("from", e.From).
+		With("to", e.To)
+}
+
+func ValidateStatusTransition(from OrderStatus, to OrderStatus) error {
+	if !CanTransition(from, to) {
+		return &StatusTransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+const NotCancellableReason = "order_not_cancellable"
+
+// cancellableStatuses are the statuses an order can still be cancelled in, it
+// is too late once the order left the warehouse.
+var cancellableStatuses = []OrderStatus{OrderStatusPending, OrderStatusPaid}
+
+func CanCancel(status OrderStatus) bool {
+	for _, cancellable := range cancellableStatuses {
+		if status == cancellable {
+			return true
+		}
+	}
+	return false
+}
+
+// CancellableStatuses returns the statuses an order can be cancelled in.
+func CancellableStatuses() []OrderStatus {
+	return append([]OrderStatus(nil), cancellableStatuses...)
+}
+
+type NotCancellableError struct {
+	Status OrderStatus `json:"status"`
+}
+
+func (e *NotCancellableError) Error() string {
+	return fmt.Sprintf("order cannot be cancelled while it is %s", e.Status)
+}
+
+// Conflict describes the rejected cancellation as an error for the client.
+func (e *NotCancellableError) Conflict() *apperrors.Error {
+	return apperrors.Conflict(e.Error(), e).
+		With("reason", NotCancellableReason).
+		With("orderStatus", e.Status)
+}
+
+func ValidateCancellation(status OrderStatus) error {
+	if !CanCancel(status) {
+		return &NotCancellableError{Status: status}
+	}
+	return nil
+}
+
+const AddressNotEditableReason = "address_not_editable"
+
+// addressEditableStatuses are the statuses the shipping address may still
+// change in, once the order is paid it is being packed for that address.
+var addressEditableStatuses = []OrderStatus{OrderStatusPending}
+
+// AddressEditableStatuses returns the statuses the shipping address may change in.
+func AddressEditableStatuses() []OrderStatus {
+	return append([]OrderStatus(nil), addressEditableStatuses...)
+}
+
+type AddressNotEditableError struct {
+	Status OrderStatus `json:"status"`
+}
+
+func (e *AddressNotEditableError) Error() string {
+	return fmt.Sprintf("the shipping address cannot change while the order is %s", e.Status)
+}
+
+// Conflict describes the rejected address change as an error for the client.
+func (e *AddressNotEditableError) Conflict() *apperrors.Error {
+	return apperrors.Conflict(e.Error(), e).
+		With("reason", AddressNotEditableReason).
+		With("orderStatus", e.Status)
+}
+
+func ValidateAddressChange(status OrderStatus) error {
+	for _, editable := range addressEditableStatuses {
+		if status == editable {
+			return nil
+		}
+	}
+	return &AddressNotEditableError{Status: status}
+}
+
+// Cancellation records why and when an order was cancelled through the API.
+type Cancellation struct {
+	Reason      string `bson:"reason" json:"reason"`
+	CancelledBy string `bson:"cancelled_by" json:"cancelledBy"`
+	CancelledAt string `bson:"cancelled_at" json:"cancelledAt"`
+}
+
+func NewCancellation(reason string, cancelledBy string) Cancellation {
+	return Cancellation{
+		Reason:      reason,
+		CancelledBy: cancelledBy,
+		CancelledAt: Timestamp(),
+	}
+}
+
+// PriceBreakdown is the server side calculated price of an order.
+type PriceBreakdown struct {
+	Subtotal Money `bson:"subtotal" json:"subtotal"`
+	Tax      Money `bson:"tax" json:"tax"`
+	Shipping Money `bson:"shipping" json:"shipping"`
+	Discount Money `bson:"discount" json:"discount"`
+	Total    Money `bson:"total" json:"total"`
 }
 
 type Order struct {
 	ID                   primitive.ObjectID `bson:"_id" json:"id"`
 	UserID               string             `bson:"user_id" json:"userId"`
 	Items                []Item             `bson:"items" json:"items"`
-	Cost                 float64            `bson:"cost" json:"cost"`
+	Price                PriceBreakdown     `bson:"price" json:"price"`
 	Status               OrderStatus        `bson:"status" json:"status"`
 	ExpectedDeliveryDate string             `bson:"expected_delivery_date" json:"expectedDeliveryDate"`
 	DeliveredAt          string             `bson:"delivered_at" json:"deliveredAt"`
@@ -49,40 +224,156 @@ type Order struct {
 	Country              string             `bson:"country" json:"country"`
 	City                 string             `bson:"city" json:"city"`
 	PostalCode           string             `bson:"postal_code" json:"postalCode"`
+	CartID               string             `bson:"cart_id" json:"cartId"`
+	Notes                string             `bson:"notes,omitempty" json:"notes,omitempty"`
+	Cancellation         *Cancellation      `bson:"cancellation,omitempty" json:"cancellation,omitempty"`
 	CreatedAt            string             `bson:"created_at" json:"createdAt"`
 	UpdatedAt            string             `bson:"updated_at" json:"updatedAt"`
+	// Version is incremented on every write, orders stored before versions
+	// existed are at version 0.
+	Version int64 `bson:"version" json:"version"`
+}
+
+// UnmarshalBSON decodes an order, filling the price breakdown of legacy
+// documents that only stored a single cost number.
+func (o *Order) UnmarshalBSON(data []byte) error {
+	type order Order
+	if err := bson.Unmarshal(data, (*order)(o)); err != nil {
+		return err
+	}
+
+	raw := bson.Raw(data)
+	if _, err := raw.LookupErr("price"); err == nil {
+		return nil
+	}
+
+	cost, err := raw.LookupErr("cost")
+	if err != nil {
+		return nil
+	}
+
+	var total Money
+	if err := total.UnmarshalBSONValue(cost.Type, cost.Value); err != nil {
+		return err
+	}
+
+	o.Price = PriceBreakdown{
+		Subtotal: total,
+		Tax:      NewMoney(0, total.Currency),
+		Shipping: NewMoney(0, total.Currency),
+		Discount: NewMoney(0, total.Currency),
+		Total:    total,
+	}
+
+	return nil
 }
 
-func NewOrder(dto CreateOrderDTO) *Order {
-	expectedDeliveryDate := time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+func NewOrder(dto CreateOrderDTO, price PriceBreakdown) *Order {
+	expectedDeliveryDate := Now().AddDate(0, 0, 7).Format(time.DateOnly)
 
 	return &Order{
 		ID:                   primitive.NewObjectID(),
 		UserID:               dto.UserId,
 		Items:                dto.Items,
-		Cost:                 dto.Cost,
+		Price:                price,
 		Status:               OrderStatusPending,
 		ExpectedDeliveryDate: expectedDeliveryDate,
 		Address:              dto.Address,
 		Country:              dto.Country,
 		City:                 dto.City,
 		PostalCode:           dto.PostalCode,
-		CreatedAt:            time.Now().Format(time.DateTime),
+		CartID:               dto.CartID,
+		CreatedAt:            Timestamp(),
 	}
 }
 
 type CreateOrderDTO struct {
-	UserId     string  `json:"userId"`
-	Items      []Item  `json:"items"`
-	Cost       float64 `json:"cost"`
-	Address    string  `json:"address"`
-	Country    string  `json:"country"`
-	City       string  `json:"city"`
-	PostalCode string  `json:"postalCode"`
-	CartID     string  `json:"cartId"`
+	UserId  string `json:"userId" binding:"required,max=64"`
+	Items   []Item `json:"items" binding:"required,min=1,max=100,dive"`
+	Cost    Money  `json:"cost" binding:"positive_money"`
+	Address string `json:"address" binding:"required,max=200"`
+	// Country is an ISO 3166-1 alpha-2 code, PostalCode must match its format.
+	Country    string `json:"country" binding:"required,iso3166_1_alpha2"`
+	City       string `json:"city" binding:"required,max=100"`
+	PostalCode string `json:"postalCode" binding:"required,postal_code=Country"`
+	CartID     string `json:"cartId" binding:"max=64"`
 }
 
+type CancelOrderDTO struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// UpdateOrderDTO is the body of PUT /orders/{id} and the change a repository
+// writes. Nil fields keep their value, the fields without JSON name can only
+// be changed through an OrderPatch.
 type UpdateOrderDTO struct {
-	Status      *OrderStatus `json:"status"`
-	DeliveredAt *string      `json:"deliveredAt"`
+	Status      *OrderStatus `json:"status" binding:"omitempty,order_status"`
+	DeliveredAt *string      `json:"deliveredAt" binding:"omitempty,datetime=2006-01-02 15:04:05"`
+
+	ExpectedDeliveryDate *string `json:"-"`
+	Address              *string `json:"-"`
+	Country              *string `json:"-"`
+	City                 *string `json:"-"`
+	PostalCode           *string `json:"-"`
+	Notes                *string `json:"-"`
+}
+
+// ChangesAddress reports whether the update touches the shipping address.
+func (dto UpdateOrderDTO) ChangesAddress() bool {
+	return dto.Address != nil || dto.Country != nil || dto.City != nil || dto.PostalCode != nil
+}
+
+// OrderPatch is a JSON Merge Patch (RFC 7386) of an order, members missing
+// from the patch are nil. Removing notes with null sets them to "".
+type OrderPatch struct {
+	Status               *OrderStatus `json:"status" binding:"omitempty,order_status"`
+	ExpectedDeliveryDate *string      `json:"expectedDeliveryDate" binding:"omitempty,datetime=2006-01-02"`
+	Address              *string      `json:"address"`
+	Country              *string      `json:"country"`
+	City                 *string      `json:"city"`
+	PostalCode           *string      `json:"postalCode"`
+	Notes                *string      `json:"notes" binding:"omitempty,max=2000"`
+}
+
+// ShippingAddress is the address part of an order, validated as a whole
+// because the postal code depends on the country.
+type ShippingAddress struct {
+	Address    string `json:"address" binding:"required,max=200"`
+	Country    string `json:"country" binding:"required,iso3166_1_alpha2"`
+	City       string `json:"city" binding:"required,max=100"`
+	PostalCode string `json:"postalCode" binding:"required,postal_code=Country"`
+}
+
+// Apply returns the address with the members of the patch applied.
+func (a ShippingAddress) Apply(patch OrderPatch) ShippingAddress {
+	if patch.Address != nil {
+		a.Address = *patch.Address
+	}
+	if patch.Country != nil {
+		a.Country = *patch.Country
+	}
+	if patch.City != nil {
+		a.City = *patch.City
+	}
+	if patch.PostalCode != nil {
+		a.PostalCode = *patch.PostalCode
+	}
+	return a
+}
+
+func (o *Order) ShippingAddress() ShippingAddress {
+	return ShippingAddress{Address: o.Address, Country: o.Country, City: o.City, PostalCode: o.PostalCode}
+}
+
+// Update turns the patch into the change written to the order.
+func (p OrderPatch) Update() UpdateOrderDTO {
+	return UpdateOrderDTO{
+		Status:               p.Status,
+		ExpectedDeliveryDate: p.ExpectedDeliveryDate,
+		Address:              p.Address,
+		Country:              p.Country,
+		City:                 p.City,
+		PostalCode:           p.PostalCode,
+		Notes:                p.Notes,
+	}
 }
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from OrderStatus
+		to   OrderStatus
+		want bool
+	}{
+		{OrderStatusPending, OrderStatusPaid, true},
+		{OrderStatusPending, OrderStatusShipped, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusFailed, true},
+		{OrderStatusPending, OrderStatusDelivered, false},
+		{OrderStatusPaid, OrderStatusShipped, true},
+		{OrderStatusPaid, OrderStatusRefunded, true},
+		{OrderStatusPaid, OrderStatusPending, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		// only delivered orders can be returned
+		{OrderStatusShipped, OrderStatusReturned, false},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusDelivered, OrderStatusReturned, true},
+		{OrderStatusDelivered, OrderStatusRefunded, false},
+		{OrderStatusReturned, OrderStatusRefunded, true},
+		{OrderStatusFailed, OrderStatusPending, true},
+		{OrderStatusFailed, OrderStatusPaid, true},
+		{OrderStatusFailed, OrderStatusShipped, false},
+		{OrderStatusCancelled, OrderStatusRefunded, true},
+		{OrderStatusRefunded, OrderStatusPending, false},
+		// keeping the status is allowed
+		{OrderStatusShipped, OrderStatusShipped, true},
+		{OrderStatusRefunded, OrderStatusRefunded, true},
+		{OrderStatus("lost"), OrderStatusPending, false},
+		{OrderStatusPending, OrderStatus("lost"), false},
+		{OrderStatus("lost"), OrderStatus("lost"), false},
+	}
+
+	for _, tc := range cases {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("%s -> %s: got %v want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestValidateStatusTransition(t *testing.T) {
+	if err := ValidateStatusTransition(OrderStatusPaid, OrderStatusShipped); err != nil {
+		t.Errorf("got %v for a legal transition", err)
+	}
+
+	err := ValidateStatusTransition(OrderStatusShipped, OrderStatusReturned)
+
+	var transitionErr *StatusTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("got %v want a StatusTransitionError", err)
+	}
+	if transitionErr.From != OrderStatusShipped || transitionErr.To != OrderStatusReturned {
+		t.Errorf("got transition %s -> %s", transitionErr.From, transitionErr.To)
+	}
+
+	problem := transitionErr.Conflict()
+	if problem.Extensions["reason"] != StatusTransitionReason {
+		t.Errorf("got reason %v want %v", problem.Extensions["reason"], StatusTransitionReason)
+	}
+}
+
+func TestPreviousStatuses(t *testing.T) {
+	cases := map[OrderStatus][]OrderStatus{
+		OrderStatusReturned: {OrderStatusDelivered, OrderStatusReturned},
+		OrderStatusRefunded: {OrderStatusCancelled, OrderStatusPaid, OrderStatusRefunded, OrderStatusReturned},
+		OrderStatusPending:  {OrderStatusFailed, OrderStatusPending},
+	}
+
+	for to, want := range cases {
+		// the order is stable across calls even though the transitions are a map
+		for i := 0; i < 10; i++ {
+			if got := PreviousStatuses(to); !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: got %v want %v", to, got, want)
+			}
+		}
+	}
+}
+
+func TestTimestampsAreUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	order := NewOrder(CreateOrderDTO{UserId: "1"}, PriceBreakdown{})
+	cancellation := NewCancellation("changed my mind", "1")
+	event := NewOrderEvent(OrderCreated, order)
+
+	now := time.Now().UTC()
+	for name, value := range map[string]string{"created at": order.CreatedAt, "cancelled at": cancellation.CancelledAt} {
+		stored, err := time.Parse(time.DateTime, value)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if now.Sub(stored).Abs() > time.Minute {
+			t.Errorf("%s: got %s want close to %s", name, value, now.Format(time.DateTime))
+		}
+	}
+	if event.OccurredAt.Location() != time.UTC {
+		t.Errorf("event occurred at %s", event.OccurredAt)
+	}
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "requested"
+	ReturnStatusApproved  ReturnStatus = "approved"
+	ReturnStatusRejected  ReturnStatus = "rejected"
+)
+
+func IsReturnStatusValid(status string) bool {
+	switch ReturnStatus(status) {
+	case ReturnStatusRequested, ReturnStatusApproved, ReturnStatusRejected:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	NotReturnableReason         = "order_not_returnable"
+	ReturnWindowExpiredReason   = "return_window_expired"
+	ReturnQuantityReason        = "return_quantity_exceeded"
+	ReturnAlreadyReviewedReason = "return_already_reviewed"
+)
+
+// ReturnItem is a returned quantity of an order item, priced as it was ordered.
+type ReturnItem struct {
+	ItemID   string `bson:"item_id" json:"itemId"`
+	Name     string `bson:"name" json:"name"`
+	Price    Money  `bson:"price" json:"price"`
+	Quantity int    `bson:"quantity" json:"quantity"`
+}
+
+// Refund is the amount paid back for an approved return.
+type Refund struct {
+	Amount    Money  `bson:"amount" json:"amount"`
+	CreatedAt string `bson:"created_at" json:"createdAt"`
+}
+
+type Return struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	OrderID    primitive.ObjectID `bson:"order_id" json:"orderId"`
+	UserID     string             `bson:"user_id" json:"userId"`
+	Items      []ReturnItem       `bson:"items" json:"items"`
+	Reason     string             `bson:"reason" json:"reason"`
+	Status     ReturnStatus       `bson:"status" json:"status"`
+	ReviewedBy string             `bson:"reviewed_by,omitempty" json:"reviewedBy,omitempty"`
+	ReviewNote string             `bson:"review_note,omitempty" json:"reviewNote,omitempty"`
+	Refund     *Refund            `bson:"refund,omitempty" json:"refund,omitempty"`
+	CreatedAt  string             `bson:"created_at" json:"createdAt"`
+	UpdatedAt  string             `bson:"updated_at" json:"updatedAt"`
+}
+
+// RefundAmount sums the prices of the returned items.
+func (r *Return) RefundAmount() (Money, error) {
+	var total Money
+	for _, item := range r.Items {
+		var err error
+		total, err = total.Add(item.Price.Multiply(int64(item.Quantity)))
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// IsReturnable reports whether items of an order in status may be sent back.
+// Orders stay returnable after a first return until every item is returned.
+func IsReturnable(status OrderStatus) bool {
+	switch status {
+	case OrderStatusDelivered, OrderStatusReturned, OrderStatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReturnDeadline is the last moment returns can be opened for order, delivery
+// times are stored in UTC.
+func ReturnDeadline(order *Order, window time.Duration) (time.Time, error) {
+	deliveredAt, err := time.ParseInLocation(time.DateTime, order.DeliveredAt, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return deliveredAt.Add(window), nil
+}
+
+// ReturnableQuantities returns how many of each item of order may still be
+// returned once the quantities of returns are taken off. Rejected returns do
+// not count.
+func ReturnableQuantities(order *Order, returns []*Return) map[string]int {
+	quantities := make(map[string]int, len(order.Items))
+	for _, item := range order.Items {
+		quantities[item.ID] += item.Quantity
+	}
+
+	for _, r := range returns {
+		if r.Status == ReturnStatusRejected {
+			continue
+		}
+		for _, item := range r.Items {
+			quantities[item.ItemID] -= item.Quantity
+		}
+	}
+
+	return quantities
+}
+
+// FullyReturned reports whether returns together send back every item of
+// order.
+func FullyReturned(order *Order, returns []*Return) bool {
+	for _, left := range ReturnableQuantities(order, returns) {
+		if left > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateReturnItems checks that items are part of order and that their
+// quantities are still left after the returns already counted.
+func ValidateReturnItems(order *Order, items []ReturnItem, counted []*Return) error {
+	returnable := ReturnableQuantities(order, counted)
+
+	requested := make(map[string]int, len(items))
+	for _, item := range items {
+		requested[item.ItemID] += item.Quantity
+	}
+
+	for _, item := range items {
+		left, ok := returnable[item.ItemID]
+		if !ok {
+			return apperrors.Unprocessable(fmt.Sprintf("Item %s is not part of the order", item.ItemID), nil)
+		}
+		if requested[item.ItemID] > left {
+			return apperrors.Unprocessable(fmt.Sprintf("Only %d of item %s can be returned", max(left, 0), item.ItemID), nil).
+				With("reason", ReturnQuantityReason).
+				With("itemId", item.ItemID).
+				With("returnable", max(left, 0))
+		}
+	}
+
+	return nil
+}
+
+// NewReturn opens a return for items of order within window after its delivery,
+// existing are the other returns of the order.
+func NewReturn(order *Order, dto CreateReturnDTO, existing []*Return, window time.Duration, now time.Time) (*Return, error) {
+	if !IsReturnable(order.Status) {
+		return nil, apperrors.Conflict(fmt.Sprintf("order cannot be returned while it is %s", order.Status), nil).
+			With("reason", NotReturnableReason).
+			With("orderStatus", order.Status)
+	}
+
+	deadline, err := ReturnDeadline(order, window)
+	if err != nil {
+		return nil, apperrors.Conflict("order has no delivery date", err).
+			With("reason", NotReturnableReason)
+	}
+	if now.After(deadline) {
+		return nil, apperrors.Conflict("the return window of the order has expired", nil).
+			With("reason", ReturnWindowExpiredReason).
+			With("deadline", deadline.Format(time.DateTime))
+	}
+
+	prices := make(map[string]Item, len(order.Items))
+	for _, item := range order.Items {
+		prices[item.ID] = item
+	}
+
+	items := make([]ReturnItem, 0, len(dto.Items))
+	for _, requested := range dto.Items {
+		item := prices[requested.ItemID]
+		items = append(items, ReturnItem{
+			ItemID:   requested.ItemID,
+			Name:     item.Name,
+			Price:    item.Price,
+			Quantity: requested.Quantity,
+		})
+	}
+
+	if err := ValidateReturnItems(order, items, existing); err != nil {
+		return nil, err
+	}
+
+	createdAt := now.Format(time.DateTime)
+	return &Return{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Items:     items,
+		Reason:    dto.Reason,
+		Status:    ReturnStatusRequested,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}, nil
+}
+
+type ReturnItemDTO struct {
+	ItemID   string `json:"itemId" binding:"required,max=64"`
+	Quantity int    `json:"quantity" binding:"gt=0,lte=1000"`
+}
+
+type CreateReturnDTO struct {
+	OrderID string          `json:"orderId" binding:"required,max=64"`
+	Items   []ReturnItemDTO `json:"items" binding:"required,min=1,max=100,dive"`
+	Reason  string          `json:"reason" binding:"required,max=500"`
+}
+
+type ReviewReturnDTO struct {
+	Note string `json:"note" binding:"max=500"`
+}
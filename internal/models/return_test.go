@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReturnDeadline(t *testing.T) {
+	// the deadline must not depend on the time zone the service runs in
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	defer func() { time.Local = local }()
+
+	order := &Order{DeliveredAt: "2024-01-01 22:00:00"}
+
+	deadline, err := ReturnDeadline(order, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 22, 0, 0, 0, time.UTC); !deadline.Equal(want) {
+		t.Errorf("got deadline %s want %s", deadline, want)
+	}
+
+	if _, err := ReturnDeadline(&Order{DeliveredAt: "2024-01-01"}, time.Hour); err == nil {
+		t.Error("got no error for a delivery time without time of day")
+	}
+}
+
+func TestFullyReturned(t *testing.T) {
+	order := &Order{Items: []Item{{ID: "a", Quantity: 2}, {ID: "b", Quantity: 1}}}
+
+	first := &Return{Status: ReturnStatusApproved, Items: []ReturnItem{{ItemID: "a", Quantity: 1}}}
+	rejected := &Return{Status: ReturnStatusRejected, Items: []ReturnItem{{ItemID: "a", Quantity: 1}, {ItemID: "b", Quantity: 1}}}
+	rest := &Return{Status: ReturnStatusApproved, Items: []ReturnItem{{ItemID: "a", Quantity: 1}, {ItemID: "b", Quantity: 1}}}
+
+	if FullyReturned(order, []*Return{first}) {
+		t.Error("a return of some of the items returned the whole order")
+	}
+	if FullyReturned(order, []*Return{first, rejected}) {
+		t.Error("a rejected return counted")
+	}
+	if !FullyReturned(order, []*Return{first, rest}) {
+		t.Error("returns of every item did not return the whole order")
+	}
+}
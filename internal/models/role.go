@@ -0,0 +1,26 @@
+package models
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
+)
+
+// roleRanks orders roles so that every role includes the permissions of the lower ones.
+var roleRanks = map[Role]int{
+	RoleCustomer: 1,
+	RoleStaff:    2,
+	RoleAdmin:    3,
+}
+
+// HasRole reports whether any of the granted roles satisfies the required role.
+func HasRole(granted []Role, required Role) bool {
+	for _, role := range granted {
+		if rank, ok := roleRanks[role]; ok && rank >= roleRanks[required] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/correlation"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/mycandys/orders/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Sink is a downstream that has to receive every order event at least once.
+type Sink interface {
+	// Name identifies the sink in the outbox, it must not change between releases.
+	Name() string
+	Deliver(ctx context.Context, event *models.OrderEvent) error
+}
+
+// Relay delivers outbox messages to all sinks, retrying failed deliveries with
+// exponential backoff. A message is only marked published once every sink
+// succeeded, so sinks may see an event more than once and must tolerate it.
+type Relay struct {
+	outbox       *repository.OutboxRepository
+	sinks        []Sink
+	PollInterval time.Duration
+	Lease        time.Duration
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	MaxAttempts  int
+}
+
+func NewRelay(outbox *repository.OutboxRepository, sinks ...Sink) *Relay {
+	return &Relay{
+		outbox:       outbox,
+		sinks:        sinks,
+		PollInterval: time.Second,
+		Lease:        30 * time.Second,
+		MinBackoff:   time.Second,
+		MaxBackoff:   5 * time.Minute,
+		MaxAttempts:  25,
+	}
+}
+
+// Run delivers messages until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain everything that is due before waiting for the next tick
+		for {
+			processed, err := r.ProcessNext(ctx)
+			if err != nil {
+				// a claim interrupted by shutdown is not an error
+				if ctx.Err() == nil {
+					log.Printf("Error relaying outbox message: %v", err)
+				}
+				break
+			}
+			if !processed || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessNext delivers the oldest due message and reports whether there was one.
+func (r *Relay) ProcessNext(ctx context.Context) (bool, error) {
+	message, err := r.outbox.Claim(ctx, r.Lease)
+	if err != nil || message == nil {
+		return false, err
+	}
+
+	// continue the trace and correlation of the request that caused the event
+	ctx = tracing.Extract(ctx, message.Event.TraceContext)
+	if message.Event.CorrelationID != "" {
+		ctx = correlation.WithID(ctx, message.Event.CorrelationID)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "outbox.deliver", trace.WithAttributes(
+		attribute.String("order.event.id", message.ID.Hex()),
+		attribute.String("order.event.type", string(message.Event.Type)),
+		attribute.Int("order.event.attempt", message.Attempts),
+	))
+	defer span.End()
+
+	// record the outcome even when the relay is stopped meanwhile, the sinks
+	// already received the event
+	done := context.WithoutCancel(ctx)
+
+	var failures []error
+	for _, sink := range r.sinks {
+		if message.IsDelivered(sink.Name()) {
+			continue
+		}
+
+		if err := sink.Deliver(ctx, message.Event); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+
+		if err := r.outbox.MarkDelivered(done, message.ID, sink.Name()); err != nil {
+			return true, err
+		}
+	}
+
+	if len(failures) == 0 {
+		return true, r.outbox.MarkPublished(done, message.ID)
+	}
+
+	lastError := errors.Join(failures...).Error()
+	span.SetStatus(codes.Error, lastError)
+
+	if message.Attempts >= r.MaxAttempts {
+		log.Printf("Giving up on outbox message %s after %d attempts: %s", message.ID.Hex(), message.Attempts, lastError)
+		return true, r.outbox.MarkDead(done, message.ID, lastError)
+	}
+
+	return true, r.outbox.ScheduleRetry(done, message.ID, time.Now().Add(r.backoff(message.Attempts)), lastError)
+}
+
+// backoff doubles the delay with every attempt and adds up to 20% jitter.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := float64(r.MinBackoff) * math.Pow(2, float64(attempts-1))
+	if delay > float64(r.MaxBackoff) {
+		delay = float64(r.MaxBackoff)
+	}
+	return time.Duration(delay * (1 + rand.Float64()*0.2))
+}
@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/rabbitmq"
+	"github.com/mycandys/orders/internal/services"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQSink publishes every event to the order events exchange.
+type RabbitMQSink struct {
+	publisher *rabbitmq.Publisher
+}
+
+func NewRabbitMQSink(publisher *rabbitmq.Publisher) *RabbitMQSink {
+	return &RabbitMQSink{publisher: publisher}
+}
+
+func (s *RabbitMQSink) Name() string {
+	return "rabbitmq"
+}
+
+func (s *RabbitMQSink) Deliver(ctx context.Context, event *models.OrderEvent) error {
+	body, err := json.Marshal(models.NewOrderEventMessage(event))
+	if err != nil {
+		return err
+	}
+
+	return s.publisher.Publish(ctx, event.RoutingKey(), amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     event.ID.Hex(),
+		CorrelationId: event.CorrelationID,
+		Timestamp:     event.OccurredAt,
+		Type:          event.RoutingKey(),
+		AppId:         "orders",
+		Headers: amqp.Table{
+			"schema_version": int32(models.OrderEventSchemaVersion),
+		},
+		Body: body,
+	})
+}
+
+// CartSink clears the cart an order was placed from.
+type CartSink struct {
+	carts *services.CartService
+}
+
+func NewCartSink(carts *services.CartService) *CartSink {
+	return &CartSink{carts: carts}
+}
+
+func (s *CartSink) Name() string {
+	return "cart"
+}
+
+func (s *CartSink) Deliver(ctx context.Context, event *models.OrderEvent) error {
+	if event.Type != models.OrderCreated || event.Order.CartID == "" {
+		return nil
+	}
+	return s.carts.ClearCart(ctx, event.Order.CartID)
+}
+
+// NotificationSink emails customers about their orders.
+type NotificationSink struct {
+	notifications *services.NotificationService
+}
+
+func NewNotificationSink(notifications *services.NotificationService) *NotificationSink {
+	return &NotificationSink{notifications: notifications}
+}
+
+func (s *NotificationSink) Name() string {
+	return "notification"
+}
+
+func (s *NotificationSink) Deliver(ctx context.Context, event *models.OrderEvent) error {
+	switch event.Type {
+	case models.OrderCreated:
+		return s.notifications.SendEmail(ctx, services.NewOrderCreatedEmail(event.UserID, event.OrderID.Hex()))
+	case models.OrderStatusChanged:
+		if event.Order.Status == models.OrderStatusCancelled {
+			var reason string
+			if event.Order.Cancellation != nil {
+				reason = event.Order.Cancellation.Reason
+			}
+			return s.notifications.SendEmail(ctx, services.NewOrderCancelledEmail(event.UserID, event.OrderID.Hex(), reason))
+		}
+		return s.notifications.SendEmail(ctx, services.NewOrderStatusUpdatedEmail(event.UserID, event.OrderID.Hex(), event.Order.Status))
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package pricing
+
+import (
+	"fmt"
+	"github.com/mycandys/orders/internal/models"
+	"strings"
+)
+
+const CostMismatchReason = "cost_mismatch"
+
+// Calculator computes order prices on the server so the cost submitted by
+// clients is only ever used as a cross-check.
+type Calculator struct {
+	// Currency is the ISO 4217 code all orders are priced in.
+	Currency string
+	// TaxRate is a percentage applied to the subtotal.
+	TaxRate float64
+	// ShippingCost is the flat shipping fee charged per order.
+	ShippingCost models.Money
+	// FreeShippingThreshold is the subtotal from which shipping is free, zero disables it.
+	FreeShippingThreshold models.Money
+	// Tolerance is the largest accepted difference, in minor units, between the submitted and computed total.
+	Tolerance int64
+}
+
+// Config holds the pricing settings, amounts are in major units of Currency.
+type Config struct {
+	// Currency defaults to models.LegacyCurrency.
+	Currency              string
+	TaxRate               float64
+	ShippingCost          float64
+	FreeShippingThreshold float64
+	Tolerance             float64
+}
+
+func NewCalculator(config Config) *Calculator {
+	currency := strings.ToUpper(config.Currency)
+	if currency == "" {
+		currency = models.LegacyCurrency
+	}
+
+	return &Calculator{
+		Currency:              currency,
+		TaxRate:               config.TaxRate,
+		ShippingCost:          models.MoneyFromFloat(config.ShippingCost, currency),
+		FreeShippingThreshold: models.MoneyFromFloat(config.FreeShippingThreshold, currency),
+		Tolerance:             models.MoneyFromFloat(config.Tolerance, currency).Amount,
+	}
+}
+
+// Quote prices the items. Items priced in a currency other than the
+// calculator's are rejected rather than converted.
+func (c *Calculator) Quote(items []models.Item) (models.PriceBreakdown, error) {
+	subtotal := models.NewMoney(0, c.Currency)
+	for _, item := range items {
+		if item.Price.Currency != c.Currency {
+			return models.PriceBreakdown{}, &models.CurrencyMismatchError{Expected: c.Currency, Actual: item.Price.Currency}
+		}
+		subtotal.Amount += item.Price.Multiply(int64(item.Quantity)).Amount
+	}
+
+	shipping := models.NewMoney(c.ShippingCost.Amount, c.Currency)
+	if len(items) == 0 || (!c.FreeShippingThreshold.IsZero() && subtotal.Amount >= c.FreeShippingThreshold.Amount) {
+		shipping.Amount = 0
+	}
+
+	tax := subtotal.Percent(c.TaxRate)
+	discount := models.NewMoney(0, c.Currency)
+
+	return models.PriceBreakdown{
+		Subtotal: subtotal,
+		Tax:      tax,
+		Shipping: shipping,
+		Discount: discount,
+		Total:    models.NewMoney(subtotal.Amount+tax.Amount+shipping.Amount-discount.Amount, c.Currency),
+	}, nil
+}
+
+type MismatchError struct {
+	Submitted models.Money
+	Expected  models.Money
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("submitted cost %s does not match calculated cost %s", e.Submitted, e.Expected)
+}
+
+// Verify checks the cost submitted by the client against a server side quote.
+func (c *Calculator) Verify(submitted models.Money, quote models.PriceBreakdown) error {
+	if !submitted.SameCurrency(quote.Total) {
+		return &models.CurrencyMismatchError{Expected: quote.Total.Currency, Actual: submitted.Currency}
+	}
+
+	difference := submitted.Amount - quote.Total.Amount
+	if difference < 0 {
+		difference = -difference
+	}
+
+	if difference > c.Tolerance {
+		return &MismatchError{Submitted: submitted, Expected: quote.Total}
+	}
+	return nil
+}
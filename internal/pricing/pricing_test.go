@@ -0,0 +1,130 @@
+package pricing
+
+import (
+	"errors"
+	"github.com/mycandys/orders/internal/models"
+	"testing"
+)
+
+func items(prices ...int64) []models.Item {
+	items := make([]models.Item, 0, len(prices))
+	for _, price := range prices {
+		items = append(items, models.Item{ID: "1", Name: "candy", Price: models.NewMoney(price, "EUR"), Quantity: 1})
+	}
+	return items
+}
+
+func breakdown(subtotal int64, tax int64, shipping int64) models.PriceBreakdown {
+	return models.PriceBreakdown{
+		Subtotal: models.NewMoney(subtotal, "EUR"),
+		Tax:      models.NewMoney(tax, "EUR"),
+		Shipping: models.NewMoney(shipping, "EUR"),
+		Discount: models.NewMoney(0, "EUR"),
+		Total:    models.NewMoney(subtotal+tax+shipping, "EUR"),
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+		items  []models.Item
+		want   models.PriceBreakdown
+	}{
+		{
+			name:   "no tax or shipping",
+			config: Config{Currency: "EUR"},
+			items:  items(250, 250),
+			want:   breakdown(500, 0, 0),
+		},
+		{
+			name:   "tax rounds to the nearest cent",
+			config: Config{Currency: "EUR", TaxRate: 19},
+			items:  items(999),
+			want:   breakdown(999, 190, 0),
+		},
+		{
+			name:   "shipping below the threshold",
+			config: Config{Currency: "EUR", TaxRate: 10, ShippingCost: 4.99, FreeShippingThreshold: 50},
+			items:  items(4999),
+			want:   breakdown(4999, 500, 499),
+		},
+		{
+			name:   "free shipping at the threshold",
+			config: Config{Currency: "EUR", ShippingCost: 4.99, FreeShippingThreshold: 50},
+			items:  items(2500, 2500),
+			want:   breakdown(5000, 0, 0),
+		},
+		{
+			name:   "shipping without threshold",
+			config: Config{Currency: "EUR", ShippingCost: 4.99},
+			items:  items(100000),
+			want:   breakdown(100000, 0, 499),
+		},
+		{
+			name:   "no shipping without items",
+			config: Config{Currency: "EUR", ShippingCost: 4.99},
+			items:  items(),
+			want:   breakdown(0, 0, 0),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quote, err := NewCalculator(tc.config).Quote(tc.items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote != tc.want {
+				t.Errorf("got %+v want %+v", quote, tc.want)
+			}
+		})
+	}
+}
+
+func TestQuoteCurrencyMismatch(t *testing.T) {
+	calculator := NewCalculator(Config{Currency: "eur"})
+	if calculator.Currency != "EUR" {
+		t.Errorf("got currency %s want EUR", calculator.Currency)
+	}
+
+	mixed := append(items(100), models.Item{ID: "2", Name: "candy", Price: models.NewMoney(100, "USD"), Quantity: 1})
+
+	_, err := calculator.Quote(mixed)
+
+	var currencyErr *models.CurrencyMismatchError
+	if !errors.As(err, &currencyErr) || currencyErr.Expected != "EUR" || currencyErr.Actual != "USD" {
+		t.Errorf("got %v want a currency mismatch", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	calculator := NewCalculator(Config{Currency: "EUR", Tolerance: 0.01})
+	quote := breakdown(1000, 0, 0)
+
+	for _, tc := range []struct {
+		submitted models.Money
+		mismatch  bool
+	}{
+		{models.NewMoney(1000, "EUR"), false},
+		{models.NewMoney(1001, "EUR"), false},
+		{models.NewMoney(999, "EUR"), false},
+		{models.NewMoney(1002, "EUR"), true},
+		{models.NewMoney(998, "EUR"), true},
+	} {
+		err := calculator.Verify(tc.submitted, quote)
+
+		var mismatchErr *MismatchError
+		if got := errors.As(err, &mismatchErr); got != tc.mismatch {
+			t.Errorf("%s: got %v want mismatch %v", tc.submitted, err, tc.mismatch)
+		}
+		if tc.mismatch && mismatchErr.Expected != quote.Total {
+			t.Errorf("%s: got expected %s want %s", tc.submitted, mismatchErr.Expected, quote.Total)
+		}
+	}
+
+	var currencyErr *models.CurrencyMismatchError
+	if err := calculator.Verify(models.NewMoney(1000, "USD"), quote); !errors.As(err, &currencyErr) {
+		t.Errorf("got %v want a currency mismatch", err)
+	}
+}
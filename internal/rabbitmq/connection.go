@@ -0,0 +1,362 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"github.com/mycandys/orders/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrNotConnected is returned when the broker is currently unreachable.
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// OfflinePolicy decides what happens to fire-and-forget messages published while disconnected.
+type OfflinePolicy string
+
+const (
+	// OfflineBuffer keeps up to the buffer size of the newest messages and sends them after reconnecting.
+	OfflineBuffer OfflinePolicy = "buffer"
+	// OfflineDrop discards the messages and returns ErrNotConnected.
+	OfflineDrop OfflinePolicy = "drop"
+)
+
+type pendingMessage struct {
+	exchange   string
+	routingKey string
+	msg        amqp.Publishing
+}
+
+// channelRetryDelay is how long watchChannel waits between attempts to reopen a
+// channel the broker closed.
+const channelRetryDelay = time.Second
+
+// Connection keeps a broker connection alive. It watches for the connection to
+// close, reconnects with exponential backoff and then re-declares the queues and
+// re-runs the setup functions registered with OnConnect. The shared channel is
+// reopened on its own when the broker closes only the channel.
+type Connection struct {
+	url        string
+	policy     OfflinePolicy
+	bufferSize int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PublishTimeout bounds Publish while the broker blocks publishers.
+	PublishTimeout time.Duration
+
+	mu      sync.RWMutex
+	conn    *amqp.Connection
+	ch      *amqp.Channel
+	queues  []string
+	setups  []func(conn *amqp.Connection) error
+	buffer  []pendingMessage
+	dropped int
+	closed  bool
+}
+
+func NewConnection(url string, policy OfflinePolicy, bufferSize int) *Connection {
+	return &Connection{
+		url:            url,
+		policy:         policy,
+		bufferSize:     bufferSize,
+		MinBackoff:     time.Second,
+		MaxBackoff:     30 * time.Second,
+		PublishTimeout: time.Second,
+	}
+}
+
+// Start connects once and keeps reconnecting in the background afterwards. The
+// returned error only reports the first attempt.
+func (c *Connection) Start() error {
+	err := c.connect()
+	if err != nil {
+		go c.reconnect()
+	}
+	return err
+}
+
+func (c *Connection) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+// Ping fails unless both the connection and the shared channel are open.
+func (c *Connection) Ping() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.conn == nil || c.conn.IsClosed() || c.ch == nil || c.ch.IsClosed() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+func (c *Connection) connect() error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		_ = conn.Close()
+		return ErrNotConnected
+	}
+
+	if err := c.declareQueues(ch); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	for _, setup := range c.setups {
+		if err := setup(conn); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+
+	c.conn = conn
+	c.ch = ch
+	c.flush()
+
+	go c.watch(conn)
+	go watchChannel(conn, closed, c.reopenChannel)
+
+	return nil
+}
+
+// reopenChannel replaces the shared channel after the broker closed it while
+// conn stayed open.
+func (c *Connection) reopenChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a reconnect opens its own channel
+	if c.closed || c.conn != conn {
+		_ = ch.Close()
+		return nil
+	}
+
+	if err := c.declareQueues(ch); err != nil {
+		_ = ch.Close()
+		return err
+	}
+
+	c.ch = ch
+	c.flush()
+
+	go watchChannel(conn, closed, c.reopenChannel)
+
+	return nil
+}
+
+// declareQueues declares the queues registered with DeclareQueue on ch, c.mu
+// must be held.
+func (c *Connection) declareQueues(ch *amqp.Channel) error {
+	for _, queue := range c.queues {
+		if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchChannel waits for a channel of conn to close. When the broker closed
+// only the channel, reopen is retried until it succeeds or conn closes too.
+// Channels closed on purpose report no error and are left closed.
+func watchChannel(conn *amqp.Connection, closed chan *amqp.Error, reopen func(conn *amqp.Connection) error) {
+	err := <-closed
+	if err == nil || conn.IsClosed() {
+		return
+	}
+
+	log.Printf("RabbitMQ channel closed: %v", err)
+
+	for !conn.IsClosed() {
+		err := reopen(conn)
+		if err == nil {
+			return
+		}
+		log.Printf("Error reopening RabbitMQ channel: %v", err)
+		time.Sleep(channelRetryDelay)
+	}
+}
+
+// watch waits for conn to close and starts reconnecting unless it was closed on purpose.
+func (c *Connection) watch(conn *amqp.Connection) {
+	err := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	closed := c.closed
+	c.ch = nil
+	c.mu.Unlock()
+
+	if closed {
+		return
+	}
+
+	log.Printf("RabbitMQ connection lost: %v", err)
+	c.reconnect()
+}
+
+func (c *Connection) reconnect() {
+	for attempt := 0; ; attempt++ {
+		delay := float64(c.MinBackoff) * math.Pow(2, float64(attempt))
+		time.Sleep(time.Duration(math.Min(delay, float64(c.MaxBackoff))))
+
+		c.mu.RLock()
+		closed := c.closed
+		c.mu.RUnlock()
+		if closed {
+			return
+		}
+
+		err := c.connect()
+		if err == nil {
+			log.Printf("Reconnected to RabbitMQ after %d attempts", attempt+1)
+			return
+		}
+		log.Printf("Error reconnecting to RabbitMQ: %v", err)
+	}
+}
+
+// DeclareQueue declares a durable queue now and again after every reconnect.
+func (c *Connection) DeclareQueue(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queues = append(c.queues, name)
+	if c.ch == nil {
+		return nil
+	}
+
+	_, err := c.ch.QueueDeclare(name, true, false, false, false, nil)
+	return err
+}
+
+// OnConnect runs setup now if connected and again after every reconnect, it
+// is where publishers and consumers open their channels and declare topology.
+func (c *Connection) OnConnect(setup func(conn *amqp.Connection) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setups = append(c.setups, setup)
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil
+	}
+	return setup(c.conn)
+}
+
+// Publish sends msg on the shared channel without waiting for a confirmation.
+// The lock is not held while sending, so a broker applying flow control only
+// slows down publishing and not Ping or IsConnected.
+func (c *Connection) Publish(ctx context.Context, exchange string, routingKey string, msg amqp.Publishing) error {
+	ctx, span := startPublishSpan(ctx, exchange, routingKey, &msg)
+	defer span.End()
+
+	c.mu.RLock()
+	ch := c.ch
+	c.mu.RUnlock()
+
+	if ch != nil && !ch.IsClosed() {
+		err := c.publishWithin(ctx, ch, exchange, routingKey, msg)
+		if err == nil {
+			metrics.ObservePublish(exchange, metrics.ResultSuccess)
+			return nil
+		}
+		if !errors.Is(err, amqp.ErrClosed) {
+			metrics.ObservePublish(exchange, metrics.ResultFailure)
+			return err
+		}
+	}
+
+	if c.policy == OfflineDrop {
+		metrics.ObservePublish(exchange, metrics.ResultFailure)
+		return ErrNotConnected
+	}
+
+	metrics.ObservePublish(exchange, metrics.ResultBuffered)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.buffer) >= c.bufferSize {
+		// keep the newest messages
+		c.buffer = c.buffer[1:]
+		c.dropped++
+	}
+	c.buffer = append(c.buffer, pendingMessage{exchange: exchange, routingKey: routingKey, msg: msg})
+
+	return nil
+}
+
+// publishWithin gives up on sending msg after PublishTimeout. The client
+// library ignores the context while the broker blocks the connection, so the
+// send runs on its own and is abandoned when the time is up.
+func (c *Connection) publishWithin(ctx context.Context, ch *amqp.Channel, exchange string, routingKey string, msg amqp.Publishing) error {
+	if c.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.PublishTimeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ch.PublishWithContext(ctx, exchange, routingKey, false, false, msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush sends the buffered messages, c.mu must be held.
+func (c *Connection) flush() {
+	if c.dropped > 0 {
+		log.Printf("Dropped %d RabbitMQ messages while disconnected", c.dropped)
+		c.dropped = 0
+	}
+
+	for i, pending := range c.buffer {
+		err := c.ch.PublishWithContext(context.Background(), pending.exchange, pending.routingKey, false, false, pending.msg)
+		if err != nil {
+			log.Printf("Error flushing buffered RabbitMQ messages: %v", err)
+			c.buffer = c.buffer[i:]
+			return
+		}
+	}
+	c.buffer = nil
+}
+
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil
+	}
+	return c.conn.Close()
+}
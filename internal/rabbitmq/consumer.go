@@ -0,0 +1,370 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/metrics"
+	"github.com/mycandys/orders/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrPoisonMessage marks messages that can never be handled, they are moved to
+// the dead-letter queue instead of being retried.
+var ErrPoisonMessage = errors.New("poison message")
+
+// RetriesHeader counts how often a message was sent back for another attempt.
+const RetriesHeader = "x-retries"
+
+// MessageHandler handles one delivery. Returning an error wrapping
+// ErrPoisonMessage dead-letters the message, any other error retries it after
+// RetryDelay up to MaxRetries times.
+type MessageHandler func(ctx context.Context, delivery amqp.Delivery) error
+
+// ProcessedMessages remembers handled message ids so redeliveries are skipped.
+// Claim leases id before the message is handled and reports false when it was
+// already handled, the lease runs out if the consumer dies before Complete.
+// Release drops the lease again when handling failed.
+type ProcessedMessages interface {
+	Claim(ctx context.Context, id string) (bool, error)
+	Complete(ctx context.Context, id string) error
+	Release(ctx context.Context, id string) error
+}
+
+type binding struct {
+	exchange   string
+	routingKey string
+}
+
+// Consumer reads a durable queue with manual acks. Failed messages wait in
+// "<queue>.retry" for RetryDelay and then return to the queue with their
+// routing key, messages that failed MaxRetries times or are poison are rejected
+// into "<queue>.dead" through a dead-letter exchange. The topology is
+// re-declared and consuming resumes whenever the connection comes back or the
+// broker closed the channel.
+type Consumer struct {
+	queue      string
+	processed  ProcessedMessages
+	handlers   map[string]MessageHandler
+	Prefetch   int
+	MaxRetries int
+	RetryDelay time.Duration
+	// publish sends a message to be retried, it defaults to the consumer channel
+	publish func(ctx context.Context, exchange string, routingKey string, msg amqp.Publishing) error
+
+	mu       sync.Mutex
+	ch       *amqp.Channel
+	bindings []binding
+	// ready is signalled every time a new channel was opened
+	ready chan struct{}
+}
+
+func NewConsumer(conn *Connection, queue string, processed ProcessedMessages) (*Consumer, error) {
+	c := &Consumer{
+		queue:      queue,
+		processed:  processed,
+		handlers:   make(map[string]MessageHandler),
+		Prefetch:   10,
+		MaxRetries: 5,
+		RetryDelay: 10 * time.Second,
+		ready:      make(chan struct{}, 1),
+	}
+	c.publish = c.publishOnChannel
+
+	return c, conn.OnConnect(c.open)
+}
+
+func (c *Consumer) deadLetterExchange() string {
+	return c.queue + ".dlx"
+}
+
+// retryExchange routes failed messages into the retry queue.
+func (c *Consumer) retryExchange() string {
+	return c.queue + ".retry"
+}
+
+// requeueExchange routes messages whose retry delay ran out back to the queue.
+func (c *Consumer) requeueExchange() string {
+	return c.queue + ".requeue"
+}
+
+func (c *Consumer) open(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.declare(ch); err != nil {
+		_ = ch.Close()
+		return err
+	}
+
+	for _, b := range c.bindings {
+		if err := bind(ch, c.queue, b); err != nil {
+			_ = ch.Close()
+			return err
+		}
+	}
+
+	c.ch = ch
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+
+	go watchChannel(conn, closed, c.open)
+
+	return nil
+}
+
+func (c *Consumer) declare(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(c.deadLetterExchange(), amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	dead, err := ch.QueueDeclare(c.queue+".dead", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := ch.QueueBind(dead.Name, "", c.deadLetterExchange(), false, nil); err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(c.queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": c.deadLetterExchange(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// fanout exchanges keep the routing key, so retried messages find their handler again
+	if err := ch.ExchangeDeclare(c.requeueExchange(), amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(c.queue, "", c.requeueExchange(), false, nil); err != nil {
+		return err
+	}
+
+	if err := ch.ExchangeDeclare(c.retryExchange(), amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return err
+	}
+	retry, err := ch.QueueDeclare(c.retryExchange(), true, false, false, false, amqp.Table{
+		"x-message-ttl":          c.RetryDelay.Milliseconds(),
+		"x-dead-letter-exchange": c.requeueExchange(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := ch.QueueBind(retry.Name, "", c.retryExchange(), false, nil); err != nil {
+		return err
+	}
+
+	return ch.Qos(c.Prefetch, 0, false)
+}
+
+func bind(ch *amqp.Channel, queue string, b binding) error {
+	if err := ch.ExchangeDeclare(b.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(queue, b.routingKey, b.exchange, false, nil)
+}
+
+// Handle subscribes the queue to routingKey on the topic exchange and routes
+// matching messages to handler. It must be called before Run.
+func (c *Consumer) Handle(exchange string, routingKey string, handler MessageHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := binding{exchange: exchange, routingKey: routingKey}
+	c.bindings = append(c.bindings, b)
+	c.handlers[routingKey] = handler
+
+	if c.ch == nil || c.ch.IsClosed() {
+		return nil
+	}
+	return bind(c.ch, c.queue, b)
+}
+
+func (c *Consumer) channel() *amqp.Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ch
+}
+
+// Run consumes messages until ctx is cancelled. While the broker is away it
+// waits for the connection to come back and then resumes.
+func (c *Consumer) Run(ctx context.Context) {
+	for {
+		if ch := c.channel(); ch != nil && !ch.IsClosed() {
+			deliveries, err := ch.ConsumeWithContext(ctx, c.queue, "", false, false, false, false, nil)
+			if err != nil {
+				log.Printf("Error consuming %s: %v", c.queue, err)
+			} else {
+				c.consume(ctx, deliveries)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if ch := c.channel(); ch != nil && !ch.IsClosed() {
+				_ = ch.Close()
+			}
+			return
+		case <-c.ready:
+		}
+	}
+}
+
+// consume handles deliveries until the channel closes or ctx is cancelled.
+func (c *Consumer) consume(ctx context.Context, deliveries <-chan amqp.Delivery) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			c.handle(ctx, delivery)
+		}
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, delivery amqp.Delivery) {
+	ctx, span := tracing.Tracer().Start(tracing.ExtractAMQP(ctx, delivery), fmt.Sprintf("%s process", delivery.RoutingKey),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("rabbitmq"),
+			semconv.MessagingDestinationName(c.queue),
+			semconv.MessagingRabbitmqDestinationRoutingKey(delivery.RoutingKey),
+			semconv.MessagingMessageID(delivery.MessageId),
+		),
+	)
+	defer span.End()
+
+	err := c.process(ctx, delivery)
+	if err == nil {
+		metrics.ObserveConsume(delivery.RoutingKey, metrics.ResultAck)
+		if err := delivery.Ack(false); err != nil {
+			log.Printf("Error acking message %s: %v", delivery.MessageId, err)
+		}
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	attempt := retries(delivery)
+	if !errors.Is(err, ErrPoisonMessage) && attempt < c.MaxRetries {
+		log.Printf("Error handling %s message %s (retry %d of %d): %v", delivery.RoutingKey, delivery.MessageId, attempt+1, c.MaxRetries, err)
+
+		retryErr := c.retry(ctx, delivery, attempt+1)
+		if retryErr == nil {
+			metrics.ObserveConsume(delivery.RoutingKey, metrics.ResultRetry)
+			if err := delivery.Ack(false); err != nil {
+				log.Printf("Error acking message %s: %v", delivery.MessageId, err)
+			}
+			return
+		}
+
+		// without the retry queue the broker redelivers the message once
+		log.Printf("Error sending message %s to the retry queue: %v", delivery.MessageId, retryErr)
+		if !delivery.Redelivered {
+			metrics.ObserveConsume(delivery.RoutingKey, metrics.ResultRequeue)
+			if err := delivery.Nack(false, true); err != nil {
+				log.Printf("Error rejecting message %s: %v", delivery.MessageId, err)
+			}
+			return
+		}
+	}
+
+	metrics.ObserveConsume(delivery.RoutingKey, metrics.ResultDeadLetter)
+	log.Printf("Error handling %s message %s, moving it to the dead-letter queue: %v", delivery.RoutingKey, delivery.MessageId, err)
+
+	if err := delivery.Nack(false, false); err != nil {
+		log.Printf("Error rejecting message %s: %v", delivery.MessageId, err)
+	}
+}
+
+// retries returns how often delivery was already sent to the retry queue.
+func retries(delivery amqp.Delivery) int {
+	switch n := delivery.Headers[RetriesHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	default:
+		return 0
+	}
+}
+
+// retry sends a copy of delivery to the retry queue as attempt.
+func (c *Consumer) retry(ctx context.Context, delivery amqp.Delivery, attempt int) error {
+	headers := make(amqp.Table, len(delivery.Headers)+1)
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[RetriesHeader] = int32(attempt)
+
+	return c.publish(ctx, c.retryExchange(), delivery.RoutingKey, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		CorrelationId:   delivery.CorrelationId,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	})
+}
+
+func (c *Consumer) publishOnChannel(ctx context.Context, exchange string, routingKey string, msg amqp.Publishing) error {
+	ch := c.channel()
+	if ch == nil || ch.IsClosed() {
+		return ErrNotConnected
+	}
+	return ch.PublishWithContext(ctx, exchange, routingKey, false, false, msg)
+}
+
+func (c *Consumer) process(ctx context.Context, delivery amqp.Delivery) error {
+	handler, ok := c.handlers[delivery.RoutingKey]
+	if !ok {
+		return fmt.Errorf("%w: no handler for routing key %q", ErrPoisonMessage, delivery.RoutingKey)
+	}
+
+	if delivery.MessageId == "" {
+		return fmt.Errorf("%w: message has no id", ErrPoisonMessage)
+	}
+
+	claimed, err := c.processed.Claim(ctx, delivery.MessageId)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	if err := handler(ctx, delivery); err != nil {
+		if err := c.processed.Release(context.WithoutCancel(ctx), delivery.MessageId); err != nil {
+			log.Printf("Error releasing message %s: %v", delivery.MessageId, err)
+		}
+		return err
+	}
+
+	return c.processed.Complete(ctx, delivery.MessageId)
+}
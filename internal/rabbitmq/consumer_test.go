@@ -0,0 +1,323 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/mocks"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+type acknowledgerStub struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *acknowledgerStub) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *acknowledgerStub) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func (a *acknowledgerStub) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type processedStub map[string]bool
+
+func (p processedStub) Claim(ctx context.Context, id string) (bool, error) {
+	return !p[id], nil
+}
+
+func (p processedStub) Complete(ctx context.Context, id string) error {
+	p[id] = true
+	return nil
+}
+
+func (p processedStub) Release(ctx context.Context, id string) error {
+	delete(p, id)
+	return nil
+}
+
+// leasedElsewhere is a message another consumer is still handling.
+type leasedElsewhere struct{}
+
+func (leasedElsewhere) Claim(ctx context.Context, id string) (bool, error) {
+	return false, repository.ErrMessageInProgress
+}
+
+func (leasedElsewhere) Complete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (leasedElsewhere) Release(ctx context.Context, id string) error {
+	return nil
+}
+
+// recordRetries makes consumer keep the messages it sends to the retry queue.
+func recordRetries(consumer *Consumer, fail error) *[]amqp.Publishing {
+	retried := make([]amqp.Publishing, 0)
+	consumer.publish = func(ctx context.Context, exchange string, routingKey string, msg amqp.Publishing) error {
+		if fail != nil {
+			return fail
+		}
+		retried = append(retried, msg)
+		return nil
+	}
+	return &retried
+}
+
+func newTestConsumer(orders *mocks.OrderRepositoryMock) (*Consumer, processedStub) {
+	processed := processedStub{}
+	paid := models.OrderStatusPaid
+
+	consumer := &Consumer{
+		processed:  processed,
+		MaxRetries: 2,
+		handlers: map[string]MessageHandler{
+			PaymentSucceededRoutingKey:  OrderStatusHandler(orders, &paid),
+			InventoryReservedRoutingKey: OrderStatusHandler(orders, nil),
+			InventoryReleasedRoutingKey: OrderCancellationHandler(orders, InventoryReleasedCancellation),
+		},
+	}
+	return consumer, processed
+}
+
+func newDelivery(routingKey string, id string, body string) (amqp.Delivery, *acknowledgerStub) {
+	ack := &acknowledgerStub{}
+	return amqp.Delivery{
+		Acknowledger: ack,
+		RoutingKey:   routingKey,
+		MessageId:    id,
+		Body:         []byte(body),
+	}, ack
+}
+
+func TestConsumerAppliesStatusOnce(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	paid := models.OrderStatusPaid
+	orders.On("UpdateOne", mock.Anything, "1", models.UpdateOrderDTO{Status: &paid}).Return(&models.Order{Status: paid}, nil).Once()
+
+	consumer, processed := newTestConsumer(orders)
+
+	for i := 0; i < 2; i++ {
+		delivery, ack := newDelivery(PaymentSucceededRoutingKey, "message-1", `{"orderId": "1"}`)
+		consumer.handle(context.Background(), delivery)
+
+		if !ack.acked {
+			t.Errorf("delivery %d was not acked", i)
+		}
+	}
+
+	orders.AssertNumberOfCalls(t, "UpdateOne", 1)
+	if !processed["message-1"] {
+		t.Error("message was not recorded as processed")
+	}
+}
+
+func TestConsumerAppliesPaymentAfterFailedAttempt(t *testing.T) {
+	orders := repository.NewMemoryOrderRepository()
+	order, _ := orders.InsertOne(context.Background(), &models.Order{ID: primitive.NewObjectID(), UserID: "1", Status: models.OrderStatusPending})
+
+	paid := models.OrderStatusPaid
+	failed := models.OrderStatusFailed
+	consumer := &Consumer{
+		processed: processedStub{},
+		handlers: map[string]MessageHandler{
+			PaymentFailedRoutingKey:    OrderStatusHandler(orders, &failed),
+			PaymentSucceededRoutingKey: OrderStatusHandler(orders, &paid),
+		},
+	}
+
+	body := `{"orderId": "` + order.ID.Hex() + `"}`
+	for i, routingKey := range []string{PaymentFailedRoutingKey, PaymentSucceededRoutingKey} {
+		delivery, ack := newDelivery(routingKey, fmt.Sprintf("message-%d", i), body)
+		consumer.handle(context.Background(), delivery)
+
+		if !ack.acked {
+			t.Fatalf("%s was not acked", routingKey)
+		}
+	}
+
+	found, _ := orders.FindOne(context.Background(), order.ID.Hex())
+	if found.Status != paid {
+		t.Errorf("got status %s after a retried payment succeeded, want %s", found.Status, paid)
+	}
+}
+
+func TestConsumerRetriesMessagesLeasedElsewhere(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	consumer, _ := newTestConsumer(orders)
+	consumer.processed = leasedElsewhere{}
+	retried := recordRetries(consumer, nil)
+
+	delivery, _ := newDelivery(PaymentSucceededRoutingKey, "message-1", `{"orderId": "1"}`)
+	consumer.handle(context.Background(), delivery)
+
+	// the consumer holding the lease may die before it applied the status
+	if len(*retried) != 1 {
+		t.Error("a message somebody else is handling was not retried")
+	}
+	orders.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConsumerDropsStaleTransitions(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	orders.On("UpdateOne", mock.Anything, "1", mock.Anything).Return(nil,
+		&models.StatusTransitionError{From: models.OrderStatusCancelled, To: models.OrderStatusPaid})
+
+	consumer, _ := newTestConsumer(orders)
+
+	delivery, ack := newDelivery(PaymentSucceededRoutingKey, "message-1", `{"orderId": "1"}`)
+	consumer.handle(context.Background(), delivery)
+
+	if !ack.acked {
+		t.Error("stale transition was not acked")
+	}
+}
+
+func TestConsumerInventoryReservedIsNoop(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	consumer, _ := newTestConsumer(orders)
+
+	delivery, ack := newDelivery(InventoryReservedRoutingKey, "message-1", `{"orderId": "1"}`)
+	consumer.handle(context.Background(), delivery)
+
+	if !ack.acked {
+		t.Error("inventory.reserved was not acked")
+	}
+	orders.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConsumerCancelsReleasedInventory(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	isSystemCancellation := mock.MatchedBy(func(c models.Cancellation) bool {
+		return c.Reason == InventoryReleasedCancellation && c.CancelledBy == SystemCancelledBy && c.CancelledAt != ""
+	})
+	orders.On("Cancel", mock.Anything, "1", isSystemCancellation).Return(&models.Order{Status: models.OrderStatusCancelled}, nil).Once()
+	orders.On("Cancel", mock.Anything, "2", isSystemCancellation).Return(nil,
+		(&models.NotCancellableError{Status: models.OrderStatusShipped}).Conflict())
+
+	consumer, _ := newTestConsumer(orders)
+
+	for _, id := range []string{"1", "2"} {
+		delivery, ack := newDelivery(InventoryReleasedRoutingKey, "message-"+id, `{"orderId": "`+id+`"}`)
+		consumer.handle(context.Background(), delivery)
+
+		if !ack.acked {
+			t.Errorf("inventory.released for order %s was not acked", id)
+		}
+	}
+
+	orders.AssertExpectations(t)
+	orders.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConsumerRetriesFailedMessages(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	paid := models.OrderStatusPaid
+	orders.On("UpdateOne", mock.Anything, "1", mock.Anything).Return(nil, errors.New("connection reset")).Twice()
+	orders.On("UpdateOne", mock.Anything, "1", mock.Anything).Return(&models.Order{Status: paid}, nil).Once()
+
+	consumer, processed := newTestConsumer(orders)
+	retried := recordRetries(consumer, nil)
+
+	delivery, _ := newDelivery(PaymentSucceededRoutingKey, "message-1", `{"orderId": "1"}`)
+	delivery.CorrelationId = "correlation-1"
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		ack := &acknowledgerStub{}
+		delivery.Acknowledger = ack
+		consumer.handle(context.Background(), delivery)
+
+		if !ack.acked {
+			t.Fatalf("attempt %d was not acked", attempt)
+		}
+		if attempt < 3 {
+			if len(*retried) != attempt {
+				t.Fatalf("attempt %d was not sent to the retry queue", attempt)
+			}
+			next := (*retried)[attempt-1]
+			if retries(amqp.Delivery{Headers: next.Headers}) != attempt || next.MessageId != "message-1" || next.CorrelationId != "correlation-1" {
+				t.Fatalf("attempt %d was retried as %+v", attempt, next)
+			}
+			delivery.Headers = next.Headers
+		}
+	}
+
+	orders.AssertNumberOfCalls(t, "UpdateOne", 3)
+	if !processed["message-1"] {
+		t.Error("message was not recorded as processed")
+	}
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	orders.On("UpdateOne", mock.Anything, "missing", mock.Anything).Return(nil, repository.ErrOrderNotFound)
+	orders.On("UpdateOne", mock.Anything, "broken", mock.Anything).Return(nil, errors.New("connection reset"))
+
+	consumer, processed := newTestConsumer(orders)
+	retried := recordRetries(consumer, nil)
+
+	cases := []struct {
+		name       string
+		routingKey string
+		id         string
+		body       string
+		retries    int32
+	}{
+		{"malformed body", PaymentSucceededRoutingKey, "1", `{`, 0},
+		{"no order id", PaymentSucceededRoutingKey, "2", `{}`, 0},
+		{"no message id", PaymentSucceededRoutingKey, "", `{"orderId": "1"}`, 0},
+		{"unknown routing key", "payment.refunded", "3", `{"orderId": "1"}`, 0},
+		{"unknown order", PaymentSucceededRoutingKey, "4", `{"orderId": "missing"}`, 0},
+		{"out of retries", PaymentSucceededRoutingKey, "5", `{"orderId": "broken"}`, 2},
+	}
+
+	for _, tc := range cases {
+		delivery, ack := newDelivery(tc.routingKey, tc.id, tc.body)
+		delivery.Headers = amqp.Table{RetriesHeader: tc.retries}
+
+		consumer.handle(context.Background(), delivery)
+
+		if ack.acked || !ack.nacked || ack.requeue {
+			t.Errorf("%s: got acked %t, nacked %t, requeue %t, want it dead-lettered", tc.name, ack.acked, ack.nacked, ack.requeue)
+		}
+		if processed[tc.id] {
+			t.Errorf("%s: failed message was recorded as processed", tc.name)
+		}
+	}
+	if len(*retried) != 0 {
+		t.Errorf("got %d retries for messages that cannot be handled", len(*retried))
+	}
+}
+
+func TestConsumerRequeuesWithoutRetryQueue(t *testing.T) {
+	orders := &mocks.OrderRepositoryMock{}
+	orders.On("UpdateOne", mock.Anything, "1", mock.Anything).Return(nil, errors.New("connection reset"))
+
+	consumer, _ := newTestConsumer(orders)
+	recordRetries(consumer, ErrNotConnected)
+
+	for _, redelivered := range []bool{false, true} {
+		delivery, ack := newDelivery(PaymentSucceededRoutingKey, "message-1", `{"orderId": "1"}`)
+		delivery.Redelivered = redelivered
+
+		consumer.handle(context.Background(), delivery)
+
+		if ack.acked || !ack.nacked || ack.requeue == redelivered {
+			t.Errorf("redelivered %t: got acked %t, nacked %t, requeue %t", redelivered, ack.acked, ack.nacked, ack.requeue)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/correlation"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/repository"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+)
+
+// Routing keys of the payment and inventory events that drive the order status.
+const (
+	PaymentSucceededRoutingKey  = "payment.succeeded"
+	PaymentFailedRoutingKey     = "payment.failed"
+	InventoryReservedRoutingKey = "inventory.reserved"
+	InventoryReleasedRoutingKey = "inventory.released"
+)
+
+// OrderReferenceMessage is the part of a payment or inventory event the orders service reads.
+type OrderReferenceMessage struct {
+	OrderID string `json:"orderId"`
+}
+
+// Cancellations made by the orders service itself are recorded as made by
+// SystemCancelledBy.
+const (
+	SystemCancelledBy             = "system"
+	InventoryReleasedCancellation = "The reserved stock was released"
+)
+
+type orderRepository = repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery]
+
+// OrderStatusHandler moves the order referenced by a message to status. A nil
+// status only acknowledges the message. Events that arrive after the order has
+// moved on are dropped, since they cannot be applied anymore.
+func OrderStatusHandler(orders orderRepository, status *models.OrderStatus) MessageHandler {
+	if status == nil {
+		return orderHandler(nil)
+	}
+	return orderHandler(func(ctx context.Context, orderID string) error {
+		_, err := orders.UpdateOne(ctx, orderID, models.UpdateOrderDTO{Status: status})
+		return err
+	})
+}
+
+// OrderCancellationHandler cancels the order referenced by a message and
+// records reason as a cancellation by the system. Orders that can no longer be
+// cancelled are left alone.
+func OrderCancellationHandler(orders orderRepository, reason string) MessageHandler {
+	return orderHandler(func(ctx context.Context, orderID string) error {
+		_, err := orders.Cancel(ctx, orderID, models.NewCancellation(reason, SystemCancelledBy))
+		return err
+	})
+}
+
+// orderHandler decodes the order reference of a message and passes it to
+// apply, a nil apply only acknowledges the message.
+func orderHandler(apply func(ctx context.Context, orderID string) error) MessageHandler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		var message OrderReferenceMessage
+		if err := json.Unmarshal(delivery.Body, &message); err != nil {
+			return fmt.Errorf("%w: %v", ErrPoisonMessage, err)
+		}
+		if message.OrderID == "" {
+			return fmt.Errorf("%w: message references no order", ErrPoisonMessage)
+		}
+
+		if apply == nil {
+			return nil
+		}
+
+		if delivery.CorrelationId != "" {
+			ctx = correlation.WithID(ctx, delivery.CorrelationId)
+		}
+
+		err := apply(ctx, message.OrderID)
+
+		var transitionErr *models.StatusTransitionError
+		var notCancellableErr *models.NotCancellableError
+		if errors.As(err, &transitionErr) || errors.As(err, &notCancellableErr) {
+			log.Printf("Ignoring %s for order %s: %v", delivery.RoutingKey, message.OrderID, err)
+			return nil
+		}
+		// retrying cannot make an order appear
+		if apperrors.Is(err, apperrors.KindNotFound) || apperrors.Is(err, apperrors.KindInvalidID) {
+			return fmt.Errorf("%w: %v", ErrPoisonMessage, err)
+		}
+		return err
+	}
+}
+
+// HandleOrderStatusEvents subscribes the consumer to the payment and inventory
+// events that change the order status.
+func HandleOrderStatusEvents(
+	consumer *Consumer,
+	orders orderRepository,
+	paymentsExchange string,
+	inventoryExchange string,
+) error {
+	paid := models.OrderStatusPaid
+	failed := models.OrderStatusFailed
+
+	subscriptions := []struct {
+		exchange   string
+		routingKey string
+		handler    MessageHandler
+	}{
+		{paymentsExchange, PaymentSucceededRoutingKey, OrderStatusHandler(orders, &paid)},
+		{paymentsExchange, PaymentFailedRoutingKey, OrderStatusHandler(orders, &failed)},
+		// reserving stock does not change the status, the order waits for its payment
+		{inventoryExchange, InventoryReservedRoutingKey, OrderStatusHandler(orders, nil)},
+		{inventoryExchange, InventoryReleasedRoutingKey, OrderCancellationHandler(orders, InventoryReleasedCancellation)},
+	}
+
+	for _, s := range subscriptions {
+		if err := consumer.Handle(s.exchange, s.routingKey, s.handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/metrics"
+	"github.com/mycandys/orders/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// ErrNotConfirmed is returned when the broker rejected a published message.
+var ErrNotConfirmed = errors.New("message was not confirmed by the broker")
+
+// Publisher publishes to a topic exchange on its own channel in confirm mode,
+// so Publish only succeeds once the broker has taken responsibility for the
+// message. The channel is reopened when the broker closes it and whenever the
+// connection comes back.
+type Publisher struct {
+	exchange string
+	// the channel is not safe for concurrent publishes in confirm mode
+	mu sync.Mutex
+	ch *amqp.Channel
+}
+
+func NewPublisher(conn *Connection, exchange string) (*Publisher, error) {
+	p := &Publisher{exchange: exchange}
+	return p, conn.OnConnect(p.open)
+}
+
+func (p *Publisher) open(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return err
+	}
+
+	if err := ch.ExchangeDeclare(p.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		_ = ch.Close()
+		return err
+	}
+
+	p.mu.Lock()
+	p.ch = ch
+	p.mu.Unlock()
+
+	go watchChannel(conn, closed, p.open)
+
+	return nil
+}
+
+// Publish sends msg with the routing key and waits for the broker confirmation.
+func (p *Publisher) Publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	ctx, span := startPublishSpan(ctx, p.exchange, routingKey, &msg)
+	defer span.End()
+
+	err := p.publish(ctx, routingKey, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.ObservePublish(p.exchange, metrics.ResultFailure)
+	} else {
+		metrics.ObservePublish(p.exchange, metrics.ResultSuccess)
+	}
+	return err
+}
+
+// startPublishSpan starts a producer span and passes its context on in the message headers.
+func startPublishSpan(ctx context.Context, exchange string, routingKey string, msg *amqp.Publishing) (context.Context, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("%s publish", routingKey),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("rabbitmq"),
+			semconv.MessagingDestinationName(exchange),
+			semconv.MessagingRabbitmqDestinationRoutingKey(routingKey),
+			semconv.MessagingMessageID(msg.MessageId),
+		),
+	)
+	tracing.InjectAMQP(ctx, msg)
+	return ctx, span
+}
+
+func (p *Publisher) publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	if p.ch == nil || p.ch.IsClosed() {
+		p.mu.Unlock()
+		return ErrNotConnected
+	}
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, routingKey, false, false, msg)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("%w: %s", ErrNotConfirmed, routingKey)
+	}
+
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch == nil || p.ch.IsClosed() {
+		return nil
+	}
+	return p.ch.Close()
+}
@@ -2,50 +2,54 @@ package rabbitmq
 
 import (
 	"context"
-	"github.com/mycandys/orders/internal/env"
+	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log"
+	"time"
 )
 
-var Ch *amqp.Channel
-
-func Connect() *amqp.Connection {
-	url, _ := env.GetEnvVar(env.RABBITMQ_URL)
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		log.Fatalf("Error connecting to RabbitMQ: %v", err)
-
+// Connect connects to the broker at url. When the broker is not reachable yet
+// the connection keeps retrying in the background.
+func Connect(url string, policy OfflinePolicy, bufferSize int) (*Connection, error) {
+	if policy != OfflineBuffer && policy != OfflineDrop {
+		return nil, fmt.Errorf("invalid offline policy %q, must be buffer or drop", policy)
 	}
 
-	Ch, err = conn.Channel()
-	if err != nil {
-		log.Fatalf("Error opening RabbitMQ channel: %v", err)
+	conn := NewConnection(url, policy, bufferSize)
+	if err := conn.Start(); err != nil {
+		log.Printf("Error connecting to RabbitMQ, retrying in the background: %v", err)
 	}
 
-	return conn
+	return conn, nil
 }
 
-func Close(conn *amqp.Connection) {
-	if err := conn.Close(); err != nil {
-		log.Fatalf("Error closing RabbitMQ connection: %v", err)
+func Close(c *Connection) {
+	if err := c.Close(); err != nil {
+		log.Printf("Error closing RabbitMQ connection: %v", err)
 	}
 }
 
-func DeclareQueue(name string) amqp.Queue {
-	q, err := Ch.QueueDeclare(name, true, false, false, false, nil)
-	if err != nil {
-		log.Fatalf("Error declaring RabbitMQ queue: %v", err)
-	}
-	return q
+// QueuePublisher sends JSON messages to a durable queue without waiting for
+// confirmations.
+type QueuePublisher struct {
+	conn     *Connection
+	exchange string
+	queue    string
 }
 
-func Publish(exchangeName string, queueName string, body []byte, ctx context.Context) {
-	err := Ch.PublishWithContext(ctx, exchangeName, queueName, false, false, amqp.Publishing{
+// NewQueuePublisher declares queue now and again after every reconnect. The
+// returned publisher is usable even if declaring failed.
+func NewQueuePublisher(conn *Connection, exchange string, queue string) (*QueuePublisher, error) {
+	publisher := &QueuePublisher{conn: conn, exchange: exchange, queue: queue}
+	return publisher, conn.DeclareQueue(queue)
+}
+
+// Publish sends body to the queue. While the broker is unreachable the message
+// is buffered or dropped as configured.
+func (p *QueuePublisher) Publish(ctx context.Context, body []byte) error {
+	return p.conn.Publish(ctx, p.exchange, p.queue, amqp.Publishing{
 		ContentType: "application/json",
+		Timestamp:   time.Now(),
 		Body:        body,
 	})
-	if err != nil {
-		log.Fatalf("Error publishing message to RabbitMQ: %v", err)
-	}
-
 }
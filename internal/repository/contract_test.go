@@ -0,0 +1,569 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type orderRepository = IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, OrderQuery]
+
+// contractSubject is a fresh, empty repository together with the types of the
+// events it wrote so far.
+type contractSubject struct {
+	orders orderRepository
+	events func() []models.OrderEventType
+}
+
+// runOrderRepositoryContract checks the behaviour every order repository must
+// share, newSubject is called once per case.
+func runOrderRepositoryContract(t *testing.T, newSubject func(t *testing.T) contractSubject) {
+	ctx := context.Background()
+
+	t.Run("find one", func(t *testing.T) {
+		s := newSubject(t)
+		order := contractOrder("1", models.OrderStatusPending, 1000, "2024-01-01 10:00:00")
+		insert(t, s, order)
+
+		found, err := s.orders.FindOne(ctx, order.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != order.ID || found.UserID != "1" || found.Price.Total != order.Price.Total || len(found.Items) != 1 {
+			t.Errorf("got %+v want %+v", found, order)
+		}
+
+		_, err = s.orders.FindOne(ctx, primitive.NewObjectID().Hex())
+		assertKind(t, err, apperrors.KindNotFound)
+
+		_, err = s.orders.FindOne(ctx, "abc")
+		assertKind(t, err, apperrors.KindInvalidID)
+
+		assertEvents(t, s, models.OrderCreated)
+	})
+
+	t.Run("pages through all orders", func(t *testing.T) {
+		s := newSubject(t)
+		insert(t, s,
+			contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00"),
+			contractOrder("1", models.OrderStatusPaid, 300, "2024-01-02 10:00:00"),
+			contractOrder("1", models.OrderStatusPaid, 900, "2024-01-02 10:00:00"),
+			contractOrder("1", models.OrderStatusShipped, 100, "2024-01-03 10:00:00"),
+			contractOrder("1", models.OrderStatusPending, 700, "2024-01-04 10:00:00"),
+		)
+
+		for _, query := range []OrderQuery{
+			{Limit: 2, Descending: true},
+			{Limit: 2, SortBy: SortByCost},
+			{Limit: 3, SortBy: SortByStatus, Descending: true},
+		} {
+			all := collect(t, s, query)
+			if len(all) != 5 {
+				t.Fatalf("%+v: got %d orders want 5", query, len(all))
+			}
+
+			seen := make(map[primitive.ObjectID]bool)
+			for i, order := range all {
+				if seen[order.ID] {
+					t.Errorf("%+v: order %s returned twice", query, order.ID.Hex())
+				}
+				seen[order.ID] = true
+
+				if i == 0 {
+					continue
+				}
+				field := query.sortField()
+				c := compareSortKeys(field.value(all[i-1]), all[i-1].ID, field.value(order), order.ID)
+				if (query.Descending && c <= 0) || (!query.Descending && c >= 0) {
+					t.Errorf("%+v: orders %d and %d are out of order", query, i-1, i)
+				}
+			}
+		}
+
+		page, err := s.orders.FindAll(ctx, OrderQuery{Limit: 2, SortBy: SortByCost})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, query := range []OrderQuery{
+			{Limit: 2, Cursor: page.NextCursor},
+			{Limit: 2, SortBy: SortByCost, Descending: true, Cursor: page.NextCursor},
+		} {
+			_, err := s.orders.FindAll(ctx, query)
+			assertKind(t, err, apperrors.KindValidation)
+			if err == nil || !strings.Contains(err.Error(), "cost asc") {
+				t.Errorf("%+v: got %v want an error naming the sort of the cursor", query, err)
+			}
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		s := newSubject(t)
+		insert(t, s,
+			contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00"),
+			contractOrder("1", models.OrderStatusPaid, 300, "2024-01-02 10:00:00"),
+			contractOrder("2", models.OrderStatusPaid, 900, "2024-01-03 10:00:00"),
+		)
+
+		from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+		minCost, maxCost := int64(400), int64(900)
+		// the same window around the second order, seen from UTC+2
+		zone := time.FixedZone("UTC+2", 2*60*60)
+		zonedFrom := time.Date(2024, 1, 2, 11, 0, 0, 0, zone)
+		zonedTo := time.Date(2024, 1, 2, 13, 0, 0, 0, zone)
+
+		cases := []struct {
+			name  string
+			find  func() (*Page[*models.Order], error)
+			total int64
+		}{
+			{"all", func() (*Page[*models.Order], error) { return s.orders.FindAll(ctx, OrderQuery{}) }, 3},
+			{"user", func() (*Page[*models.Order], error) { return s.orders.FindByUser(ctx, "1", OrderQuery{}) }, 2},
+			{"status", func() (*Page[*models.Order], error) {
+				return s.orders.FindByStatus(ctx, models.OrderStatusPaid, OrderQuery{})
+			}, 2},
+			{"user and status", func() (*Page[*models.Order], error) {
+				return s.orders.FindByUserAndStatus(ctx, "1", models.OrderStatusPaid, OrderQuery{})
+			}, 1},
+			{"created", func() (*Page[*models.Order], error) {
+				return s.orders.FindAll(ctx, OrderQuery{CreatedFrom: &from, CreatedTo: &to})
+			}, 1},
+			{"created with offset", func() (*Page[*models.Order], error) {
+				return s.orders.FindAll(ctx, OrderQuery{CreatedFrom: &zonedFrom, CreatedTo: &zonedTo})
+			}, 1},
+			{"cost", func() (*Page[*models.Order], error) {
+				return s.orders.FindAll(ctx, OrderQuery{MinCost: &minCost, MaxCost: &maxCost})
+			}, 2},
+		}
+
+		for _, tc := range cases {
+			page, err := tc.find()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if page.Total != tc.total || int64(len(page.Items)) != tc.total {
+				t.Errorf("%s: got %d orders and total %d want %d", tc.name, len(page.Items), page.Total, tc.total)
+			}
+		}
+
+		_, err := s.orders.FindAll(ctx, OrderQuery{Cursor: "not a cursor"})
+		assertKind(t, err, apperrors.KindValidation)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := newSubject(t)
+		order := contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00")
+		insert(t, s, order)
+
+		paid := models.OrderStatusPaid
+		updated, err := s.orders.UpdateOne(ctx, order.ID.Hex(), models.UpdateOrderDTO{Status: &paid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Status != paid || updated.UpdatedAt == "" {
+			t.Errorf("got status %s updated at %q", updated.Status, updated.UpdatedAt)
+		}
+
+		deliveredAt := "2024-01-05 10:00:00"
+		updated, err = s.orders.UpdateOne(ctx, order.ID.Hex(), models.UpdateOrderDTO{DeliveredAt: &deliveredAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Status != paid || updated.DeliveredAt != deliveredAt {
+			t.Errorf("an update without status changed it or lost the delivery date: %+v", updated)
+		}
+
+		pending := models.OrderStatusPending
+		_, err = s.orders.UpdateOne(ctx, order.ID.Hex(), models.UpdateOrderDTO{Status: &pending})
+		assertKind(t, err, apperrors.KindConflict)
+
+		_, err = s.orders.UpdateOne(ctx, primitive.NewObjectID().Hex(), models.UpdateOrderDTO{Status: &paid})
+		assertKind(t, err, apperrors.KindNotFound)
+
+		assertEvents(t, s, models.OrderCreated, models.OrderStatusChanged)
+	})
+
+	t.Run("partial update", func(t *testing.T) {
+		s := newSubject(t)
+		pending := contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00")
+		pending.Address, pending.Country, pending.City, pending.PostalCode = "Main Street 1", "DE", "Berlin", "10115"
+		pending.ExpectedDeliveryDate = "2024-01-08"
+		paid := contractOrder("1", models.OrderStatusPaid, 500, "2024-01-01 10:00:00")
+		paid.City = "Berlin"
+		insert(t, s, pending, paid)
+
+		city, notes := "Hamburg", "ring twice"
+		updated, err := s.orders.UpdateOne(ctx, pending.ID.Hex(), models.UpdateOrderDTO{City: &city, Notes: &notes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.City != city || updated.Notes != notes {
+			t.Errorf("got city %q and notes %q want %q and %q", updated.City, updated.Notes, city, notes)
+		}
+		if updated.Address != pending.Address || updated.PostalCode != pending.PostalCode || updated.ExpectedDeliveryDate != pending.ExpectedDeliveryDate || updated.Status != pending.Status {
+			t.Errorf("fields missing from the update changed: %+v", updated)
+		}
+
+		cleared := ""
+		updated, err = s.orders.UpdateOne(ctx, pending.ID.Hex(), models.UpdateOrderDTO{Notes: &cleared})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Notes != "" || updated.City != city {
+			t.Errorf("got %+v after clearing the notes", updated)
+		}
+
+		_, err = s.orders.UpdateOne(ctx, paid.ID.Hex(), models.UpdateOrderDTO{City: &city})
+		assertKind(t, err, apperrors.KindConflict)
+
+		found, _ := s.orders.FindOne(ctx, paid.ID.Hex())
+		if found.City != "Berlin" {
+			t.Errorf("the address of a paid order changed to %q", found.City)
+		}
+
+		// the address rule applies to the status before the update
+		shipped := models.OrderStatusShipped
+		_, err = s.orders.UpdateOne(ctx, paid.ID.Hex(), models.UpdateOrderDTO{Status: &shipped, City: &city})
+		assertKind(t, err, apperrors.KindConflict)
+
+		updated, err = s.orders.UpdateOne(ctx, pending.ID.Hex(), models.UpdateOrderDTO{Status: &shipped, City: &cleared})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Status != shipped || updated.City != "" {
+			t.Errorf("got %+v", updated)
+		}
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		s := newSubject(t)
+		order := contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00")
+		insert(t, s, order)
+
+		found, err := s.orders.FindOne(ctx, order.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Version != 1 {
+			t.Errorf("got version %d after insert want 1", found.Version)
+		}
+
+		deliveredAt := "2024-01-05 10:00:00"
+		updated, err := s.orders.UpdateOne(ctx, order.ID.Hex(), models.UpdateOrderDTO{DeliveredAt: &deliveredAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Version != 2 {
+			t.Errorf("got version %d after update want 2", updated.Version)
+		}
+
+		paid := models.OrderStatusPaid
+		swapped, err := s.orders.CompareAndSwap(ctx, order.ID.Hex(), 2, models.UpdateOrderDTO{Status: &paid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if swapped.Version != 3 || swapped.Status != paid {
+			t.Errorf("got version %d and status %s want 3 and %s", swapped.Version, swapped.Status, paid)
+		}
+
+		shipped := models.OrderStatusShipped
+		_, err = s.orders.CompareAndSwap(ctx, order.ID.Hex(), 2, models.UpdateOrderDTO{Status: &shipped})
+		assertKind(t, err, apperrors.KindPreconditionFailed)
+
+		found, _ = s.orders.FindOne(ctx, order.ID.Hex())
+		if found.Status != paid || found.Version != 3 {
+			t.Errorf("a stale compare-and-swap wrote the order: %+v", found)
+		}
+
+		cancelled, err := s.orders.Cancel(ctx, order.ID.Hex(), models.NewCancellation("changed my mind", "1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cancelled.Version != 4 {
+			t.Errorf("got version %d after cancel want 4", cancelled.Version)
+		}
+
+		_, err = s.orders.CompareAndSwap(ctx, primitive.NewObjectID().Hex(), 1, models.UpdateOrderDTO{Status: &paid})
+		assertKind(t, err, apperrors.KindNotFound)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		s := newSubject(t)
+		pending := contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00")
+		shipped := contractOrder("1", models.OrderStatusShipped, 500, "2024-01-01 10:00:00")
+		insert(t, s, pending, shipped)
+
+		cancelled, err := s.orders.Cancel(ctx, pending.ID.Hex(), models.NewCancellation("changed my mind", "1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cancelled.Status != models.OrderStatusCancelled || cancelled.Cancellation == nil || cancelled.Cancellation.Reason != "changed my mind" {
+			t.Errorf("got %+v", cancelled)
+		}
+		cancelledAt, _ := time.Parse(time.DateTime, cancelled.Cancellation.CancelledAt)
+		updatedAt, _ := time.Parse(time.DateTime, cancelled.UpdatedAt)
+		if updatedAt.Sub(cancelledAt).Abs() > time.Minute {
+			t.Errorf("cancelled at %s but updated at %s", cancelled.Cancellation.CancelledAt, cancelled.UpdatedAt)
+		}
+
+		_, err = s.orders.Cancel(ctx, shipped.ID.Hex(), models.NewCancellation("too late", "1"))
+		assertKind(t, err, apperrors.KindConflict)
+
+		found, _ := s.orders.FindOne(ctx, shipped.ID.Hex())
+		if found.Status != models.OrderStatusShipped {
+			t.Errorf("a rejected cancellation changed the status to %s", found.Status)
+		}
+
+		assertEvents(t, s, models.OrderCreated, models.OrderCreated, models.OrderStatusChanged)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newSubject(t)
+		first := contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00")
+		second := contractOrder("1", models.OrderStatusPending, 500, "2024-01-02 10:00:00")
+		other := contractOrder("2", models.OrderStatusPending, 500, "2024-01-03 10:00:00")
+		insert(t, s, first, second, other)
+
+		deleted, err := s.orders.DeleteOne(ctx, first.ID.Hex())
+		if err != nil || deleted.ID != first.ID {
+			t.Fatalf("got %v, %v", deleted, err)
+		}
+
+		_, err = s.orders.DeleteOne(ctx, first.ID.Hex())
+		assertKind(t, err, apperrors.KindNotFound)
+
+		if err := s.orders.DeleteAllByUser(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := s.orders.FindAll(ctx, OrderQuery{})
+		if page.Total != 1 || page.Items[0].ID != other.ID {
+			t.Errorf("got %d orders want only the other user's", page.Total)
+		}
+
+		if err := s.orders.DeleteAll(ctx); err != nil {
+			t.Fatal(err)
+		}
+		page, _ = s.orders.FindAll(ctx, OrderQuery{})
+		if page.Total != 0 {
+			t.Errorf("got %d orders after deleting all", page.Total)
+		}
+
+		assertEvents(t, s,
+			models.OrderCreated, models.OrderCreated, models.OrderCreated,
+			models.OrderDeleted, models.OrderDeleted, models.OrderDeleted,
+		)
+	})
+
+	t.Run("delete more than a batch", func(t *testing.T) {
+		s := newSubject(t)
+		for i := 0; i < deleteBatchSize+1; i++ {
+			insert(t, s, contractOrder("1", models.OrderStatusPending, 500, "2024-01-01 10:00:00"))
+		}
+
+		if err := s.orders.DeleteAllByUser(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		page, _ := s.orders.FindAll(ctx, OrderQuery{})
+		if page.Total != 0 {
+			t.Errorf("got %d orders left after deleting all", page.Total)
+		}
+
+		deleted := 0
+		for _, event := range s.events() {
+			if event == models.OrderDeleted {
+				deleted++
+			}
+		}
+		if deleted != deleteBatchSize+1 {
+			t.Errorf("got %d deletion events want %d", deleted, deleteBatchSize+1)
+		}
+	})
+}
+
+func contractOrder(userId string, status models.OrderStatus, total int64, createdAt string) *models.Order {
+	return &models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: userId,
+		Items:  []models.Item{{ID: "1", Name: "candy", Price: models.NewMoney(total, "EUR"), Quantity: 1}},
+		Price: models.PriceBreakdown{
+			Subtotal: models.NewMoney(total, "EUR"),
+			Tax:      models.NewMoney(0, "EUR"),
+			Shipping: models.NewMoney(0, "EUR"),
+			Discount: models.NewMoney(0, "EUR"),
+			Total:    models.NewMoney(total, "EUR"),
+		},
+		Status:    status,
+		CreatedAt: createdAt,
+	}
+}
+
+func insert(t *testing.T, s contractSubject, orders ...*models.Order) {
+	t.Helper()
+	for _, order := range orders {
+		if _, err := s.orders.InsertOne(context.Background(), order); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// collect follows the cursors of query until the last page.
+func collect(t *testing.T, s contractSubject, query OrderQuery) []*models.Order {
+	t.Helper()
+
+	all := make([]*models.Order, 0)
+	for pages := 0; pages < 10; pages++ {
+		page, err := s.orders.FindAll(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 {
+			t.Errorf("%+v: got total %d want 5", query, page.Total)
+		}
+		if int64(len(page.Items)) > query.limit() {
+			t.Errorf("%+v: got %d orders on a page", query, len(page.Items))
+		}
+
+		all = append(all, page.Items...)
+		if page.NextCursor == "" {
+			return all
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	t.Fatalf("%+v: paging did not end", query)
+	return nil
+}
+
+func assertKind(t *testing.T, err error, kind apperrors.Kind) {
+	t.Helper()
+	if !apperrors.Is(err, kind) {
+		t.Errorf("got error %v want kind %s", err, kind)
+	}
+}
+
+func assertEvents(t *testing.T, s contractSubject, want ...models.OrderEventType) {
+	t.Helper()
+
+	got := s.events()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got events %v want %v", got, want)
+	}
+}
+
+func TestMemoryOrderRepositoryContract(t *testing.T) {
+	runOrderRepositoryContract(t, func(t *testing.T) contractSubject {
+		orders := NewMemoryOrderRepository()
+		return contractSubject{
+			orders: orders,
+			events: func() []models.OrderEventType {
+				types := make([]models.OrderEventType, 0)
+				for _, event := range orders.Events() {
+					types = append(types, event.Type)
+				}
+				return types
+			},
+		}
+	})
+}
+
+func TestMemoryOrderRepositoryConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	orders := NewMemoryOrderRepository()
+	paid := models.OrderStatusPaid
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			order := contractOrder(fmt.Sprint(i%3), models.OrderStatusPending, int64(i), "2024-01-01 10:00:00")
+			if _, err := orders.InsertOne(ctx, order); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := orders.UpdateOne(ctx, order.ID.Hex(), models.UpdateOrderDTO{Status: &paid}); err != nil {
+				t.Error(err)
+			}
+			if _, err := orders.FindByUser(ctx, order.UserID, OrderQuery{Limit: 2}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	page, _ := orders.FindByStatus(ctx, paid, OrderQuery{})
+	if page.Total != 20 {
+		t.Errorf("got %d paid orders want 20", page.Total)
+	}
+	if events := len(orders.Events()); events != 40 {
+		t.Errorf("got %d events want 40", events)
+	}
+}
+
+// TestMongoOrderRepositoryContract needs a replica set for transactions, e.g.
+// TEST_DATABASE_URL=mongodb://localhost:27017/?replicaSet=rs0
+func TestMongoOrderRepositoryContract(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+
+	runOrderRepositoryContract(t, func(t *testing.T) contractSubject {
+		if err := db.Drop(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		outbox := &OutboxRepository{coll: db.Collection("outbox")}
+		return contractSubject{
+			orders: &OrderRepository{coll: db.Collection("orders"), outbox: outbox},
+			events: func() []models.OrderEventType {
+				cursor, err := outbox.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var messages []*OutboxMessage
+				if err := cursor.All(ctx, &messages); err != nil {
+					t.Fatal(err)
+				}
+
+				types := make([]models.OrderEventType, 0, len(messages))
+				for _, message := range messages {
+					types = append(types, message.Event.Type)
+				}
+				return types
+			},
+		}
+	})
+}
+
+// testDatabase connects to TEST_DATABASE_URL and returns a fresh database that
+// is dropped after the test, the test is skipped without the variable.
+func testDatabase(t *testing.T) *mongo.Database {
+	uri := os.Getenv("TEST_DATABASE_URL")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	db := client.Database(fmt.Sprintf("orders_contract_%d", time.Now().UnixNano()))
+	t.Cleanup(func() { _ = db.Drop(ctx) })
+
+	return db
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// idempotencyLease is how long a reservation blocks retries before it is
+// considered abandoned by a crashed request and may be taken over.
+const idempotencyLease = time.Minute
+
+// IdempotencyRecord remembers the request made with an idempotency key and,
+// once it completed, the response it was answered with.
+type IdempotencyRecord struct {
+	Key                 string     `bson:"_id"`
+	RequestHash         string     `bson:"request_hash"`
+	ResponseStatus      int        `bson:"response_status,omitempty"`
+	ResponseContentType string     `bson:"response_content_type,omitempty"`
+	ResponseBody        []byte     `bson:"response_body,omitempty"`
+	CreatedAt           time.Time  `bson:"created_at"`
+	CompletedAt         *time.Time `bson:"completed_at,omitempty"`
+	ExpiresAt           time.Time  `bson:"expires_at"`
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.CompletedAt != nil
+}
+
+type IIdempotencyRepository interface {
+	// Reserve claims key for a request with the given body hash. It returns nil
+	// when the caller holds the reservation and the existing record otherwise.
+	Reserve(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error)
+	// Complete stores the response of a reserved key so retries can replay it.
+	Complete(ctx context.Context, key string, status int, contentType string, body []byte) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type IdempotencyRepository struct {
+	coll *mongo.Collection
+	// TTL is how long keys are remembered.
+	TTL time.Duration
+	// timeout is the deadline of every single operation
+	timeout time.Duration
+}
+
+// NewIdempotencyRepository remembers keys in db for ttl, every operation is
+// bounded by timeout.
+func NewIdempotencyRepository(db *mongo.Database, ttl time.Duration, timeout time.Duration) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		coll:    db.Collection("idempotency_keys"),
+		TTL:     ttl,
+		timeout: timeout,
+	}
+}
+
+func (r *IdempotencyRepository) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error) {
+	return observe(ctx, r.timeout, "idempotency_keys", "reserve", func(ctx context.Context) (*IdempotencyRecord, error) {
+		return r.reserve(ctx, key, requestHash)
+	})
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	return observeErr(ctx, r.timeout, "idempotency_keys", "complete", func(ctx context.Context) error {
+		return r.complete(ctx, key, status, contentType, body)
+	})
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	return observeErr(ctx, r.timeout, "idempotency_keys", "release", func(ctx context.Context) error {
+		return r.release(ctx, key)
+	})
+}
+
+func (r *IdempotencyRepository) reserve(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error) {
+	// the record may expire between the failed insert and the lookup, so try twice
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record := &IdempotencyRecord{
+			Key:         key,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(r.TTL),
+		}
+
+		// the unique _id makes sure only one of several concurrent requests wins
+		_, err := r.coll.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		abandoned := bson.D{
+			{Key: "_id", Value: key},
+			{Key: "request_hash", Value: requestHash},
+			{Key: "completed_at", Value: nil},
+			{Key: "created_at", Value: bson.D{{Key: "$lt", Value: now.Add(-idempotencyLease)}}},
+		}
+		err = r.coll.FindOneAndReplace(ctx, abandoned, record).Err()
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		var existing IdempotencyRecord
+		err = r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&existing)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+
+	return nil, errors.New("could not reserve idempotency key")
+}
+
+func (r *IdempotencyRepository) complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	_, err := r.coll.UpdateByID(ctx, key, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "response_status", Value: status},
+			{Key: "response_content_type", Value: contentType},
+			{Key: "response_body", Value: body},
+			{Key: "completed_at", Value: time.Now()},
+		}},
+	})
+	return err
+}
+
+func (r *IdempotencyRepository) release(ctx context.Context, key string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		{Key: "completed_at", Value: nil},
+	})
+	return err
+}
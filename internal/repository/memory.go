@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"sync"
+)
+
+// MemoryOrderRepository keeps orders in memory for tests and local development.
+// It follows the same rules as OrderRepository, including paging, status
+// transitions and the events written for every change, and is safe for
+// concurrent use.
+type MemoryOrderRepository struct {
+	mu     sync.RWMutex
+	orders map[primitive.ObjectID]*models.Order
+	events []*models.OrderEvent
+}
+
+func NewMemoryOrderRepository() *MemoryOrderRepository {
+	return &MemoryOrderRepository{
+		orders: make(map[primitive.ObjectID]*models.Order),
+	}
+}
+
+// cloneOrder copies order so callers cannot change stored orders behind the
+// repository's back.
+func cloneOrder(order *models.Order) *models.Order {
+	clone := *order
+	if order.Items != nil {
+		clone.Items = append([]models.Item(nil), order.Items...)
+	}
+	if order.Cancellation != nil {
+		cancellation := *order.Cancellation
+		clone.Cancellation = &cancellation
+	}
+	return &clone
+}
+
+// Events returns the events the Mongo repository would have written to the
+// outbox, oldest first.
+func (r *MemoryOrderRepository) Events() []*models.OrderEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*models.OrderEvent(nil), r.events...)
+}
+
+func (r *MemoryOrderRepository) FindOne(ctx context.Context, id string) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	order, ok := r.orders[objectId]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return cloneOrder(order), nil
+}
+
+func (r *MemoryOrderRepository) FindMany(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	var afterValue interface{}
+	var afterId primitive.ObjectID
+	if query.Cursor != "" {
+		var err error
+		if afterValue, afterId, err = query.after(); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	orders := make([]*models.Order, 0)
+	for _, order := range r.orders {
+		if query.matches(order) {
+			orders = append(orders, cloneOrder(order))
+		}
+	}
+	r.mu.RUnlock()
+
+	field := query.sortField()
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return direction*compareSortKeys(field.value(orders[i]), orders[i].ID, field.value(orders[j]), orders[j].ID) < 0
+	})
+
+	page := &Page[*models.Order]{Items: make([]*models.Order, 0), Total: int64(len(orders))}
+	limit := query.limit()
+
+	for _, order := range orders {
+		if query.Cursor != "" && direction*compareSortKeys(field.value(order), order.ID, afterValue, afterId) <= 0 {
+			continue
+		}
+		if int64(len(page.Items)) == limit {
+			page.NextCursor = query.nextCursor(page.Items[limit-1])
+			break
+		}
+		page.Items = append(page.Items, order)
+	}
+
+	return page, nil
+}
+
+// compareSortKeys orders two (sort value, id) pairs the way Mongo sorts them.
+func compareSortKeys(a interface{}, aId primitive.ObjectID, b interface{}, bId primitive.ObjectID) int {
+	var result int
+	switch a := a.(type) {
+	case int64:
+		result = cmp.Compare(a, b.(int64))
+	case string:
+		result = cmp.Compare(a, b.(string))
+	}
+	if result != 0 {
+		return result
+	}
+	return bytes.Compare(aId[:], bId[:])
+}
+
+func (r *MemoryOrderRepository) FindAll(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	return r.FindMany(ctx, query)
+}
+
+func (r *MemoryOrderRepository) FindByUser(ctx context.Context, id string, query OrderQuery) (*Page[*models.Order], error) {
+	query.UserID = id
+	return r.FindMany(ctx, query)
+}
+
+func (r *MemoryOrderRepository) FindByStatus(ctx context.Context, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	query.Status = status
+	return r.FindMany(ctx, query)
+}
+
+func (r *MemoryOrderRepository) FindByUserAndStatus(ctx context.Context, id string, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	query.UserID = id
+	query.Status = status
+	return r.FindMany(ctx, query)
+}
+
+func (r *MemoryOrderRepository) InsertOne(ctx context.Context, order *models.Order) (*models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.orders[order.ID]; exists {
+		return nil, fmt.Errorf("order %s already exists", order.ID.Hex())
+	}
+
+	order.Version = 1
+	r.orders[order.ID] = cloneOrder(order)
+	r.events = append(r.events, newEvent(ctx, models.OrderCreated, cloneOrder(order)))
+
+	return order, nil
+}
+
+func (r *MemoryOrderRepository) UpdateOne(ctx context.Context, id string, data models.UpdateOrderDTO) (*models.Order, error) {
+	return r.update(ctx, id, nil, data)
+}
+
+func (r *MemoryOrderRepository) CompareAndSwap(ctx context.Context, id string, version int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	return r.update(ctx, id, &version, data)
+}
+
+func (r *MemoryOrderRepository) update(ctx context.Context, id string, version *int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.orders[objectId]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if version != nil && current.Version != *version {
+		return nil, ErrVersionMismatch
+	}
+
+	if data.Status != nil {
+		if err := models.ValidateStatusTransition(current.Status, *data.Status); err != nil {
+			return nil, err.(*models.StatusTransitionError).Conflict()
+		}
+	}
+	if data.ChangesAddress() {
+		if err := models.ValidateAddressChange(current.Status); err != nil {
+			return nil, err.(*models.AddressNotEditableError).Conflict()
+		}
+	}
+
+	order := cloneOrder(current)
+	order.UpdatedAt = models.Timestamp()
+	order.Version++
+	assignIfSupplied(&order.Status, data.Status)
+	assignIfSupplied(&order.DeliveredAt, data.DeliveredAt)
+	assignIfSupplied(&order.ExpectedDeliveryDate, data.ExpectedDeliveryDate)
+	assignIfSupplied(&order.Address, data.Address)
+	assignIfSupplied(&order.Country, data.Country)
+	assignIfSupplied(&order.City, data.City)
+	assignIfSupplied(&order.PostalCode, data.PostalCode)
+	assignIfSupplied(&order.Notes, data.Notes)
+
+	r.orders[objectId] = order
+
+	if order.Status != current.Status {
+		event := newEvent(ctx, models.OrderStatusChanged, cloneOrder(order))
+		event.PreviousStatus = current.Status
+		r.events = append(r.events, event)
+	}
+
+	return cloneOrder(order), nil
+}
+
+// assignIfSupplied sets field unless the update leaves it alone.
+func assignIfSupplied[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func (r *MemoryOrderRepository) Cancel(ctx context.Context, id string, cancellation models.Cancellation) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.orders[objectId]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if err := models.ValidateCancellation(current.Status); err != nil {
+		return nil, err.(*models.NotCancellableError).Conflict()
+	}
+
+	order := cloneOrder(current)
+	order.Status = models.OrderStatusCancelled
+	order.Cancellation = &cancellation
+	order.UpdatedAt = models.Timestamp()
+	order.Version++
+
+	r.orders[objectId] = order
+
+	event := newEvent(ctx, models.OrderStatusChanged, cloneOrder(order))
+	event.PreviousStatus = current.Status
+	r.events = append(r.events, event)
+
+	return cloneOrder(order), nil
+}
+
+func (r *MemoryOrderRepository) DeleteOne(ctx context.Context, id string) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[objectId]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	delete(r.orders, objectId)
+	r.events = append(r.events, newEvent(ctx, models.OrderDeleted, order))
+
+	return cloneOrder(order), nil
+}
+
+func (r *MemoryOrderRepository) DeleteMany(ctx context.Context, query OrderQuery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, order := range r.orders {
+		if !query.matches(order) {
+			continue
+		}
+		delete(r.orders, id)
+		r.events = append(r.events, newEvent(ctx, models.OrderDeleted, order))
+	}
+
+	return nil
+}
+
+func (r *MemoryOrderRepository) DeleteAllByUser(ctx context.Context, userId string) error {
+	return r.DeleteMany(ctx, OrderQuery{UserID: userId})
+}
+
+func (r *MemoryOrderRepository) DeleteAll(ctx context.Context) error {
+	return r.DeleteMany(ctx, OrderQuery{})
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/metrics"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// observe traces a repository operation on collection and records its latency
+// and failure. A positive timeout bounds the operation, running out of time is
+// reported as ErrTimeout. Operations the caller cancelled are reported as
+// ErrCancelled and not counted as failures.
+func observe[T interface{}](ctx context.Context, timeout time.Duration, collection string, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, collection+"."+operation, trace.WithAttributes(
+		semconv.DBSystemMongoDB,
+		semconv.DBMongoDBCollection(collection),
+		semconv.DBOperation(operation),
+	))
+	defer span.End()
+
+	start := time.Now()
+	result, err := fn(ctx)
+
+	if err != nil && errors.Is(err, context.Canceled) {
+		metrics.ObserveRepositoryOperation(collection, operation, time.Since(start), nil)
+		err = fmt.Errorf("%w: %s: %v", ErrCancelled, operation, err)
+		span.RecordError(err)
+		return result, err
+	}
+
+	metrics.ObserveRepositoryOperation(collection, operation, time.Since(start), err)
+
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)) {
+		err = fmt.Errorf("%w: %s: %v", ErrTimeout, operation, err)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return result, err
+}
+
+func observeErr(ctx context.Context, timeout time.Duration, collection string, operation string, fn func(ctx context.Context) error) error {
+	_, err := observe(ctx, timeout, collection, operation, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// instrumentedOrderRepository measures every call to the wrapped repository.
+type instrumentedOrderRepository struct {
+	next IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, OrderQuery]
+	// timeout is the deadline of every single operation
+	timeout time.Duration
+}
+
+func (r *instrumentedOrderRepository) FindOne(ctx context.Context, id string) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "find_one", func(ctx context.Context) (*models.Order, error) {
+		return r.next.FindOne(ctx, id)
+	})
+}
+
+func (r *instrumentedOrderRepository) FindMany(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	return observe(ctx, r.timeout, "orders", "find_many", func(ctx context.Context) (*Page[*models.Order], error) {
+		return r.next.FindMany(ctx, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) FindAll(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	return observe(ctx, r.timeout, "orders", "find_all", func(ctx context.Context) (*Page[*models.Order], error) {
+		return r.next.FindAll(ctx, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) FindByUser(ctx context.Context, id string, query OrderQuery) (*Page[*models.Order], error) {
+	return observe(ctx, r.timeout, "orders", "find_by_user", func(ctx context.Context) (*Page[*models.Order], error) {
+		return r.next.FindByUser(ctx, id, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) FindByStatus(ctx context.Context, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	return observe(ctx, r.timeout, "orders", "find_by_status", func(ctx context.Context) (*Page[*models.Order], error) {
+		return r.next.FindByStatus(ctx, status, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) FindByUserAndStatus(ctx context.Context, id string, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	return observe(ctx, r.timeout, "orders", "find_by_user_and_status", func(ctx context.Context) (*Page[*models.Order], error) {
+		return r.next.FindByUserAndStatus(ctx, id, status, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) InsertOne(ctx context.Context, order *models.Order) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "insert_one", func(ctx context.Context) (*models.Order, error) {
+		return r.next.InsertOne(ctx, order)
+	})
+}
+
+func (r *instrumentedOrderRepository) UpdateOne(ctx context.Context, id string, data models.UpdateOrderDTO) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "update_one", func(ctx context.Context) (*models.Order, error) {
+		return r.next.UpdateOne(ctx, id, data)
+	})
+}
+
+func (r *instrumentedOrderRepository) CompareAndSwap(ctx context.Context, id string, version int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "compare_and_swap", func(ctx context.Context) (*models.Order, error) {
+		return r.next.CompareAndSwap(ctx, id, version, data)
+	})
+}
+
+func (r *instrumentedOrderRepository) Cancel(ctx context.Context, id string, cancellation models.Cancellation) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "cancel", func(ctx context.Context) (*models.Order, error) {
+		return r.next.Cancel(ctx, id, cancellation)
+	})
+}
+
+func (r *instrumentedOrderRepository) DeleteOne(ctx context.Context, id string) (*models.Order, error) {
+	return observe(ctx, r.timeout, "orders", "delete_one", func(ctx context.Context) (*models.Order, error) {
+		return r.next.DeleteOne(ctx, id)
+	})
+}
+
+func (r *instrumentedOrderRepository) DeleteMany(ctx context.Context, query OrderQuery) error {
+	return observeErr(ctx, r.timeout, "orders", "delete_many", func(ctx context.Context) error {
+		return r.next.DeleteMany(ctx, query)
+	})
+}
+
+func (r *instrumentedOrderRepository) DeleteAllByUser(ctx context.Context, id string) error {
+	return observeErr(ctx, r.timeout, "orders", "delete_all_by_user", func(ctx context.Context) error {
+		return r.next.DeleteAllByUser(ctx, id)
+	})
+}
+
+func (r *instrumentedOrderRepository) DeleteAll(ctx context.Context) error {
+	return observeErr(ctx, r.timeout, "orders", "delete_all", func(ctx context.Context) error {
+		return r.next.DeleteAll(ctx)
+	})
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/mycandys/orders/internal/apperrors"
+	"testing"
+	"time"
+)
+
+func TestObserveTimeout(t *testing.T) {
+	_, err := observe(context.Background(), 10*time.Millisecond, "orders", "find_one", func(ctx context.Context) (struct{}, error) {
+		<-ctx.Done()
+		return struct{}{}, ctx.Err()
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout when the deadline passes, got %v", err)
+	}
+
+	failure := errors.New("connection refused")
+	_, err = observe(context.Background(), time.Second, "orders", "find_one", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, failure
+	})
+	if !errors.Is(err, failure) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected other errors to pass through, got %v", err)
+	}
+}
+
+func TestObserveCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := observe(ctx, time.Second, "orders", "find_one", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, ctx.Err()
+	})
+	if !errors.Is(err, ErrCancelled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrCancelled when the caller gave up, got %v", err)
+	}
+	if kind := apperrors.KindOf(err); kind != apperrors.KindCancelled {
+		t.Errorf("got kind %s want %s", kind, apperrors.KindCancelled)
+	}
+}
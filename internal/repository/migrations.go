@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyMoneyFilter matches orders that still store prices as plain numbers.
+var legacyMoneyFilter = bson.D{{Key: "$or", Value: bson.A{
+	bson.D{{Key: "cost", Value: bson.D{{Key: "$exists", Value: true}}}},
+	bson.D{{Key: "items.price", Value: bson.D{{Key: "$type", Value: "number"}}}},
+}}}
+
+// MigrateLegacyMoney rewrites orders stored with float prices into the Money
+// shape. Decoding already understands the legacy layout, so every matching
+// document is read and replaced as is. Orders written since they were read are
+// skipped, they keep the legacy layout until the next run. It returns the
+// number of migrated orders.
+func MigrateLegacyMoney(db *mongo.Database) (int, error) {
+	coll := db.Collection("orders")
+
+	cursor, err := coll.Find(context.Background(), legacyMoneyFilter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	migrated := 0
+	for cursor.Next(context.Background()) {
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			return migrated, err
+		}
+
+		// every write moves the version, orders stored before versions existed
+		// have none
+		version := bson.E{Key: "version", Value: order.Version}
+		if order.Version == 0 {
+			version.Value = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+		}
+
+		filter := bson.D{{Key: "_id", Value: order.ID}, version}
+		res, err := coll.ReplaceOne(context.Background(), filter, &order)
+		if err != nil {
+			return migrated, err
+		}
+		if res.MatchedCount > 0 {
+			migrated++
+		}
+	}
+
+	return migrated, cursor.Err()
+}
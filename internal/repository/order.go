@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
-	"github.com/mycandys/orders/internal/database"
+	"errors"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/correlation"
+	"github.com/mycandys/orders/internal/metrics"
 	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,21 +16,55 @@ import (
 )
 
 type OrderRepository struct {
-	coll *mongo.Collection
+	coll   *mongo.Collection
+	outbox *OutboxRepository
 }
 
-func NewOrderRepository() IOrderRepository[*models.Order, models.CreateOrderDTO, models.UpdateOrderDTO, bson.D] {
-	return &OrderRepository{
-		coll: database.Db.Collection("orders"),
+// NewOrderRepository stores orders in db, every operation is bounded by timeout.
+func NewOrderRepository(db *mongo.Database, timeout time.Duration) IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, OrderQuery] {
+	return &instrumentedOrderRepository{
+		next: &OrderRepository{
+			coll:   db.Collection("orders"),
+			outbox: NewOutboxRepository(db, timeout),
+		},
+		timeout: timeout,
 	}
 }
 
-func (r *OrderRepository) FindOne(id string) (*models.Order, error) {
+// withTransaction runs fn in a Mongo transaction on the deployment coll belongs
+// to, so order writes and their outbox events are committed together.
+func withTransaction(ctx context.Context, coll *mongo.Collection, fn func(ctx mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := coll.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
+
+// newEvent describes a change to order made by the request ctx belongs to.
+func newEvent(ctx context.Context, eventType models.OrderEventType, order *models.Order) *models.OrderEvent {
+	event := models.NewOrderEvent(eventType, order)
+	event.CorrelationID = correlation.FromContext(ctx)
+	event.TraceContext = make(map[string]string)
+	tracing.Inject(ctx, event.TraceContext)
+	return event
+}
+
+func (r *OrderRepository) FindOne(ctx context.Context, id string) (*models.Order, error) {
 	var order models.Order
 
-	objectId, _ := primitive.ObjectIDFromHex(id)
-	filter := bson.D{{"_id", objectId}}
-	err := r.coll.FindOne(context.Background(), filter).Decode(&order)
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	filter := bson.D{{Key: "_id", Value: objectId}}
+	err = r.coll.FindOne(ctx, filter).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrOrderNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -34,15 +72,28 @@ func (r *OrderRepository) FindOne(id string) (*models.Order, error) {
 	return &order, nil
 }
 
-func (r *OrderRepository) FindMany(filter bson.D) ([]*models.Order, error) {
-	orders := make([]*models.Order, 0)
+func (r *OrderRepository) FindMany(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	filter, err := query.pageFilter()
+	if err != nil {
+		return nil, err
+	}
 
-	cursor, err := r.coll.Find(context.Background(), filter)
+	total, err := r.coll.CountDocuments(ctx, query.filter())
 	if err != nil {
 		return nil, err
 	}
 
-	for cursor.Next(context.Background()) {
+	limit := query.limit()
+	opts := options.Find().SetSort(query.sort()).SetLimit(limit + 1)
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := make([]*models.Order, 0)
+	for cursor.Next(ctx) {
 		var order models.Order
 		if err := cursor.Decode(&order); err != nil {
 			return nil, err
@@ -50,85 +101,338 @@ func (r *OrderRepository) FindMany(filter bson.D) ([]*models.Order, error) {
 		orders = append(orders, &order)
 	}
 
-	return orders, nil
+	page := &Page[*models.Order]{Items: orders, Total: total}
 
+	// one extra document was requested to find out whether another page follows
+	if int64(len(orders)) > limit {
+		page.Items = orders[:limit]
+		page.NextCursor = query.nextCursor(page.Items[limit-1])
+	}
+
+	return page, nil
 }
 
-func (r *OrderRepository) FindAll() ([]*models.Order, error) {
-	return r.FindMany(bson.D{})
+func (r *OrderRepository) FindAll(ctx context.Context, query OrderQuery) (*Page[*models.Order], error) {
+	return r.FindMany(ctx, query)
 }
 
-func (r *OrderRepository) FindByUser(id string) ([]*models.Order, error) {
-	return r.FindMany(bson.D{{"user_id", id}})
+func (r *OrderRepository) FindByUser(ctx context.Context, id string, query OrderQuery) (*Page[*models.Order], error) {
+	query.UserID = id
+	return r.FindMany(ctx, query)
 }
 
-func (r *OrderRepository) FindByStatus(status models.OrderStatus) ([]*models.Order, error) {
-	return r.FindMany(bson.D{{"status", status}})
+func (r *OrderRepository) FindByStatus(ctx context.Context, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	query.Status = status
+	return r.FindMany(ctx, query)
 }
 
-func (r *OrderRepository) FindByUserAndStatus(id string, status models.OrderStatus) ([]*models.Order, error) {
-	return r.FindMany(bson.D{{"user_id", id}, {"status", status}})
+func (r *OrderRepository) FindByUserAndStatus(ctx context.Context, id string, status models.OrderStatus, query OrderQuery) (*Page[*models.Order], error) {
+	query.UserID = id
+	query.Status = status
+	return r.FindMany(ctx, query)
 }
 
-func (r *OrderRepository) InsertOne(data models.CreateOrderDTO) (*models.Order, error) {
-	order := models.NewOrder(data)
-	_, err := r.coll.InsertOne(context.Background(), order)
+func (r *OrderRepository) InsertOne(ctx context.Context, order *models.Order) (*models.Order, error) {
+	order.Version = 1
+
+	_, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		if _, err := r.coll.InsertOne(ctx, order); err != nil {
+			return nil, err
+		}
+		return nil, r.outbox.Append(ctx, newEvent(ctx, models.OrderCreated, order))
+	})
 	if err != nil {
 		return nil, err
 	}
+
+	metrics.OrderCreated()
 	return order, nil
 }
 
-func (r *OrderRepository) UpdateOne(id string, data models.UpdateOrderDTO) (*models.Order, error) {
-	objectId, _ := primitive.ObjectIDFromHex(id)
+func (r *OrderRepository) UpdateOne(ctx context.Context, id string, data models.UpdateOrderDTO) (*models.Order, error) {
+	return r.update(ctx, id, nil, data)
+}
+
+func (r *OrderRepository) CompareAndSwap(ctx context.Context, id string, version int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	return r.update(ctx, id, &version, data)
+}
 
-	filter := bson.D{{"_id", objectId}}
+// versionFilter matches orders at version, orders stored before versions
+// existed have no version field and are at version 0.
+func versionFilter(version int64) bson.E {
+	if version == 0 {
+		return bson.E{Key: "version", Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}}
+	}
+	return bson.E{Key: "version", Value: version}
+}
 
-	update := bson.D{
-		{"$set", bson.D{
-			{"status", data.Status},
-			{"delivered_at", data.DeliveredAt},
-			{"updated_at", time.Now().Format(time.DateTime)},
-		}},
+// intersectStatuses returns the statuses of a that are in b too, in the order of a.
+func intersectStatuses(a []models.OrderStatus, b []models.OrderStatus) []models.OrderStatus {
+	statuses := make([]models.OrderStatus, 0, len(a))
+	for _, status := range a {
+		for _, other := range b {
+			if status == other {
+				statuses = append(statuses, status)
+				break
+			}
+		}
 	}
+	return statuses
+}
 
-	var order models.Order
-	err := r.coll.FindOneAndUpdate(
-		context.Background(), filter, update,
-		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+// setIfSupplied adds key to the $set document unless the update leaves it alone.
+func setIfSupplied[T any](set bson.D, key string, value *T) bson.D {
+	if value == nil {
+		return set
+	}
+	return append(set, bson.E{Key: key, Value: *value})
+}
+
+// update applies data to the order, and when version is given only while the
+// order is still at that version.
+func (r *OrderRepository) update(ctx context.Context, id string, version *int64, data models.UpdateOrderDTO) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	var previous models.OrderStatus
+	result, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		var current models.Order
+		err := r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: objectId}}).Decode(&current)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		previous = current.Status
+
+		filter := bson.D{{Key: "_id", Value: objectId}}
+		if version != nil {
+			if current.Version != *version {
+				return nil, ErrVersionMismatch
+			}
+			filter = append(filter, versionFilter(*version))
+		}
+
+		// only match orders whose current status may legally move to the requested one,
+		// so concurrent updates cannot sneak an illegal transition past the handler check
+		var statuses []models.OrderStatus
+		if data.Status != nil {
+			if err := models.ValidateStatusTransition(current.Status, *data.Status); err != nil {
+				return nil, err.(*models.StatusTransitionError).Conflict()
+			}
+			statuses = models.PreviousStatuses(*data.Status)
+		}
+		// the address rule is checked against the status before the update,
+		// the transition from there was validated above
+		if data.ChangesAddress() {
+			if err := models.ValidateAddressChange(current.Status); err != nil {
+				return nil, err.(*models.AddressNotEditableError).Conflict()
+			}
+			// both rules must still hold when the write happens
+			if statuses == nil {
+				statuses = models.AddressEditableStatuses()
+			} else {
+				statuses = intersectStatuses(statuses, models.AddressEditableStatuses())
+			}
+		}
+		if statuses != nil {
+			filter = append(filter, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: statuses}}})
+		}
+
+		// fields missing from the update keep their value
+		set := bson.D{{Key: "updated_at", Value: models.Timestamp()}}
+		set = setIfSupplied(set, "status", data.Status)
+		set = setIfSupplied(set, "delivered_at", data.DeliveredAt)
+		set = setIfSupplied(set, "expected_delivery_date", data.ExpectedDeliveryDate)
+		set = setIfSupplied(set, "address", data.Address)
+		set = setIfSupplied(set, "country", data.Country)
+		set = setIfSupplied(set, "city", data.City)
+		set = setIfSupplied(set, "postal_code", data.PostalCode)
+		set = setIfSupplied(set, "notes", data.Notes)
+		update := bson.D{
+			{Key: "$set", Value: set},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		}
+
+		var order models.Order
+		err = r.coll.FindOneAndUpdate(
+			ctx, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+		if errors.Is(err, mongo.ErrNoDocuments) && version != nil {
+			return nil, ErrVersionMismatch
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, apperrors.Conflict("Order status was changed concurrently", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if order.Status != current.Status {
+			event := newEvent(ctx, models.OrderStatusChanged, &order)
+			event.PreviousStatus = current.Status
+			if err := r.outbox.Append(ctx, event); err != nil {
+				return nil, err
+			}
+		}
+
+		return &order, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &order, nil
+	order := result.(*models.Order)
+	if order.Status != previous {
+		metrics.OrderStatusChanged(string(order.Status))
+	}
+
+	return order, nil
 }
 
-func (r *OrderRepository) DeleteOne(id string) (*models.Order, error) {
-	objectId, _ := primitive.ObjectIDFromHex(id)
+// Cancel moves a pending or paid order to cancelled and records why.
+func (r *OrderRepository) Cancel(ctx context.Context, id string, cancellation models.Cancellation) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
 
-	filter := bson.D{{"_id", objectId}}
+	result, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		var current models.Order
+		err := r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: objectId}}).Decode(&current)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := models.ValidateCancellation(current.Status); err != nil {
+			return nil, err.(*models.NotCancellableError).Conflict()
+		}
 
-	var order models.Order
-	err := r.coll.FindOneAndDelete(context.Background(), filter).Decode(&order)
+		filter := bson.D{
+			{Key: "_id", Value: objectId},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: models.CancellableStatuses()}}},
+		}
+		update := bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: models.OrderStatusCancelled},
+				{Key: "cancellation", Value: cancellation},
+				{Key: "updated_at", Value: models.Timestamp()},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		}
+
+		var order models.Order
+		err = r.coll.FindOneAndUpdate(
+			ctx, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, apperrors.Conflict("Order status was changed concurrently", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		event := newEvent(ctx, models.OrderStatusChanged, &order)
+		event.PreviousStatus = current.Status
+		return &order, r.outbox.Append(ctx, event)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &order, nil
+	metrics.OrderStatusChanged(string(models.OrderStatusCancelled))
+
+	return result.(*models.Order), nil
+}
+
+func (r *OrderRepository) DeleteOne(ctx context.Context, id string) (*models.Order, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	filter := bson.D{{Key: "_id", Value: objectId}}
+
+	result, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		var order models.Order
+		err := r.coll.FindOneAndDelete(ctx, filter).Decode(&order)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &order, r.outbox.Append(ctx, newEvent(ctx, models.OrderDeleted, &order))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.Order), nil
 }
 
-func (r *OrderRepository) DeleteMany(filter bson.D) error {
-	_, err := r.coll.DeleteMany(context.Background(), filter)
+// deleteBatchSize is how many orders DeleteMany loads and deletes per transaction.
+const deleteBatchSize = 500
+
+// DeleteMany deletes the matching orders in batches, each batch is deleted
+// together with its events in its own transaction.
+func (r *OrderRepository) DeleteMany(ctx context.Context, query OrderQuery) error {
+	for {
+		deleted, err := r.deleteBatch(ctx, query)
+		if err != nil {
+			return err
+		}
+		if deleted < deleteBatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *OrderRepository) deleteBatch(ctx context.Context, query OrderQuery) (int, error) {
+	result, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		cursor, err := r.coll.Find(ctx, query.filter(), options.Find().SetLimit(deleteBatchSize))
+		if err != nil {
+			return nil, err
+		}
+
+		var orders []*models.Order
+		if err := cursor.All(ctx, &orders); err != nil {
+			return nil, err
+		}
+
+		if len(orders) == 0 {
+			return 0, nil
+		}
+
+		ids := make(bson.A, 0, len(orders))
+		events := make([]*models.OrderEvent, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+			events = append(events, newEvent(ctx, models.OrderDeleted, order))
+		}
+
+		_, err = r.coll.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+		if err != nil {
+			return nil, err
+		}
+
+		return len(orders), r.outbox.Append(ctx, events...)
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return result.(int), nil
 }
 
-func (r *OrderRepository) DeleteAllByUser(userId string) error {
-	return r.DeleteMany(bson.D{{"user_id", userId}})
+func (r *OrderRepository) DeleteAllByUser(ctx context.Context, userId string) error {
+	return r.DeleteMany(ctx, OrderQuery{UserID: userId})
 }
 
-func (r *OrderRepository) DeleteAll() error {
-	return r.DeleteMany(bson.D{})
+func (r *OrderRepository) DeleteAll(ctx context.Context) error {
+	return r.DeleteMany(ctx, OrderQuery{})
 }
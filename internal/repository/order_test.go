@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/mycandys/orders/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestIntersectStatuses(t *testing.T) {
+	// shipping and changing the address at once is only allowed from pending
+	got := intersectStatuses(models.PreviousStatuses(models.OrderStatusShipped), models.AddressEditableStatuses())
+	if want := []models.OrderStatus{models.OrderStatusPending}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	got = intersectStatuses(models.PreviousStatuses(models.OrderStatusDelivered), models.AddressEditableStatuses())
+	if len(got) != 0 {
+		t.Errorf("got %v want no status", got)
+	}
+}
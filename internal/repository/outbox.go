@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// OutboxMessage is an order event waiting to be delivered to every sink.
+type OutboxMessage struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Event *models.OrderEvent `bson:"event"`
+	// Delivered lists the sinks that already received the event, so retries only
+	// repeat the failed deliveries.
+	Delivered []string `bson:"delivered"`
+	Attempts  int      `bson:"attempts"`
+	// NextAttemptAt is both the retry schedule and the lease of the relay
+	// currently delivering the message.
+	NextAttemptAt time.Time  `bson:"next_attempt_at"`
+	LastError     string     `bson:"last_error,omitempty"`
+	PublishedAt   *time.Time `bson:"published_at,omitempty"`
+	DeadAt        *time.Time `bson:"dead_at,omitempty"`
+	CreatedAt     time.Time  `bson:"created_at"`
+}
+
+func (m *OutboxMessage) IsDelivered(sink string) bool {
+	for _, delivered := range m.Delivered {
+		if delivered == sink {
+			return true
+		}
+	}
+	return false
+}
+
+type OutboxRepository struct {
+	coll *mongo.Collection
+	// timeout is the deadline of every operation of the relay
+	timeout time.Duration
+}
+
+// NewOutboxRepository stores messages in db, every operation of the relay is
+// bounded by timeout. Appends run in the transaction of their caller and share
+// its deadline.
+func NewOutboxRepository(db *mongo.Database, timeout time.Duration) *OutboxRepository {
+	return &OutboxRepository{
+		coll:    db.Collection("outbox"),
+		timeout: timeout,
+	}
+}
+
+func (r *OutboxRepository) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "published_at", Value: 1},
+			{Key: "dead_at", Value: 1},
+			{Key: "next_attempt_at", Value: 1},
+		},
+	})
+	return err
+}
+
+// Append stores events for later delivery. Pass the session context of the
+// transaction writing the orders so both commit or roll back together.
+func (r *OutboxRepository) Append(ctx context.Context, events ...*models.OrderEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		documents = append(documents, &OutboxMessage{
+			ID:            event.ID,
+			Event:         event,
+			Delivered:     make([]string, 0),
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	_, err := r.coll.InsertMany(ctx, documents)
+	return err
+}
+
+// Claim leases the oldest due message for the given duration so concurrent
+// relays do not deliver it at the same time. It returns nil when nothing is due.
+func (r *OutboxRepository) Claim(ctx context.Context, lease time.Duration) (*OutboxMessage, error) {
+	return observe(ctx, r.timeout, "outbox", "claim", func(ctx context.Context) (*OutboxMessage, error) {
+		return r.claim(ctx, lease)
+	})
+}
+
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, id primitive.ObjectID, sink string) error {
+	return observeErr(ctx, r.timeout, "outbox", "mark_delivered", func(ctx context.Context) error {
+		return r.update(ctx, id, bson.D{
+			{Key: "$addToSet", Value: bson.D{{Key: "delivered", Value: sink}}},
+		})
+	})
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID) error {
+	return observeErr(ctx, r.timeout, "outbox", "mark_published", func(ctx context.Context) error {
+		return r.update(ctx, id, bson.D{
+			{Key: "$set", Value: bson.D{{Key: "published_at", Value: time.Now()}}},
+		})
+	})
+}
+
+func (r *OutboxRepository) ScheduleRetry(ctx context.Context, id primitive.ObjectID, at time.Time, lastError string) error {
+	return observeErr(ctx, r.timeout, "outbox", "schedule_retry", func(ctx context.Context) error {
+		return r.update(ctx, id, bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "next_attempt_at", Value: at},
+				{Key: "last_error", Value: lastError},
+			}},
+		})
+	})
+}
+
+// MarkDead parks a message that kept failing so it no longer blocks the relay.
+func (r *OutboxRepository) MarkDead(ctx context.Context, id primitive.ObjectID, lastError string) error {
+	return observeErr(ctx, r.timeout, "outbox", "mark_dead", func(ctx context.Context) error {
+		return r.update(ctx, id, bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "dead_at", Value: time.Now()},
+				{Key: "last_error", Value: lastError},
+			}},
+		})
+	})
+}
+
+func (r *OutboxRepository) claim(ctx context.Context, lease time.Duration) (*OutboxMessage, error) {
+	now := time.Now()
+
+	filter := bson.D{
+		{Key: "published_at", Value: nil},
+		{Key: "dead_at", Value: nil},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "next_attempt_at", Value: now.Add(lease)}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message OutboxMessage
+	err := r.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+func (r *OutboxRepository) update(ctx context.Context, id primitive.ObjectID, update bson.D) error {
+	_, err := r.coll.UpdateByID(ctx, id, update)
+	return err
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// processedMessageRetention is how long message ids are remembered for deduplication.
+const processedMessageRetention = 7 * 24 * time.Hour
+
+// processedMessageLease is how long a claim blocks redeliveries before it is
+// considered abandoned by a crashed consumer and may be taken over.
+const processedMessageLease = time.Minute
+
+// ErrMessageInProgress is returned by Claim while another consumer holds the
+// claim of a message, the message should be retried later.
+var ErrMessageInProgress = errors.New("message is being handled by another consumer")
+
+// processedMessage is the claim of a message id, records written before claims
+// existed have no claimed_at and count as completed. ProcessedAt expires it.
+type processedMessage struct {
+	ID          string    `bson:"_id"`
+	ClaimedAt   time.Time `bson:"claimed_at,omitempty"`
+	Completed   bool      `bson:"completed"`
+	ProcessedAt time.Time `bson:"processed_at"`
+}
+
+// ProcessedMessageRepository remembers the ids of consumed broker messages so
+// redeliveries are not applied twice.
+type ProcessedMessageRepository struct {
+	coll *mongo.Collection
+}
+
+func NewProcessedMessageRepository(db *mongo.Database) *ProcessedMessageRepository {
+	return &ProcessedMessageRepository{
+		coll: db.Collection("processed_messages"),
+	}
+}
+
+func (r *ProcessedMessageRepository) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "processed_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(processedMessageRetention.Seconds())),
+	})
+	return err
+}
+
+// Claim leases id to the caller. It reports false when the message was already
+// handled and returns ErrMessageInProgress while somebody else's lease runs.
+// Leases of consumers that died before completing expire after
+// processedMessageLease, so the message is handled again.
+func (r *ProcessedMessageRepository) Claim(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	claim := processedMessage{ID: id, ClaimedAt: now, ProcessedAt: now}
+
+	// the unique _id makes sure only one of several concurrent redeliveries wins
+	_, err := r.coll.InsertOne(ctx, claim)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	abandoned := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "completed", Value: false},
+		{Key: "claimed_at", Value: bson.D{{Key: "$lt", Value: now.Add(-processedMessageLease)}}},
+	}
+	err = r.coll.FindOneAndReplace(ctx, abandoned, claim).Err()
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, err
+	}
+
+	var existing processedMessage
+	err = r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// released in the meantime
+		return false, ErrMessageInProgress
+	}
+	if err != nil {
+		return false, err
+	}
+	if !existing.Completed && !existing.ClaimedAt.IsZero() {
+		return false, ErrMessageInProgress
+	}
+	return false, nil
+}
+
+// Complete marks the claimed id as handled, redeliveries are skipped from now on.
+func (r *ProcessedMessageRepository) Complete(ctx context.Context, id string) error {
+	_, err := r.coll.UpdateByID(ctx, id, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "completed", Value: true},
+		{Key: "processed_at", Value: time.Now()},
+	}}})
+	return err
+}
+
+// Release removes the claim of id so the message is handled again when it is
+// redelivered.
+func (r *ProcessedMessageRepository) Release(ctx context.Context, id string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "completed", Value: false}})
+	return err
+}
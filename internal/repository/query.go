@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	DefaultLimit int64 = 20
+	MaxLimit     int64 = 100
+)
+
+var ErrInvalidCursor = apperrors.Validation("invalid cursor")
+
+// CursorMismatchReason tells clients a cursor was followed with another sort
+// than the one it was issued for.
+const CursorMismatchReason = "cursor_sort_mismatch"
+
+// ErrTimeout is returned when a repository operation ran out of time.
+var ErrTimeout = apperrors.Timeout("Database did not respond in time", nil)
+
+// ErrCancelled is returned when the caller gave up on a repository operation.
+var ErrCancelled = apperrors.Cancelled("The request was cancelled", nil)
+
+// ErrOrderNotFound is returned when no order has the requested id.
+var ErrOrderNotFound = apperrors.NotFound("Order not found")
+
+// ErrVersionMismatch is returned by compare-and-swap updates of orders that
+// were written since the caller read them.
+var ErrVersionMismatch = apperrors.PreconditionFailed("Order was changed since it was read")
+
+type SortField string
+
+const (
+	SortByCreatedAt SortField = "created_at"
+	SortByCost      SortField = "cost"
+	SortByStatus    SortField = "status"
+)
+
+func IsSortFieldValid(field string) bool {
+	switch SortField(field) {
+	case SortByCreatedAt, SortByCost, SortByStatus:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrderQuery selects, sorts and pages orders. Zero values mean "no constraint".
+type OrderQuery struct {
+	UserID string
+	Status models.OrderStatus
+	// CreatedFrom is inclusive, CreatedTo is exclusive. Both are compared in
+	// UTC like the stored creation times.
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// MinCost and MaxCost bound the order total in minor units, both inclusive.
+	MinCost    *int64
+	MaxCost    *int64
+	SortBy     SortField
+	Descending bool
+	Limit      int64
+	// Cursor is the opaque NextCursor of the previous page.
+	Cursor string
+}
+
+// Page is one slice of a listing together with the cursor of the following slice.
+type Page[T interface{}] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Total      int64  `json:"total"`
+}
+
+// cursor is the position after the last order of a page, together with the
+// order it was issued for so it cannot be followed in another one.
+type cursor struct {
+	Value      json.RawMessage `json:"v"`
+	ID         string          `json:"id"`
+	SortBy     SortField       `json:"s"`
+	Descending bool            `json:"d"`
+}
+
+// direction names the sort direction the way the order query parameter does.
+func direction(descending bool) string {
+	if descending {
+		return "desc"
+	}
+	return "asc"
+}
+
+func (q OrderQuery) sortField() SortField {
+	if q.SortBy == "" {
+		return SortByCreatedAt
+	}
+	return q.SortBy
+}
+
+func (q OrderQuery) limit() int64 {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// sortKey is the document field a sort field orders by.
+func (f SortField) sortKey() string {
+	if f == SortByCost {
+		return "price.total.amount"
+	}
+	return string(f)
+}
+
+func (f SortField) value(order *models.Order) interface{} {
+	switch f {
+	case SortByCost:
+		return order.Price.Total.Amount
+	case SortByStatus:
+		return string(order.Status)
+	default:
+		return order.CreatedAt
+	}
+}
+
+// filter builds the selection filter without the cursor constraint.
+func (q OrderQuery) filter() bson.D {
+	filter := bson.D{}
+
+	if q.UserID != "" {
+		filter = append(filter, bson.E{Key: "user_id", Value: q.UserID})
+	}
+
+	if q.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: q.Status})
+	}
+
+	created := bson.D{}
+	if q.CreatedFrom != nil {
+		created = append(created, bson.E{Key: "$gte", Value: q.CreatedFrom.UTC().Format(time.DateTime)})
+	}
+	if q.CreatedTo != nil {
+		created = append(created, bson.E{Key: "$lt", Value: q.CreatedTo.UTC().Format(time.DateTime)})
+	}
+	if len(created) > 0 {
+		filter = append(filter, bson.E{Key: "created_at", Value: created})
+	}
+
+	cost := bson.D{}
+	if q.MinCost != nil {
+		cost = append(cost, bson.E{Key: "$gte", Value: *q.MinCost})
+	}
+	if q.MaxCost != nil {
+		cost = append(cost, bson.E{Key: "$lte", Value: *q.MaxCost})
+	}
+	if len(cost) > 0 {
+		filter = append(filter, bson.E{Key: "price.total.amount", Value: cost})
+	}
+
+	return filter
+}
+
+// matches reports whether filter selects order, for repositories that do not
+// run Mongo filters.
+func (q OrderQuery) matches(order *models.Order) bool {
+	if q.UserID != "" && order.UserID != q.UserID {
+		return false
+	}
+	if q.Status != "" && order.Status != q.Status {
+		return false
+	}
+	if q.CreatedFrom != nil && order.CreatedAt < q.CreatedFrom.UTC().Format(time.DateTime) {
+		return false
+	}
+	if q.CreatedTo != nil && order.CreatedAt >= q.CreatedTo.UTC().Format(time.DateTime) {
+		return false
+	}
+	if q.MinCost != nil && order.Price.Total.Amount < *q.MinCost {
+		return false
+	}
+	if q.MaxCost != nil && order.Price.Total.Amount > *q.MaxCost {
+		return false
+	}
+	return true
+}
+
+// after decodes the cursor into the sort value and id of the last order of the
+// previous page.
+func (q OrderQuery) after() (interface{}, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	if c.SortBy != q.sortField() || c.Descending != q.Descending {
+		return nil, primitive.NilObjectID, apperrors.Validation(fmt.Sprintf(
+			"cursor was issued for sort %s %s, not %s %s",
+			c.SortBy, direction(c.Descending), q.sortField(), direction(q.Descending),
+		)).With("reason", CursorMismatchReason)
+	}
+
+	var value interface{}
+	if q.sortField() == SortByCost {
+		var amount int64
+		err = json.Unmarshal(c.Value, &amount)
+		value = amount
+	} else {
+		var text string
+		err = json.Unmarshal(c.Value, &text)
+		value = text
+	}
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return value, id, nil
+}
+
+// pageFilter extends the selection filter so it only matches orders after the cursor.
+func (q OrderQuery) pageFilter() (bson.D, error) {
+	filter := q.filter()
+	if q.Cursor == "" {
+		return filter, nil
+	}
+
+	value, id, err := q.after()
+	if err != nil {
+		return nil, err
+	}
+
+	op := "$gt"
+	if q.Descending {
+		op = "$lt"
+	}
+
+	key := q.sortField().sortKey()
+	return append(filter, bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: key, Value: bson.D{{Key: op, Value: value}}}},
+		bson.D{{Key: key, Value: value}, {Key: "_id", Value: bson.D{{Key: op, Value: id}}}},
+	}}), nil
+}
+
+func (q OrderQuery) sort() bson.D {
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+	return bson.D{
+		{Key: q.sortField().sortKey(), Value: direction},
+		{Key: "_id", Value: direction},
+	}
+}
+
+func (q OrderQuery) nextCursor(last *models.Order) string {
+	value, _ := json.Marshal(q.sortField().value(last))
+	raw, _ := json.Marshal(cursor{Value: value, ID: last.ID.Hex(), SortBy: q.sortField(), Descending: q.Descending})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -1,22 +1,29 @@
 package repository
 
-import "github.com/mycandys/orders/internal/models"
+import (
+	"context"
+	"github.com/mycandys/orders/internal/models"
+)
 
-type Repository[TModel interface{}, TCreateModel interface{}, TUpdateModel interface{}, TFilter interface{}] interface {
-	FindOne(id string) (TModel, error)
-	FindMany(filter TFilter) ([]TModel, error)
-	InsertOne(data TCreateModel) (TModel, error)
-	UpdateOne(id string, data TUpdateModel) (TModel, error)
-	DeleteOne(id string) (TModel, error)
-	DeleteMany(filter TFilter) error
+type Repository[TModel interface{}, TCreateModel interface{}, TUpdateModel interface{}, TQuery interface{}] interface {
+	FindOne(ctx context.Context, id string) (TModel, error)
+	FindMany(ctx context.Context, query TQuery) (*Page[TModel], error)
+	InsertOne(ctx context.Context, data TCreateModel) (TModel, error)
+	UpdateOne(ctx context.Context, id string, data TUpdateModel) (TModel, error)
+	DeleteOne(ctx context.Context, id string) (TModel, error)
+	DeleteMany(ctx context.Context, query TQuery) error
 }
 
-type IOrderRepository[TModel interface{}, TCreateModel interface{}, TUpdateModel interface{}, TFilter interface{}] interface {
-	Repository[TModel, TCreateModel, TUpdateModel, TFilter]
-	FindAll() ([]TModel, error)
-	FindByUser(id string) ([]TModel, error)
-	FindByStatus(status models.OrderStatus) ([]TModel, error)
-	DeleteAllByUser(id string) error
-	DeleteAll() error
-	FindByUserAndStatus(id string, status models.OrderStatus) ([]TModel, error)
+type IOrderRepository[TModel interface{}, TCreateModel interface{}, TUpdateModel interface{}, TQuery interface{}] interface {
+	Repository[TModel, TCreateModel, TUpdateModel, TQuery]
+	FindAll(ctx context.Context, query TQuery) (*Page[TModel], error)
+	FindByUser(ctx context.Context, id string, query TQuery) (*Page[TModel], error)
+	FindByStatus(ctx context.Context, status models.OrderStatus, query TQuery) (*Page[TModel], error)
+	DeleteAllByUser(ctx context.Context, id string) error
+	DeleteAll(ctx context.Context) error
+	FindByUserAndStatus(ctx context.Context, id string, status models.OrderStatus, query TQuery) (*Page[TModel], error)
+	Cancel(ctx context.Context, id string, cancellation models.Cancellation) (TModel, error)
+	// CompareAndSwap updates the order like UpdateOne, but only while it is
+	// still at version. Otherwise it fails with ErrVersionMismatch.
+	CompareAndSwap(ctx context.Context, id string, version int64, data TUpdateModel) (TModel, error)
 }
@@ -0,0 +1,421 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/metrics"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ErrReturnNotFound is returned when no return has the requested id.
+var ErrReturnNotFound = apperrors.NotFound("Return not found")
+
+// ReturnQuery selects and pages returns, newest first. Zero values mean "no constraint".
+type ReturnQuery struct {
+	UserID string
+	Status models.ReturnStatus
+	Limit  int64
+	// Cursor is the opaque NextCursor of the previous page.
+	Cursor string
+}
+
+func (q ReturnQuery) limit() int64 {
+	return OrderQuery{Limit: q.Limit}.limit()
+}
+
+func (q ReturnQuery) filter() bson.D {
+	filter := bson.D{}
+	if q.UserID != "" {
+		filter = append(filter, bson.E{Key: "user_id", Value: q.UserID})
+	}
+	if q.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: q.Status})
+	}
+	return filter
+}
+
+func (q ReturnQuery) pageFilter() (bson.D, error) {
+	filter := q.filter()
+	if q.Cursor == "" {
+		return filter, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	var createdAt string
+	if err := json.Unmarshal(raw, &c); err != nil || json.Unmarshal(c.Value, &createdAt) != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return append(filter, bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "created_at", Value: bson.D{{Key: "$lt", Value: createdAt}}}},
+		bson.D{{Key: "created_at", Value: createdAt}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}}},
+	}}), nil
+}
+
+func (q ReturnQuery) nextCursor(last *models.Return) string {
+	value, _ := json.Marshal(last.CreatedAt)
+	raw, _ := json.Marshal(cursor{Value: value, ID: last.ID.Hex()})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+type IReturnRepository interface {
+	FindOne(ctx context.Context, id string) (*models.Return, error)
+	FindMany(ctx context.Context, query ReturnQuery) (*Page[*models.Return], error)
+	// FindByOrder returns every return of an order regardless of its status.
+	FindByOrder(ctx context.Context, orderId primitive.ObjectID) ([]*models.Return, error)
+	InsertOne(ctx context.Context, r *models.Return) (*models.Return, error)
+	// Approve records the refund of a requested return and moves its order to
+	// refunded.
+	Approve(ctx context.Context, id string, reviewer string, note string) (*models.Return, error)
+	Reject(ctx context.Context, id string, reviewer string, note string) (*models.Return, error)
+}
+
+// ReturnRepository stores returns next to the orders they belong to. Every
+// operation is traced and measured like the order repository's.
+type ReturnRepository struct {
+	coll   *mongo.Collection
+	orders *mongo.Collection
+	outbox *OutboxRepository
+	// timeout is the deadline of every single operation
+	timeout time.Duration
+}
+
+func NewReturnRepository(db *mongo.Database, timeout time.Duration) *ReturnRepository {
+	return &ReturnRepository{
+		coll:    db.Collection("returns"),
+		orders:  db.Collection("orders"),
+		outbox:  NewOutboxRepository(db, timeout),
+		timeout: timeout,
+	}
+}
+
+func (r *ReturnRepository) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+func (r *ReturnRepository) FindOne(ctx context.Context, id string) (*models.Return, error) {
+	return observe(ctx, r.timeout, "returns", "find_one", func(ctx context.Context) (*models.Return, error) {
+		return r.findOne(ctx, id)
+	})
+}
+
+func (r *ReturnRepository) FindMany(ctx context.Context, query ReturnQuery) (*Page[*models.Return], error) {
+	return observe(ctx, r.timeout, "returns", "find_many", func(ctx context.Context) (*Page[*models.Return], error) {
+		return r.findMany(ctx, query)
+	})
+}
+
+func (r *ReturnRepository) FindByOrder(ctx context.Context, orderId primitive.ObjectID) ([]*models.Return, error) {
+	return observe(ctx, r.timeout, "returns", "find_by_order", func(ctx context.Context) ([]*models.Return, error) {
+		return r.findByOrder(ctx, orderId)
+	})
+}
+
+func (r *ReturnRepository) InsertOne(ctx context.Context, ret *models.Return) (*models.Return, error) {
+	return observe(ctx, r.timeout, "returns", "insert_one", func(ctx context.Context) (*models.Return, error) {
+		return r.insertOne(ctx, ret)
+	})
+}
+
+func (r *ReturnRepository) Approve(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	return observe(ctx, r.timeout, "returns", "approve", func(ctx context.Context) (*models.Return, error) {
+		return r.approve(ctx, id, reviewer, note)
+	})
+}
+
+func (r *ReturnRepository) Reject(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	return observe(ctx, r.timeout, "returns", "reject", func(ctx context.Context) (*models.Return, error) {
+		return r.reject(ctx, id, reviewer, note)
+	})
+}
+
+func (r *ReturnRepository) findOne(ctx context.Context, id string) (*models.Return, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	var ret models.Return
+	err = r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: objectId}}).Decode(&ret)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (r *ReturnRepository) findMany(ctx context.Context, query ReturnQuery) (*Page[*models.Return], error) {
+	filter, err := query.pageFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := r.coll.CountDocuments(ctx, query.filter())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.limit()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit + 1)
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	returns := make([]*models.Return, 0)
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, err
+	}
+
+	page := &Page[*models.Return]{Items: returns, Total: total}
+
+	// one extra document was requested to find out whether another page follows
+	if int64(len(returns)) > limit {
+		page.Items = returns[:limit]
+		page.NextCursor = query.nextCursor(page.Items[limit-1])
+	}
+
+	return page, nil
+}
+
+func (r *ReturnRepository) findByOrder(ctx context.Context, orderId primitive.ObjectID) ([]*models.Return, error) {
+	cursor, err := r.coll.Find(ctx, bson.D{{Key: "order_id", Value: orderId}})
+	if err != nil {
+		return nil, err
+	}
+
+	returns := make([]*models.Return, 0)
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+func (r *ReturnRepository) insertOne(ctx context.Context, ret *models.Return) (*models.Return, error) {
+	if _, err := r.coll.InsertOne(ctx, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (r *ReturnRepository) approve(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	var changes []models.OrderStatus
+	result, err := withTransaction(ctx, r.coll, func(ctx mongo.SessionContext) (interface{}, error) {
+		ret, err := r.requested(ctx, objectId)
+		if err != nil {
+			return nil, err
+		}
+
+		var order models.Order
+		err = r.orders.FindOne(ctx, bson.D{{Key: "_id", Value: ret.OrderID}}).Decode(&order)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the quantities were checked when the return was opened, but other
+		// returns of the order may have been approved since
+		approved, err := r.approved(ctx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := models.ValidateReturnItems(&order, ret.Items, approved); err != nil {
+			return nil, err
+		}
+
+		amount, err := ret.RefundAmount()
+		if err != nil {
+			return nil, err
+		}
+
+		now := models.Timestamp()
+		ret.Status = models.ReturnStatusApproved
+		ret.ReviewedBy = reviewer
+		ret.ReviewNote = note
+		ret.Refund = &models.Refund{Amount: amount, CreatedAt: now}
+		ret.UpdatedAt = now
+
+		_, err = r.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: ret.ID}}, ret)
+		if err != nil {
+			return nil, err
+		}
+
+		changes, err = r.refundOrder(ctx, &order, models.FullyReturned(&order, append(approved, ret)), now)
+		if err != nil {
+			return nil, err
+		}
+
+		return ret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range changes {
+		metrics.OrderStatusChanged(string(status))
+	}
+
+	return result.(*models.Return), nil
+}
+
+// refundOrder moves order to returned and, once every item came back, on to
+// refunded. It writes an event for every status it passes, each status change
+// is a version of its own. The order is written even if its status does not
+// change, so concurrent approvals for the same order conflict.
+func (r *ReturnRepository) refundOrder(ctx mongo.SessionContext, order *models.Order, full bool, now string) ([]models.OrderStatus, error) {
+	previous := order.Status
+	changes := make([]models.OrderStatus, 0, 2)
+
+	steps := []models.OrderStatus{models.OrderStatusReturned}
+	if full {
+		steps = append(steps, models.OrderStatusRefunded)
+	}
+
+	status := previous
+	version := order.Version
+	for _, next := range steps {
+		if status == next || !models.CanTransition(status, next) {
+			continue
+		}
+
+		version++
+		snapshot := *order
+		snapshot.Status = next
+		snapshot.UpdatedAt = now
+		snapshot.Version = version
+
+		event := newEvent(ctx, models.OrderStatusChanged, &snapshot)
+		event.PreviousStatus = status
+		if err := r.outbox.Append(ctx, event); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, next)
+		status = next
+	}
+
+	// every write moves the version, even one that keeps the status
+	if version == order.Version {
+		version++
+	}
+
+	filter := bson.D{{Key: "_id", Value: order.ID}, {Key: "status", Value: previous}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: version - order.Version}}},
+	}
+
+	res, err := r.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, apperrors.Conflict("Order status was changed concurrently", nil)
+	}
+
+	return changes, nil
+}
+
+func (r *ReturnRepository) reject(ctx context.Context, id string, reviewer string, note string) (*models.Return, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidID(id)
+	}
+
+	filter := bson.D{{Key: "_id", Value: objectId}, {Key: "status", Value: models.ReturnStatusRequested}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.ReturnStatusRejected},
+		{Key: "reviewed_by", Value: reviewer},
+		{Key: "review_note", Value: note},
+		{Key: "updated_at", Value: models.Timestamp()},
+	}}}
+
+	var ret models.Return
+	err = r.coll.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&ret)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// tell a missing return apart from one that was already reviewed
+		_, err := r.requested(ctx, objectId)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// requested loads a return that still waits for review.
+func (r *ReturnRepository) requested(ctx context.Context, id primitive.ObjectID) (*models.Return, error) {
+	var ret models.Return
+	err := r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&ret)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Status != models.ReturnStatusRequested {
+		return nil, apperrors.Conflict("Return was already "+string(ret.Status), nil).
+			With("reason", models.ReturnAlreadyReviewedReason).
+			With("returnStatus", ret.Status)
+	}
+
+	return &ret, nil
+}
+
+func (r *ReturnRepository) approved(ctx context.Context, orderId primitive.ObjectID) ([]*models.Return, error) {
+	cursor, err := r.coll.Find(ctx, bson.D{
+		{Key: "order_id", Value: orderId},
+		{Key: "status", Value: models.ReturnStatusApproved},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	returns := make([]*models.Return, 0)
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
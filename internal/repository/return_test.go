@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"github.com/mycandys/orders/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestMongoReturnRepositoryRefundsOnceEveryItemIsReturned(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+	returns := NewReturnRepository(db, time.Second)
+
+	order := contractOrder("1", models.OrderStatusDelivered, 500, "2024-01-01 10:00:00")
+	order.Items[0].Quantity = 2
+	if _, err := db.Collection("orders").InsertOne(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	approve := func(quantity int) models.OrderStatus {
+		t.Helper()
+		ret := &models.Return{
+			ID:      primitive.NewObjectID(),
+			OrderID: order.ID,
+			UserID:  order.UserID,
+			Items:   []models.ReturnItem{{ItemID: "1", Price: order.Items[0].Price, Quantity: quantity}},
+			Status:  models.ReturnStatusRequested,
+		}
+		if _, err := returns.InsertOne(ctx, ret); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := returns.Approve(ctx, ret.ID.Hex(), "staff", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		var stored models.Order
+		if err := db.Collection("orders").FindOne(ctx, bson.D{{Key: "_id", Value: order.ID}}).Decode(&stored); err != nil {
+			t.Fatal(err)
+		}
+		return stored.Status
+	}
+
+	if status := approve(1); status != models.OrderStatusReturned {
+		t.Errorf("a partial return moved the order to %s", status)
+	}
+	if status := approve(1); status != models.OrderStatusRefunded {
+		t.Errorf("returning the rest moved the order to %s", status)
+	}
+}
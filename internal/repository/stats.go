@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CountOrdersByStatus returns the number of orders in db in every status that
+// has any.
+func CountOrdersByStatus(ctx context.Context, db *mongo.Database) (map[string]int64, error) {
+	return observe(ctx, 0, "orders", "count_by_status", func(ctx context.Context) (map[string]int64, error) {
+		cursor, err := db.Collection("orders").Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$status"},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var groups []struct {
+			Status string `bson:"_id"`
+			Count  int64  `bson:"count"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return nil, err
+		}
+
+		counts := make(map[string]int64, len(groups))
+		for _, group := range groups {
+			counts[group.Status] = group.Count
+		}
+		return counts, nil
+	})
+}
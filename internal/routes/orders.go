@@ -4,24 +4,34 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mycandys/orders/internal/handlers"
 	"github.com/mycandys/orders/internal/middlewares"
+	"github.com/mycandys/orders/internal/models"
 )
 
-func setupOrdersRoutes(app *gin.Engine, m *middlewares.Middleware) {
-	orders := app.Group("/orders")
-	ordersHandler := handlers.NewOrderHandler()
+func setupOrdersRoutes(app *gin.Engine, m *middlewares.Middleware, ordersHandler *handlers.OrderHandler) {
+	orders := app.Group("/orders", m.Auth())
 
-	orders.GET(":id", ordersHandler.GetOrder)
-	orders.GET("", ordersHandler.GetOrders)
-	orders.GET("/user/:id", ordersHandler.GetOrdersByUser)
-	orders.GET("/status/:status", ordersHandler.GetOrderByStatus)
-	orders.POST("", ordersHandler.CreateOrder)
-	orders.PUT(":id", ordersHandler.UpdateOrder)
-	orders.DELETE(":id", ordersHandler.DeleteOrder)
-	orders.DELETE("", ordersHandler.DeleteAllOrders)
+	customer := orders.Group("", m.RequireRole(models.RoleCustomer))
 
-	requiredAuth := orders.Use(m.Auth())
+	customer.GET("/me", ordersHandler.GetMyOrders)
+	customer.GET("/me/status/:status", ordersHandler.GetMyOrdersByStatus)
+	customer.DELETE("/me", ordersHandler.DeleteAllMyOrders)
+	customer.POST("/me/:id/cancel", ordersHandler.CancelMyOrder)
+	// customers may only read their own orders, the handler checks ownership
+	customer.GET(":id", ordersHandler.GetOrder)
+	customer.POST("", ordersHandler.CreateOrder)
+	// customers may only patch their own orders and only some fields, the handler checks both
+	customer.PATCH(":id", ordersHandler.PatchOrder)
 
-	requiredAuth.GET("/me", ordersHandler.GetMyOrders)
-	requiredAuth.GET("/me/status/:status", ordersHandler.GetMyOrdersByStatus)
-	requiredAuth.DELETE("/me", ordersHandler.DeleteAllMyOrders)
+	staff := orders.Group("", m.RequireRole(models.RoleStaff))
+
+	staff.GET("", ordersHandler.GetOrders)
+	staff.GET("/user/:id", ordersHandler.GetOrdersByUser)
+	staff.GET("/status/:status", ordersHandler.GetOrderByStatus)
+	staff.PUT(":id", ordersHandler.UpdateOrder)
+
+	admin := orders.Group("", m.RequireRole(models.RoleAdmin))
+
+	admin.DELETE(":id", ordersHandler.DeleteOrder)
+	admin.POST(":id/cancel", ordersHandler.CancelOrder)
+	admin.DELETE("", ordersHandler.DeleteAllOrders)
 }
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/handlers"
+	"github.com/mycandys/orders/internal/middlewares"
+	"github.com/mycandys/orders/internal/models"
+)
+
+func setupReturnsRoutes(app *gin.Engine, m *middlewares.Middleware, returnsHandler *handlers.ReturnHandler) {
+	returns := app.Group("/returns", m.Auth())
+
+	customer := returns.Group("", m.RequireRole(models.RoleCustomer))
+
+	customer.GET("/me", returnsHandler.GetMyReturns)
+	customer.GET("/me/status/:status", returnsHandler.GetMyReturnsByStatus)
+	// customers may only read their own returns, the handler checks ownership
+	customer.GET(":id", returnsHandler.GetReturn)
+	customer.POST("", returnsHandler.CreateReturn)
+
+	staff := returns.Group("", m.RequireRole(models.RoleStaff))
+
+	staff.GET("/user/:id", returnsHandler.GetReturnsByUser)
+	staff.GET("/status/:status", returnsHandler.GetReturnsByStatus)
+	staff.POST(":id/approve", returnsHandler.ApproveReturn)
+	staff.POST(":id/reject", returnsHandler.RejectReturn)
+}
@@ -4,29 +4,64 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/mycandys/orders/internal/handlers"
+	"github.com/mycandys/orders/internal/health"
+	"github.com/mycandys/orders/internal/metrics"
 	"github.com/mycandys/orders/internal/middlewares"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/pricing"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/mycandys/orders/internal/services"
+	"github.com/mycandys/orders/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"time"
 )
 
-func InitRouter() *gin.Engine {
+// Dependencies are everything the routes are served with. They are built once
+// at startup, tests can pass fakes instead.
+type Dependencies struct {
+	Orders      repository.IOrderRepository[*models.Order, *models.Order, models.UpdateOrderDTO, repository.OrderQuery]
+	Returns     repository.IReturnRepository
+	Idempotency repository.IIdempotencyRepository
+	Pricing     *pricing.Calculator
+	// ReturnWindow is how long after delivery returns can be opened.
+	ReturnWindow time.Duration
+
+	Auth        services.IAuthService
+	Analytics   services.IAnalyticsService
+	RequestLogs middlewares.RequestLogPublisher
+	Health      *health.Checker
+}
+
+func InitRouter(deps Dependencies) *gin.Engine {
 	app := gin.New()
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
 	config.AllowHeaders = []string{"*"}
+	config.ExposeHeaders = []string{"ETag"}
 
-	middleware := middlewares.NewMiddleware()
+	middleware := middlewares.NewMiddleware(deps.Auth, deps.Analytics, deps.RequestLogs)
 
+	app.Use(otelgin.Middleware(tracing.ServiceName))
+	app.Use(metrics.Middleware())
 	app.Use(middleware.Logger())
 	app.Use(cors.New(config))
 	app.Use(gin.Logger())
 	app.Use(gin.Recovery())
+	app.Use(middlewares.ErrorHandler())
 
+	app.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	app.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
-	app.GET("/health", handlers.HealthCheck)
+	healthHandler := handlers.NewHealthHandler(deps.Health)
+	app.GET("/health", healthHandler.Ready)
+	app.GET("/health/live", healthHandler.Live)
+	app.GET("/health/ready", healthHandler.Ready)
 
-	setupOrdersRoutes(app, middleware)
+	setupOrdersRoutes(app, middleware, handlers.NewOrderHandler(deps.Orders, deps.Pricing, deps.Idempotency))
+	setupReturnsRoutes(app, middleware, handlers.NewReturnHandler(deps.Returns, deps.Orders, deps.ReturnWindow))
 
 	return app
 }
@@ -0,0 +1,197 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/mycandys/orders/internal/health"
+	"github.com/mycandys/orders/internal/mocks"
+	"github.com/mycandys/orders/internal/models"
+	"github.com/mycandys/orders/internal/pricing"
+	"github.com/mycandys/orders/internal/repository"
+	"github.com/mycandys/orders/internal/services"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder stands in for the analytics service and the request log queue.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+	logs  [][]byte
+}
+
+func (r *recorder) SendEndpointCall(ctx context.Context, url string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, url)
+	return nil
+}
+
+func (r *recorder) Publish(ctx context.Context, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, body)
+	return nil
+}
+
+func newTestRouter() (*gin.Engine, *repository.MemoryOrderRepository, *recorder) {
+	auth := &mocks.AuthServiceMock{}
+	auth.On("ValidateToken", mock.Anything, "customer").Return(&services.VerifyTokenResponse{
+		UserId: "1", Roles: []models.Role{models.RoleCustomer},
+	}, nil)
+	auth.On("ValidateToken", mock.Anything, "staff").Return(&services.VerifyTokenResponse{
+		UserId: "2", Roles: []models.Role{models.RoleStaff},
+	}, nil)
+
+	orders := repository.NewMemoryOrderRepository()
+	calls := &recorder{}
+
+	router := InitRouter(Dependencies{
+		Orders:       orders,
+		Returns:      &mocks.ReturnRepositoryMock{},
+		Idempotency:  &mocks.IdempotencyRepositoryMock{},
+		Pricing:      pricing.NewCalculator(pricing.Config{Currency: "EUR"}),
+		ReturnWindow: 14 * 24 * time.Hour,
+		Auth:         auth,
+		Analytics:    calls,
+		RequestLogs:  calls,
+		Health:       health.NewChecker(0, time.Second),
+	})
+
+	return router, orders, calls
+}
+
+func serve(router *gin.Engine, method string, path string, token string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouterWithoutEnvironment(t *testing.T) {
+	router, orders, calls := newTestRouter()
+
+	payload, _ := json.Marshal(models.CreateOrderDTO{
+		Items:      []models.Item{{ID: "1", Name: "candy", Price: models.NewMoney(250, "EUR"), Quantity: 2}},
+		Cost:       models.NewMoney(500, "EUR"),
+		Address:    "address",
+		Country:    "DE",
+		City:       "city",
+		PostalCode: "10115",
+	})
+
+	if rec := serve(router, "POST", "/orders", "customer", payload); rec.Code != http.StatusCreated {
+		t.Fatalf("creating order returned wrong status code: got %v want %v: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	rec := serve(router, "GET", "/orders/me", "customer", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("listing own orders returned wrong status code: got %v want %v", rec.Code, http.StatusOK)
+	}
+
+	var page repository.Page[models.Order]
+	_ = json.Unmarshal(rec.Body.Bytes(), &page)
+
+	if page.Total != 1 || page.Items[0].UserID != "1" || page.Items[0].Price.Total != models.NewMoney(500, "EUR") {
+		t.Errorf("listing own orders returned unexpected body: got %v", rec.Body.String())
+	}
+
+	if events := orders.Events(); len(events) != 1 || events[0].Type != models.OrderCreated {
+		t.Errorf("creating order recorded unexpected events: got %v", events)
+	}
+	if len(calls.calls) != 2 || len(calls.logs) != 2 {
+		t.Errorf("requests were not logged: got %d analytics calls and %d logs", len(calls.calls), len(calls.logs))
+	}
+}
+
+func TestRouterAuthorization(t *testing.T) {
+	router, _, _ := newTestRouter()
+
+	cases := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"GET", "/orders/me", "", http.StatusUnauthorized},
+		{"GET", "/orders", "customer", http.StatusForbidden},
+		{"GET", "/orders", "staff", http.StatusOK},
+		{"DELETE", "/orders", "staff", http.StatusForbidden},
+		{"GET", "/health/live", "", http.StatusOK},
+		{"GET", "/health/ready", "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		if rec := serve(router, tc.method, tc.path, tc.token, nil); rec.Code != tc.want {
+			t.Errorf("%s %s as %q: got status %v want %v", tc.method, tc.path, tc.token, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestRouterMergePatch(t *testing.T) {
+	router, orders, _ := newTestRouter()
+
+	order, err := orders.InsertOne(context.Background(), &models.Order{
+		ID:         primitive.NewObjectID(),
+		UserID:     "1",
+		Status:     models.OrderStatusPending,
+		Address:    "Main Street 1",
+		Country:    "DE",
+		City:       "Berlin",
+		PostalCode: "10115",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(token string, ifMatch string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/orders/"+order.ID.Hex(), bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("If-Match", ifMatch)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	steps := []struct {
+		token   string
+		ifMatch string
+		body    string
+		want    int
+		etag    string
+	}{
+		{"customer", `"1"`, `{"city":"Hamburg","postalCode":"20095","notes":"ring twice"}`, http.StatusOK, `"2"`},
+		// the customer's first patch changed the version
+		{"staff", `"1"`, `{"status":"paid"}`, http.StatusPreconditionFailed, ""},
+		{"staff", `"2"`, `{"status":"paid","expectedDeliveryDate":"2030-01-01"}`, http.StatusOK, `"3"`},
+		{"customer", `"3"`, `{"city":"Munich"}`, http.StatusConflict, ""},
+	}
+
+	for i, step := range steps {
+		rec := patch(step.token, step.ifMatch, step.body)
+		if rec.Code != step.want {
+			t.Fatalf("step %d returned wrong status code: got %v want %v: %s", i, rec.Code, step.want, rec.Body.String())
+		}
+		if etag := rec.Header().Get("ETag"); etag != step.etag {
+			t.Errorf("step %d returned wrong ETag: got %v want %v", i, etag, step.etag)
+		}
+	}
+
+	found, _ := orders.FindOne(context.Background(), order.ID.Hex())
+	if found.City != "Hamburg" || found.PostalCode != "20095" || found.Notes != "ring twice" || found.Status != models.OrderStatusPaid || found.ExpectedDeliveryDate != "2030-01-01" || found.Address != "Main Street 1" {
+		t.Errorf("patches were not applied as expected: got %+v", found)
+	}
+}
@@ -2,40 +2,37 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/mycandys/orders/internal/env"
 	"net/http"
+	"time"
 )
 
-type AnalyticsService struct {
-	URL string
+type IAnalyticsService interface {
+	SendEndpointCall(ctx context.Context, url string) error
 }
 
-func NewAnalyticsService() *AnalyticsService {
-	analyticsUrl, _ := env.GetEnvVar(env.ANALYTICS_SERVICE_URL)
+type AnalyticsService struct {
+	URL    string
+	client *Client
+}
 
+func NewAnalyticsService(url string, timeout time.Duration) *AnalyticsService {
 	return &AnalyticsService{
-		URL: analyticsUrl,
+		URL:    url,
+		client: newClient("analytics", timeout),
 	}
 }
 
-func (s *AnalyticsService) SendEndpointCall(url string) error {
+func (s *AnalyticsService) SendEndpointCall(ctx context.Context, url string) error {
 
 	var body = []byte(fmt.Sprintf(`{"url": "%s"}`, url))
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/analytics", s.URL), bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/analytics", s.URL), bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-
-	if res.StatusCode != 200 {
-		return fmt.Errorf("analytics server returned status code %d", res.StatusCode)
-	}
-
-	return nil
+	_, err = s.client.Do(req)
+	return err
 }
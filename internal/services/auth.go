@@ -1,46 +1,95 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/mycandys/orders/internal/env"
-	"log"
+	"github.com/mycandys/orders/internal/models"
 	"net/http"
+	"time"
 )
 
 type IAuthService interface {
-	ValidateToken(token string) (*VerifyTokenResponse, error)
+	ValidateToken(ctx context.Context, token string) (*VerifyTokenResponse, error)
 }
 
 type AuthService struct {
-	URL string
+	URL    string
+	client *Client
 }
 
-func NewAuthService() *AuthService {
-	authServiceURL, err := env.GetEnvVar(env.AUTH_SERVICE_URL)
-	if err != nil {
-		log.Fatal(err)
+func NewAuthService(url string, timeout time.Duration) *AuthService {
+	return &AuthService{
+		URL:    url,
+		client: newClient("auth", timeout),
 	}
+}
 
-	return &AuthService{
-		URL: authServiceURL,
+const (
+	AuthModeRemote = "remote"
+	AuthModeJWKS   = "jwks"
+)
+
+// AuthConfig selects and configures the token verification strategy.
+type AuthConfig struct {
+	// Mode is AuthModeRemote (default) or AuthModeJWKS.
+	Mode    string
+	URL     string
+	Timeout time.Duration
+	// JWKSURL defaults to the JWKS document of the auth service.
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
+	Issuer       string
+	Audience     string
+	// RemoteFallback asks the auth service when the signing keys cannot be fetched.
+	RemoteFallback bool
+}
+
+// NewConfiguredAuthService picks the token verification strategy from the mode.
+// "remote" (default) asks the auth service about every token, "jwks" verifies
+// tokens locally and only asks the auth service when RemoteFallback is set and
+// the signing keys cannot be fetched.
+func NewConfiguredAuthService(config AuthConfig) (IAuthService, error) {
+	switch config.Mode {
+	case "", AuthModeRemote:
+		return NewAuthService(config.URL, config.Timeout), nil
+	case AuthModeJWKS:
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", config.Mode)
+	}
+
+	remote := NewAuthService(config.URL, config.Timeout)
+
+	jwksURL := config.JWKSURL
+	if jwksURL == "" {
+		jwksURL = fmt.Sprintf("%s/.well-known/jwks.json", remote.URL)
 	}
+
+	service := NewJWKSAuthService(jwksURL, config.JWKSCacheTTL)
+	service.Issuer = config.Issuer
+	service.Audience = config.Audience
+	if config.RemoteFallback {
+		service.Fallback = remote
+	}
+
+	return service, nil
 }
 
 type VerifyTokenResponse struct {
-	UserId string `json:"userId"`
+	UserId string        `json:"userId"`
+	Roles  []models.Role `json:"roles"`
 }
 
-func (s *AuthService) ValidateToken(token string) (*VerifyTokenResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/auth/verify", s.URL), nil)
+func (s *AuthService) ValidateToken(ctx context.Context, token string) (*VerifyTokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/auth/verify", s.URL), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := s.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +99,7 @@ func (s *AuthService) ValidateToken(token string) (*VerifyTokenResponse, error)
 	}
 
 	var response VerifyTokenResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	err = json.Unmarshal(res.Body, &response)
 	if err != nil {
 		return nil, err
 	}
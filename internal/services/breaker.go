@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive failures that opens a breaker.
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is how long an open breaker rejects calls before it lets a trial call through.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// breaker stops calling a downstream host after it failed Threshold times in a
+// row. Once Cooldown passed it lets a single trial call through, which either
+// closes the breaker again or keeps it open for another cooldown.
+type breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+	now      func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may be made. Every allowed call must be
+// followed by success, failure or release.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+	b.trial = false
+}
+
+// release ends an allowed call that tells nothing about the host, e.g. because
+// the caller gave up.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// breakers holds one breaker per downstream host, shared by all clients
+// calling that host.
+var breakers = struct {
+	sync.Mutex
+	byHost map[string]*breaker
+}{byHost: make(map[string]*breaker)}
+
+func breakerFor(host string) *breaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	b, ok := breakers.byHost[host]
+	if !ok {
+		b = newBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown)
+		breakers.byHost[host] = b
+	}
+	return b
+}
+
+// BreakerStates returns the state of the circuit breaker of every host called so far.
+func BreakerStates() map[string]BreakerState {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	states := make(map[string]BreakerState, len(breakers.byHost))
+	for host, b := range breakers.byHost {
+		states[host] = b.State()
+	}
+	return states
+}
+
+// CheckBreakers reports the state of every breaker and fails while any of them
+// is open, since calls to that host currently fail fast.
+func CheckBreakers(ctx context.Context) (interface{}, error) {
+	states := BreakerStates()
+
+	open := make([]string, 0)
+	for host, state := range states {
+		if state == BreakerOpen {
+			open = append(open, host)
+		}
+	}
+	if len(open) > 0 {
+		sort.Strings(open)
+		return states, fmt.Errorf("open for %s", strings.Join(open, ", "))
+	}
+	return states, nil
+}
@@ -1,37 +1,30 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"github.com/mycandys/orders/internal/env"
-	"log"
 	"net/http"
+	"time"
 )
 
 type CartService struct {
-	URL string
+	URL    string
+	client *Client
 }
 
-func NewCartService() *CartService {
-	cartServiceURL, err := env.GetEnvVar(env.CART_SERVICE_URL)
-	if err != nil {
-		log.Fatal(err)
-	}
-
+func NewCartService(url string, timeout time.Duration) *CartService {
 	return &CartService{
-		URL: cartServiceURL,
+		URL:    url,
+		client: newClient("cart", timeout),
 	}
 }
 
-func (s *CartService) ClearCart(cartId string) error {
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/carts/%s/clear", s.URL, cartId), nil)
-	if err != nil {
-		return err
-	}
-
-	_, err = http.DefaultClient.Do(req)
+func (s *CartService) ClearCart(ctx context.Context, cartId string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/carts/%s/clear", s.URL, cartId), nil)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = s.client.Do(req)
+	return err
 }
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mycandys/orders/internal/apperrors"
+	"github.com/mycandys/orders/internal/correlation"
+	"github.com/mycandys/orders/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxResponseBody limits how much of a response body is read into memory.
+const maxResponseBody = 1 << 20
+
+// Response is a response whose body was already read and closed.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Client calls another service with a timeout per attempt, retries idempotent
+// requests with jittered exponential backoff and stops calling hosts whose
+// circuit breaker is open.
+type Client struct {
+	Service string
+	// Timeout bounds every single attempt.
+	Timeout     time.Duration
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+
+	http *http.Client
+}
+
+// newClient returns a client whose calls to service are measured, traced and
+// carry the correlation id and W3C trace context of the calling request.
+func newClient(service string, timeout time.Duration) *Client {
+	return &Client{
+		Service:     service,
+		Timeout:     timeout,
+		MaxAttempts: 3,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+		http:        &http.Client{Transport: newTransport(service)},
+	}
+}
+
+func newTransport(service string) http.RoundTripper {
+	return correlation.Transport(otelhttp.NewTransport(
+		metrics.Transport(service, http.DefaultTransport),
+		otelhttp.WithSpanNameFormatter(func(operation string, req *http.Request) string {
+			return fmt.Sprintf("%s %s", service, req.Method)
+		}),
+	))
+}
+
+// Do sends req and returns the response of a 2xx or 3xx answer. Other status
+// codes and transport failures are returned as upstream or timeout
+// *apperrors.Error wrapping a *ServiceError.
+func (c *Client) Do(req *http.Request) (*Response, error) {
+	res, err := c.do(req)
+
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		if errors.Is(err, ErrTimeout) {
+			return nil, apperrors.Timeout(fmt.Sprintf("The %s service did not respond in time", c.Service), err)
+		}
+		return nil, apperrors.Upstream(c.Service, err)
+	}
+
+	return res, err
+}
+
+func (c *Client) do(req *http.Request) (*Response, error) {
+	attempts := 1
+	if isIdempotent(req.Method) && (req.Body == nil || req.GetBody != nil) {
+		attempts = c.MaxAttempts
+	}
+
+	b := breakerFor(req.URL.Host)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(req.Context(), c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		var res *Response
+		res, err = c.attempt(req, attempt, b)
+		if err == nil {
+			return res, nil
+		}
+		if !isRetryable(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func (c *Client) attempt(req *http.Request, attempt int, b *breaker) (*Response, error) {
+	if !b.allow() {
+		return nil, &ServiceError{Service: c.Service, Kind: ErrCircuitOpen}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), c.Timeout)
+	defer cancel()
+
+	r := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			b.release()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	res, err := c.http.Do(r)
+	if err != nil {
+		return nil, c.transportError(req.Context(), err, b)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	// drain what is left so the connection can be reused
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, c.transportError(req.Context(), err, b)
+	}
+
+	switch {
+	case res.StatusCode >= 500:
+		b.failure()
+		return nil, &ServiceError{Service: c.Service, Kind: ErrServerError, StatusCode: res.StatusCode}
+	case res.StatusCode >= 400:
+		// the service answered, so it is healthy even though it rejected the request
+		b.success()
+		return nil, &ServiceError{Service: c.Service, Kind: ErrClientError, StatusCode: res.StatusCode}
+	}
+
+	b.success()
+	return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: body}, nil
+}
+
+func (c *Client) transportError(parent context.Context, err error, b *breaker) error {
+	// the caller gave up, that tells nothing about the service
+	if parent.Err() != nil {
+		b.release()
+		return parent.Err()
+	}
+
+	b.failure()
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &ServiceError{Service: c.Service, Kind: ErrTimeout, Err: err}
+	}
+	return &ServiceError{Service: c.Service, Kind: ErrUnavailable, Err: err}
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.MinBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > c.MaxBackoff {
+		backoff = c.MaxBackoff
+	}
+	// full jitter, so clients retrying together do not hit the service in lockstep
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isRetryable(err error) bool {
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) {
+		return false
+	}
+	if serviceErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable) || errors.Is(err, ErrServerError)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
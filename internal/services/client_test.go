@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(timeout time.Duration) *Client {
+	client := newClient("test", timeout)
+	client.MinBackoff = time.Millisecond
+	client.MaxBackoff = time.Millisecond
+	return client
+}
+
+func TestClientRetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("cleared"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("{}"))
+	res, err := newTestClient(time.Second).Do(req)
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if string(res.Body) != "cleared" || calls != 3 {
+		t.Errorf("got body %q after %d calls", res.Body, calls)
+	}
+}
+
+func TestClientDoesNotRetryPost(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("{}"))
+	_, err := newTestClient(time.Second).Do(req)
+
+	var serviceErr *ServiceError
+	if !errors.Is(err, ErrServerError) || !errors.As(err, &serviceErr) || serviceErr.StatusCode != 500 {
+		t.Errorf("expected a server error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("POST was sent %d times", calls)
+	}
+}
+
+func TestClientErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(20 * time.Millisecond)
+	client.MaxAttempts = 1
+
+	req, _ := http.NewRequest("GET", server.URL+"/missing", nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrClientError) || IsTransient(err) {
+		t.Errorf("expected a client error, got %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/slow", nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrTimeout) || !IsTransient(err) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestClientOpensBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(time.Second)
+	client.MaxAttempts = 1
+
+	for i := 0; i < DefaultBreakerThreshold; i++ {
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", server.URL, nil)
+		_, _ = client.Do(req)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the breaker to be open, got %v", err)
+	}
+	if calls != DefaultBreakerThreshold {
+		t.Errorf("service was called %d times", calls)
+	}
+	if state := BreakerStates()[req.URL.Host]; state != BreakerOpen {
+		t.Errorf("got breaker state %s", state)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	b.failure()
+	if b.allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("breaker did not allow a trial call after the cooldown")
+	}
+	if b.allow() {
+		t.Error("breaker allowed a second call while the trial is running")
+	}
+
+	b.failure()
+	if b.State() != BreakerOpen {
+		t.Errorf("failed trial left the breaker %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.allow()
+	b.success()
+	if b.State() != BreakerClosed || !b.allow() {
+		t.Errorf("successful trial left the breaker %s", b.State())
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTimeout is returned when a service did not answer within its timeout.
+	ErrTimeout = errors.New("service timed out")
+	// ErrUnavailable is returned when a service could not be reached at all.
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrClientError is returned when a service rejected the request with a 4xx status code.
+	ErrClientError = errors.New("service rejected the request")
+	// ErrServerError is returned when a service failed with a 5xx status code.
+	ErrServerError = errors.New("service failed")
+	// ErrCircuitOpen is returned without calling a service whose circuit breaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// ServiceError describes a failed call to another service. Kind is one of the
+// errors above, so callers can tell failures apart with errors.Is.
+type ServiceError struct {
+	Service    string
+	Kind       error
+	StatusCode int
+	Err        error
+}
+
+func (e *ServiceError) Error() string {
+	message := fmt.Sprintf("%s: %v", e.Service, e.Kind)
+	if e.StatusCode != 0 {
+		message = fmt.Sprintf("%s: status code %d", message, e.StatusCode)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%s: %v", message, e.Err)
+	}
+	return message
+}
+
+func (e *ServiceError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// IsTransient reports whether err is a failure of the service rather than a
+// rejection of the request, so the call may succeed later.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrServerError) ||
+		errors.Is(err, ErrCircuitOpen)
+}
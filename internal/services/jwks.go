@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mycandys/orders/internal/models"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeysUnavailable is returned when no signing keys could be obtained from the JWKS endpoint.
+var ErrKeysUnavailable = errors.New("signing keys unavailable")
+
+// minJWKSRefreshInterval limits how often the key set may be refetched.
+const minJWKSRefreshInterval = 30 * time.Second
+
+// maxJWKSStaleTTLs is how many TTLs past their fetch keys are still used while
+// they cannot be refetched, so a key rotated out because it leaked does not
+// stay valid for as long as the auth service is down.
+const maxJWKSStaleTTLs = 6
+
+var jwksSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWKSAuthService verifies signed tokens locally against the keys the auth
+// service publishes as a JWKS document, instead of asking it for every request.
+type JWKSAuthService struct {
+	JWKSURL  string
+	Issuer   string
+	Audience string
+	// TTL is how long fetched keys are trusted before they are refetched.
+	TTL time.Duration
+	// Fallback verifies tokens remotely while the keys cannot be fetched, nil disables it.
+	Fallback IAuthService
+
+	client      *Client
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	refreshMu   sync.Mutex
+	lastAttempt time.Time
+	lastErr     error
+}
+
+func NewJWKSAuthService(jwksURL string, ttl time.Duration) *JWKSAuthService {
+	return &JWKSAuthService{
+		JWKSURL: jwksURL,
+		TTL:     ttl,
+		client:  newClient("auth_jwks", 5*time.Second),
+		keys:    make(map[string]interface{}),
+	}
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	UserId string        `json:"userId"`
+	Roles  []models.Role `json:"roles"`
+}
+
+func (s *JWKSAuthService) ValidateToken(ctx context.Context, token string) (*VerifyTokenResponse, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwksSigningMethods),
+		jwt.WithExpirationRequired(),
+	}
+	if s.Issuer != "" {
+		options = append(options, jwt.WithIssuer(s.Issuer))
+	}
+	if s.Audience != "" {
+		options = append(options, jwt.WithAudience(s.Audience))
+	}
+
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		return s.keyFunc(ctx, token)
+	}, options...)
+	if errors.Is(err, ErrKeysUnavailable) && s.Fallback != nil {
+		return s.Fallback.ValidateToken(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userId := claims.UserId
+	if userId == "" {
+		userId = claims.Subject
+	}
+	if userId == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &VerifyTokenResponse{UserId: userId, Roles: claims.Roles}, nil
+}
+
+func (s *JWKSAuthService) keyFunc(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, age := s.cachedKey(kid)
+	if key != nil && age < s.TTL {
+		return key, nil
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		// keep serving stale keys while the auth service is unreachable, but not forever
+		if key != nil && age < maxJWKSStaleTTLs*s.TTL {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, _ = s.cachedKey(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// cachedKey returns the key with the id and how long ago it was fetched.
+func (s *JWKSAuthService) cachedKey(kid string) (interface{}, time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	age := time.Since(s.fetchedAt)
+
+	key := s.keys[kid]
+	// tokens without a key id are accepted when the set has exactly one key
+	if key == nil && kid == "" && len(s.keys) == 1 {
+		for _, only := range s.keys {
+			key = only
+		}
+	}
+
+	return key, age
+}
+
+// refresh refetches the key set unless that was already attempted within
+// minJWKSRefreshInterval, so unknown key ids in forged tokens cannot hammer
+// the auth service.
+func (s *JWKSAuthService) refresh(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if time.Since(s.lastAttempt) < minJWKSRefreshInterval {
+		return s.lastErr
+	}
+
+	keys, err := s.fetch(ctx)
+	// a request that gave up says nothing about the auth service, the next one may try again
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+	}
+	s.lastAttempt = time.Now()
+	if err != nil {
+		s.lastErr = fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+		return s.lastErr
+	}
+	s.lastErr = nil
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (s *JWKSAuthService) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("jwks endpoint returned status code %d", res.StatusCode)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(res.Body, &document); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks document contains no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
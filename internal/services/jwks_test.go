@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mycandys/orders/internal/models"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type remoteAuthStub struct {
+	calls int
+}
+
+func (s *remoteAuthStub) ValidateToken(ctx context.Context, token string) (*VerifyTokenResponse, error) {
+	s.calls++
+	return &VerifyTokenResponse{UserId: "remote"}, nil
+}
+
+func newJWKSServer(t *testing.T, key *rsa.PrivateKey, kid string) *httptest.Server {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWKSAuthServiceValidateToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, key, "key-1")
+
+	service := NewJWKSAuthService(server.URL, time.Minute)
+	service.Issuer = "auth"
+	service.Audience = "orders"
+
+	now := time.Now()
+	valid := jwt.MapClaims{
+		"sub":   "1",
+		"roles": []string{"staff"},
+		"iss":   "auth",
+		"aud":   "orders",
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	res, err := service.ValidateToken(context.Background(), signToken(t, key, "key-1", valid))
+	if err != nil {
+		t.Fatalf("valid token was rejected: %v", err)
+	}
+	if res.UserId != "1" || !models.HasRole(res.Roles, models.RoleStaff) {
+		t.Errorf("unexpected verification result: %+v", res)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := map[string]string{
+		"expired":        signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "iss": "auth", "aud": "orders", "exp": now.Add(-time.Hour).Unix()}),
+		"not yet valid":  signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "iss": "auth", "aud": "orders", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Hour).Unix()}),
+		"no expiry":      signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "iss": "auth", "aud": "orders"}),
+		"wrong audience": signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "iss": "auth", "aud": "cart", "exp": now.Add(time.Hour).Unix()}),
+		"wrong issuer":   signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "iss": "evil", "aud": "orders", "exp": now.Add(time.Hour).Unix()}),
+		"wrong key":      signToken(t, otherKey, "key-1", valid),
+		"unknown kid":    signToken(t, otherKey, "key-2", valid),
+	}
+
+	for name, token := range cases {
+		if _, err := service.ValidateToken(context.Background(), token); err == nil {
+			t.Errorf("%s token was accepted", name)
+		}
+	}
+}
+
+func TestJWKSAuthServiceFallback(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	service := NewJWKSAuthService(unavailable.URL, time.Minute)
+
+	if _, err := service.ValidateToken(context.Background(), token); !errors.Is(err, ErrKeysUnavailable) {
+		t.Errorf("expected keys to be unavailable without fallback, got %v", err)
+	}
+
+	remote := &remoteAuthStub{}
+	service.Fallback = remote
+
+	res, err := service.ValidateToken(context.Background(), token)
+	if err != nil || res.UserId != "remote" || remote.calls != 1 {
+		t.Errorf("expected remote fallback, got %+v, %v", res, err)
+	}
+}
+
+func TestJWKSAuthServiceStaleKeys(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	up := newJWKSServer(t, key, "key-1")
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		up.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	service := NewJWKSAuthService(server.URL, time.Minute)
+	if _, err := service.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("valid token was rejected: %v", err)
+	}
+
+	down = true
+
+	// expire the keys and allow another refresh
+	age := func(d time.Duration) {
+		service.fetchedAt = time.Now().Add(-d)
+		service.lastAttempt = time.Time{}
+	}
+
+	age(2 * time.Minute)
+	if _, err := service.ValidateToken(context.Background(), token); err != nil {
+		t.Errorf("stale key was rejected while the auth service is down: %v", err)
+	}
+
+	age(maxJWKSStaleTTLs*time.Minute + time.Second)
+	if _, err := service.ValidateToken(context.Background(), token); !errors.Is(err, ErrKeysUnavailable) {
+		t.Errorf("expected a key past the maximum staleness to be rejected, got %v", err)
+	}
+}
+
+func TestJWKSAuthServiceCancelledRefresh(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signToken(t, key, "key-1", jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	service := NewJWKSAuthService(newJWKSServer(t, key, "key-1").URL, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := service.ValidateToken(ctx, token); !errors.Is(err, ErrKeysUnavailable) {
+		t.Errorf("expected the refresh to be cancelled with the request, got %v", err)
+	}
+
+	// the cancelled refresh does not hold back the next request
+	if _, err := service.ValidateToken(context.Background(), token); err != nil {
+		t.Errorf("valid token was rejected after a cancelled refresh: %v", err)
+	}
+}
@@ -2,12 +2,12 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/mycandys/orders/internal/env"
 	"github.com/mycandys/orders/internal/models"
-	"log"
 	"net/http"
+	"time"
 )
 
 type EmailData struct {
@@ -35,38 +35,45 @@ func NewOrderCreatedEmail(userId string, orderID string) *EmailData {
 	}
 }
 
-type NotificationService struct {
-	URL string
-}
+func NewOrderCancelledEmail(userId string, orderID string, reason string) *EmailData {
+	message := fmt.Sprintf("Your order %s has been cancelled", orderID)
+	if reason != "" {
+		message = fmt.Sprintf("%s: %s", message, reason)
+	}
 
-func NewNotificationService() *NotificationService {
-	notificationsServiceURL, err := env.GetEnvVar(env.NOTIFICATIONS_SERVICE_URL)
-	if err != nil {
-		log.Fatal(err)
+	return &EmailData{
+		Title:   "Order cancelled",
+		Message: message,
+		Type:    "order_cancelled",
+		UserID:  userId,
 	}
+}
 
+type NotificationService struct {
+	URL    string
+	client *Client
+}
+
+func NewNotificationService(url string, timeout time.Duration) *NotificationService {
 	return &NotificationService{
-		URL: notificationsServiceURL,
+		URL:    url,
+		client: newClient("notification", timeout),
 	}
 }
 
-func (s *NotificationService) SendEmail(data *EmailData) error {
+func (s *NotificationService) SendEmail(ctx context.Context, data *EmailData) error {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/emails", s.URL), bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/emails", s.URL), bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	_, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err = s.client.Do(req)
+	return err
 }
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// amqpCarrier reads and writes the trace context as AMQP message headers.
+type amqpCarrier amqp.Table
+
+func (c amqpCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c amqpCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c amqpCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectAMQP adds the trace context of ctx to the headers of msg.
+func InjectAMQP(ctx context.Context, msg *amqp.Publishing) {
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, amqpCarrier(msg.Headers))
+}
+
+// ExtractAMQP returns ctx with the trace context sent in the headers of delivery.
+func ExtractAMQP(ctx context.Context, delivery amqp.Delivery) context.Context {
+	if delivery.Headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, amqpCarrier(delivery.Headers))
+}
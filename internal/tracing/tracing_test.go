@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	msg := amqp.Publishing{}
+	InjectAMQP(ctx, &msg)
+
+	if _, ok := msg.Headers["traceparent"]; !ok {
+		t.Fatalf("traceparent header was not set: %v", msg.Headers)
+	}
+
+	consumed := trace.SpanContextFromContext(ExtractAMQP(context.Background(), amqp.Delivery{Headers: msg.Headers}))
+	if consumed.TraceID() != span.SpanContext().TraceID() || !consumed.IsRemote() {
+		t.Errorf("amqp headers did not carry the trace, got %s want %s", consumed.TraceID(), span.SpanContext().TraceID())
+	}
+
+	carrier := make(map[string]string)
+	Inject(ctx, carrier)
+
+	stored := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	if stored.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("map carrier did not carry the trace, got %s want %s", stored.TraceID(), span.SpanContext().TraceID())
+	}
+}
@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/mycandys/orders/internal/models"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Violation is a rule a single request field broke.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var setup sync.Once
+
+// Setup registers the custom rules with the validator gin binds requests with
+// and makes violations name fields by their JSON name. It is safe to call repeatedly.
+func Setup() {
+	setup.Do(func() {
+		validate, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+
+		_ = validate.RegisterValidation("positive_money", func(fl validator.FieldLevel) bool {
+			money, ok := fl.Field().Interface().(models.Money)
+			return ok && money.Amount > 0 && validate.Var(money.Currency, "iso4217") == nil
+		})
+		_ = validate.RegisterValidation("postal_code", isPostalCode)
+		_ = validate.RegisterValidation("order_status", func(fl validator.FieldLevel) bool {
+			return models.IsOrderStatusValid(fl.Field().String())
+		})
+	})
+}
+
+// Violations lists the broken rules of a validation error and returns nil for
+// any other error, e.g. a malformed body.
+func Violations(err error) []Violation {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	violations := make([]Violation, 0, len(errs))
+	for _, fieldErr := range errs {
+		violations = append(violations, Violation{
+			Field:   fieldName(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Message: message(fieldErr),
+		})
+	}
+	return violations
+}
+
+// fieldName is the JSON path of the field without the name of the validated struct.
+func fieldName(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func message(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fieldErr.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at least %s entries", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters long", fieldErr.Param())
+	case "max":
+		if fieldErr.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s entries", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters long", fieldErr.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fieldErr.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fieldErr.Param())
+	case "url":
+		return "must be a URL"
+	case "datetime":
+		return fmt.Sprintf("must be a date time formatted as %s", fieldErr.Param())
+	case "iso3166_1_alpha2":
+		return "must be an ISO 3166-1 alpha-2 country code"
+	case "positive_money":
+		return "must be a positive amount in an ISO 4217 currency"
+	case "postal_code":
+		return "is not a valid postal code for the country"
+	case "order_status":
+		return "is not a known order status"
+	default:
+		return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+	}
+}